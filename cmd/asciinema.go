@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/gvc/pkg/asciinema"
@@ -16,14 +19,24 @@ func RegisterAsciinema(cli *Cli) {
 		GroupID: cli.groupID,
 		Short:   "Records your terminal in asciinema cast form.",
 	}
-	ascer := asciinema.NewAsciinema()
+	// Created lazily, asciinema writes to stdout and checks locale on creation,
+	// which would break the output of shell completion.
+	var ascer *asciinema.Asciinema
+	getAscer := func() *asciinema.Asciinema {
+		if ascer == nil {
+			ascer = asciinema.NewAsciinema()
+		}
+		return ascer
+	}
 
 	auth := &cobra.Command{
 		Use:     "auth",
 		Aliases: []string{"a"},
-		Short:   "Authrization to asciinema.org.",
+		Short:   "Authrization to asciinema.org or the configured server.",
 		Run: func(cmd *cobra.Command, args []string) {
-			ascer.Auth()
+			if err := getAscer().Auth(); err != nil {
+				gprint.PrintError("%+v", err)
+			}
 		},
 	}
 	parent.AddCommand(auth)
@@ -32,17 +45,59 @@ func RegisterAsciinema(cli *Cli) {
 		Use:     "record",
 		Aliases: []string{"r"},
 		Short:   "Creates a record.",
-		Long:    "Example: g a record <xxx.cast>",
+		Long:    `Example: g a record -i 2 -c "go test ./..." -t demo --cols 100 --rows 30 <xxx.cast>`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
 				cmd.Help()
 				return
 			}
-			ascer.Record(args[0])
+			opts := &asciinema.RecordOptions{}
+			opts.IdleTimeLimit, _ = cmd.Flags().GetFloat64("idle-time-limit")
+			opts.Command, _ = cmd.Flags().GetString("command")
+			opts.Title, _ = cmd.Flags().GetString("title")
+			opts.Cols, _ = cmd.Flags().GetInt("cols")
+			opts.Rows, _ = cmd.Flags().GetInt("rows")
+			opts.EnvWhitelist, _ = cmd.Flags().GetStringSlice("env")
+			opts.Append, _ = cmd.Flags().GetBool("append")
+			opts.NoRedact, _ = cmd.Flags().GetBool("no-redact")
+			if err := getAscer().RecordWithOptions(args[0], opts); err != nil {
+				gprint.PrintError("%+v", err)
+			}
 		},
+		ValidArgsFunction: completeCastFiles,
 	}
+	record.Flags().Float64P("idle-time-limit", "i", 0, "limit recorded idle time to given seconds")
+	record.Flags().StringP("command", "c", "", "record a single command instead of a shell")
+	record.Flags().StringP("title", "t", "", "title of the cast, default: file name")
+	record.Flags().Int("cols", 0, "resize terminal columns for recording")
+	record.Flags().Int("rows", 0, "resize terminal rows for recording")
+	record.Flags().StringSliceP("env", "e", asciinema.DefaultEnvWhitelist, "env variables to capture in cast header")
+	record.Flags().BoolP("append", "a", false, "append to an existing cast")
+	record.Flags().Bool("no-redact", false, "do not redact secrets after recording")
 	parent.AddCommand(record)
 
+	script := &cobra.Command{
+		Use:     "script",
+		Aliases: []string{"sc"},
+		Short:   "Generates a record from a tape script.",
+		Long:    "Example: g a sc -o demo.cast <demo.tape>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			output, _ := cmd.Flags().GetString("output")
+			if err := asciinema.RunScript(args[0], output); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return []string{"tape"}, cobra.ShellCompDirectiveFilterFileExt
+		},
+	}
+	script.Flags().StringP("output", "o", "", "output cast file, default: Output in tape or <tape name>.cast")
+	parent.AddCommand(script)
+
 	play := &cobra.Command{
 		Use:     "play",
 		Aliases: []string{"p"},
@@ -53,73 +108,197 @@ func RegisterAsciinema(cli *Cli) {
 				cmd.Help()
 				return
 			}
-			ascer.Play(args[0])
+			getAscer().Play(args[0])
 		},
+		ValidArgsFunction: completeCastFiles,
 	}
 	parent.AddCommand(play)
 
 	upload := &cobra.Command{
 		Use:     "upload",
 		Aliases: []string{"u"},
-		Short:   "Uploads a record file to asciinema.org.",
+		Short:   "Uploads a record file to asciinema.org or the configured server.",
 		Long:    "Example: g a u <xxx.cast>",
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
 				cmd.Help()
 				return
 			}
-			ascer.Upload(args[0])
+			var err error
+			if noRedact, _ := cmd.Flags().GetBool("no-redact"); noRedact {
+				err = getAscer().Upload(args[0])
+			} else {
+				err = getAscer().UploadRedacted(args[0])
+			}
+			if err != nil {
+				gprint.PrintError("%+v", err)
+			}
 		},
+		ValidArgsFunction: completeCastFiles,
 	}
+	upload.Flags().Bool("no-redact", false, "upload the cast without redacting secrets")
 	parent.AddCommand(upload)
 
 	convert := &cobra.Command{
-		Use:     "convert-to-gif",
-		Aliases: []string{"cg"},
-		Short:   "Converts an asciinema cast to gif.",
-		Long:    "Example: g a cg <input.cast> <output.gif>",
+		Use:     "convert",
+		Aliases: []string{"cg", "convert-to-gif"},
+		Short:   "Converts an asciinema cast to gif, apng, webp, svg, mp4 or webm.",
+		Long:    "Example: g a cg --theme monokai --font-size 16 --fps 20 <input.cast> <output.gif>\nVideos: g a cg -f mp4 --resolution 1280x720 <input.cast> <output.mp4>",
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 2 {
 				cmd.Help()
 				return
 			}
-			err := ascer.ConvertToGif(args[0], args[1])
-			if err == nil {
-				var repoType string
-				fmt.Println(gprint.CyanStr("Upload gif to remote repo?"))
-				fmt.Println(gprint.CyanStr("1) github."))
-				fmt.Println(gprint.CyanStr("2) gitee."))
-				fmt.Println(gprint.CyanStr("3) abort."))
-				fmt.Scanln(&repoType)
-				if repoType == "1" {
-					repo.UploadPics(repo.RepoGithub, args[1])
-				} else if repoType == "2" {
-					repo.UploadPics(repo.RepoGitee, args[1])
-				} else {
+			// the output may be uploaded to the pic repo.
+			input := args[0]
+			if noRedact, _ := cmd.Flags().GetBool("no-redact"); !noRedact {
+				redacted, err := asciinema.RedactedCopy(input)
+				if err != nil {
+					gprint.PrintError("%+v", err)
 					return
 				}
+				defer asciinema.RemoveRedactedCopy(redacted)
+				input = redacted
+			}
+			output, err := asciinema.Convert(input, args[1], getRenderOptions(cmd))
+			if err != nil {
+				gprint.PrintError("%+v", err)
+				return
 			}
+			var repoType string
+			fmt.Println(gprint.CyanStr("Upload %s to remote repo?", filepath.Base(output)))
+			fmt.Println(gprint.CyanStr("1) github."))
+			fmt.Println(gprint.CyanStr("2) gitee."))
+			fmt.Println(gprint.CyanStr("3) abort."))
+			fmt.Scanln(&repoType)
+			if repoType == "1" {
+				repo.UploadPics(repo.RepoGithub, output)
+			} else if repoType == "2" {
+				repo.UploadPics(repo.RepoGitee, output)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 1 {
+				return []string{"gif", "png", "apng", "webp", "svg", "mp4", "webm"}, cobra.ShellCompDirectiveFilterFileExt
+			}
+			return completeCastFiles(cmd, args, toComplete)
 		},
 	}
+	addRenderFlags(convert, true, "")
+	convert.Flags().Bool("no-redact", false, "render the cast without redacting secrets")
 	parent.AddCommand(convert)
 
+	export := &cobra.Command{
+		Use:     "export",
+		Aliases: []string{"e"},
+		Short:   "Exports an asciinema cast to animated svg, images or an html page with player.",
+		Long:    "Example: g a e --format svg --theme nord <input.cast> <output.svg>\nHTML: g a e -f html <input.cast> <output.html>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				cmd.Help()
+				return
+			}
+			if _, err := asciinema.Convert(args[0], args[1], getRenderOptions(cmd)); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 1 {
+				return []string{"svg", "gif", "png", "apng", "webp", "html"}, cobra.ShellCompDirectiveFilterFileExt
+			}
+			return completeCastFiles(cmd, args, toComplete)
+		},
+	}
+	addRenderFlags(export, true, asciinema.FormatSvg)
+	parent.AddCommand(export)
+
+	reformat := &cobra.Command{
+		Use:     "reformat",
+		Aliases: []string{"rf"},
+		Short:   "Converts a cast between asciicast v1, v2 and v3.",
+		Long:    "Example: g a rf --to 3 <input.cast> <output.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				cmd.Help()
+				return
+			}
+			version, _ := cmd.Flags().GetInt("to")
+			if err := asciinema.ConvertCastVersion(args[0], args[1], version); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	reformat.Flags().Int("to", asciinema.CastV2, "asciicast version of the output, 1, 2 or 3")
+	parent.AddCommand(reformat)
+
+	transcript := &cobra.Command{
+		Use:     "transcript",
+		Aliases: []string{"tr"},
+		Short:   "Exports output of a cast as plain text.",
+		Long:    "Example: g a tr --timestamps <input.cast> <output.txt>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				cmd.Help()
+				return
+			}
+			timestamps, _ := cmd.Flags().GetBool("timestamps")
+			if err := asciinema.ExportTranscript(args[0], args[1], timestamps); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	transcript.Flags().BoolP("timestamps", "t", false, "prefix lines with the time they appear")
+	parent.AddCommand(transcript)
+
+	snapshot := &cobra.Command{
+		Use:     "snapshot",
+		Aliases: []string{"sn"},
+		Short:   "Renders the terminal at a given time of an asciinema cast to svg or png.",
+		Long:    "Example: g a sn --at 3.5 <input.cast> <output.svg|output.png>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				cmd.Help()
+				return
+			}
+			at, _ := cmd.Flags().GetFloat64("at")
+			if _, err := asciinema.Snapshot(args[0], args[1], at, getRenderOptions(cmd)); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 1 {
+				return []string{"svg", "png"}, cobra.ShellCompDirectiveFilterFileExt
+			}
+			return completeCastFiles(cmd, args, toComplete)
+		},
+	}
+	snapshot.Flags().Float64("at", 0, "time in seconds of the cast")
+	snapshot.Flags().StringP("format", "f", "", "output format: svg or png, default: by extension of output file")
+	addRenderFlags(snapshot, false, "")
+	parent.AddCommand(snapshot)
+
 	cut := &cobra.Command{
 		Use:     "cut",
 		Aliases: []string{"c"},
 		Short:   "Removes a certain range of time frames.",
-		Long:    "Example: g a c --start=1.0 --end=5.0 <in.cast> <out.cast>",
+		Long:    "Example: g a c --start=1.0 --end=5.0 <in.cast> <out.cast>\nMarkers: g a c --start=intro --end=build <in.cast> <out.cast>",
 		Run: func(cmd *cobra.Command, args []string) {
-			start, _ := cmd.Flags().GetFloat64("start")
-			end, _ := cmd.Flags().GetFloat64("end")
-			if len(args) < 2 || end <= start {
+			start, _ := cmd.Flags().GetString("start")
+			end, _ := cmd.Flags().GetString("end")
+			if len(args) < 2 || end == "" {
 				cmd.Help()
 				return
 			}
-			ascer.Cut(args[0], args[1], start, end)
+			if err := getAscer().Cut(args[0], args[1], asciinema.TimeBound(start), asciinema.TimeBound(end)); err != nil {
+				gprint.PrintError("%+v", err)
+			}
 		},
+		ValidArgsFunction: completeCastFiles,
 	}
-	cut.Flags().Float64P("start", "s", 0, "start time")
-	cut.Flags().Float64P("end", "e", 0, "end time")
+	cut.Flags().StringP("start", "s", "0", "start time in seconds or marker name")
+	cut.Flags().StringP("end", "e", "", "end time in seconds or marker name")
 	parent.AddCommand(cut)
 
 	speed := &cobra.Command{
@@ -129,18 +308,21 @@ func RegisterAsciinema(cli *Cli) {
 		Long:    "Example: g a s --factor=0.7 --start=1.0 --end=5.0 <in.cast> <out.cast>",
 		Run: func(cmd *cobra.Command, args []string) {
 			factor, _ := cmd.Flags().GetFloat64("factor")
-			start, _ := cmd.Flags().GetFloat64("start")
-			end, _ := cmd.Flags().GetFloat64("end")
-			if len(args) < 2 || end <= start || factor <= 0 {
+			start, _ := cmd.Flags().GetString("start")
+			end, _ := cmd.Flags().GetString("end")
+			if len(args) < 2 || factor <= 0 {
 				cmd.Help()
 				return
 			}
-			ascer.Speed(args[0], args[1], factor, start, end)
+			if err := getAscer().Speed(args[0], args[1], factor, asciinema.TimeBound(start), asciinema.TimeBound(end)); err != nil {
+				gprint.PrintError("%+v", err)
+			}
 		},
+		ValidArgsFunction: completeCastFiles,
 	}
 	speed.Flags().Float64P("factor", "f", 0.7, "speed factor")
-	speed.Flags().Float64P("start", "s", 0, "start time")
-	speed.Flags().Float64P("end", "e", 0, "end time")
+	speed.Flags().StringP("start", "s", "", "start time in seconds or marker name, default: the whole cast")
+	speed.Flags().StringP("end", "e", "", "end time in seconds or marker name")
 	parent.AddCommand(speed)
 
 	quantize := &cobra.Command{
@@ -154,11 +336,330 @@ func RegisterAsciinema(cli *Cli) {
 				cmd.Help()
 				return
 			}
-			ascer.Quantize(args[0], args[1], ranges)
+			getAscer().Quantize(args[0], args[1], ranges)
 		},
+		ValidArgsFunction: completeCastFiles,
 	}
 	quantize.Flags().StringArrayP("ranges", "r", []string{}, "quantization ranges")
 	parent.AddCommand(quantize)
 
+	info := &cobra.Command{
+		Use:     "info",
+		Aliases: []string{"in"},
+		Short:   "Shows header, duration, events and longest pauses of a cast.",
+		Long:    "Example: g a in --pauses 10 <xxx.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			pauses, _ := cmd.Flags().GetInt("pauses")
+			if err := asciinema.ShowCastInfo(args[0], pauses); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	info.Flags().IntP("pauses", "p", 5, "number of longest pauses to show")
+	parent.AddCommand(info)
+
+	lint := &cobra.Command{
+		Use:     "lint",
+		Aliases: []string{"l"},
+		Short:   "Checks a cast for invalid lines, disordered times, echoed terminal queries and long pauses.",
+		Long:    "Example: g a l --fix --max-pause 3 <xxx.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			opts := &asciinema.LintOptions{}
+			opts.Fix, _ = cmd.Flags().GetBool("fix")
+			opts.MaxPause, _ = cmd.Flags().GetFloat64("max-pause")
+			opts.Output, _ = cmd.Flags().GetString("output")
+			remaining, err := asciinema.LintCast(args[0], opts)
+			if err != nil {
+				gprint.PrintError("%+v", err)
+			}
+			// exits with 1 for ci if any issue is left.
+			if err != nil || len(remaining) > 0 {
+				os.Exit(1)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	lint.Flags().Bool("fix", false, "rewrite the cast with fixable issues fixed")
+	lint.Flags().Float64P("max-pause", "p", 0, "max pause in seconds, default: idle_time_limit in cast or 5, negative to skip")
+	lint.Flags().StringP("output", "o", "", "output cast file of --fix, default: the input file")
+	parent.AddCommand(lint)
+
+	edit := &cobra.Command{
+		Use:     "edit",
+		Aliases: []string{"ed"},
+		Short:   "Edits a cast interactively, deletes, speeds up or quantizes marked ranges.",
+		Long:    "Example: g a ed -o out.cast <in.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			output, _ := cmd.Flags().GetString("output")
+			editor, err := asciinema.NewCastEditor(args[0], output)
+			if err != nil {
+				gprint.PrintError("%+v", err)
+				return
+			}
+			editor.SpeedFactor, _ = cmd.Flags().GetFloat64("factor")
+			editor.MaxPause, _ = cmd.Flags().GetFloat64("max-pause")
+			if editor.SpeedFactor <= 0 || editor.MaxPause <= 0 {
+				cmd.Help()
+				return
+			}
+			if err := editor.Run(); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	edit.Flags().StringP("output", "o", "", "output cast file, default: the input file")
+	edit.Flags().Float64P("factor", "f", asciinema.DefaultEditorSpeedFactor, "speed factor of s, S uses its reciprocal")
+	edit.Flags().Float64P("max-pause", "p", asciinema.DefaultEditorMaxPause, "max pause in seconds after quantization")
+	parent.AddCommand(edit)
+
+	concat := &cobra.Command{
+		Use:     "concat",
+		Aliases: []string{"ct"},
+		Short:   "Concatenates casts, terminal sizes are reconciled.",
+		Long:    "Example: g a ct --gap 1 <a.cast> <b.cast> [more.cast...] <out.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 3 {
+				cmd.Help()
+				return
+			}
+			gap, _ := cmd.Flags().GetFloat64("gap")
+			if err := asciinema.Concat(args[:len(args)-1], args[len(args)-1], gap); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	concat.Flags().Float64P("gap", "g", 0.5, "seconds between casts")
+	parent.AddCommand(concat)
+
+	insertPause := &cobra.Command{
+		Use:     "insert-pause",
+		Aliases: []string{"ip"},
+		Short:   "Inserts a pause at a certain time.",
+		Long:    "Example: g a ip --at 3.5 --duration 2 <in.cast> <out.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			at, _ := cmd.Flags().GetString("at")
+			duration, _ := cmd.Flags().GetFloat64("duration")
+			if len(args) < 2 || at == "" {
+				cmd.Help()
+				return
+			}
+			if err := asciinema.InsertPause(args[0], args[1], asciinema.TimeBound(at), duration); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	insertPause.Flags().StringP("at", "a", "", "time in seconds or marker name")
+	insertPause.Flags().Float64P("duration", "d", 1, "seconds of the pause")
+	parent.AddCommand(insertPause)
+
+	trim := &cobra.Command{
+		Use:     "trim",
+		Aliases: []string{"t"},
+		Short:   "Removes leading and trailing idle time.",
+		Long:    "Example: g a t --keep 0.5 <in.cast> <out.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				cmd.Help()
+				return
+			}
+			keep, _ := cmd.Flags().GetFloat64("keep")
+			noLeading, _ := cmd.Flags().GetBool("no-leading")
+			noTrailing, _ := cmd.Flags().GetBool("no-trailing")
+			if err := asciinema.Trim(args[0], args[1], !noLeading, !noTrailing, keep); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	trim.Flags().Float64P("keep", "k", 0, "seconds of idle time to keep")
+	trim.Flags().Bool("no-leading", false, "keep leading idle time")
+	trim.Flags().Bool("no-trailing", false, "keep trailing idle time")
+	parent.AddCommand(trim)
+
+	splice := &cobra.Command{
+		Use:     "splice",
+		Aliases: []string{"sp"},
+		Short:   "Replaces a certain range of time frames with another cast.",
+		Long:    "Example: g a sp --start=1.0 --end=5.0 --insert=fix.cast <in.cast> <out.cast>",
+		Run: func(cmd *cobra.Command, args []string) {
+			start, _ := cmd.Flags().GetString("start")
+			end, _ := cmd.Flags().GetString("end")
+			insert, _ := cmd.Flags().GetString("insert")
+			if len(args) < 2 || end == "" || insert == "" {
+				cmd.Help()
+				return
+			}
+			if err := asciinema.Splice(args[0], args[1], asciinema.TimeBound(start), asciinema.TimeBound(end), insert); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	splice.Flags().StringP("start", "s", "0", "start time in seconds or marker name")
+	splice.Flags().StringP("end", "e", "", "end time in seconds or marker name")
+	splice.Flags().StringP("insert", "i", "", "cast to insert")
+	splice.RegisterFlagCompletionFunc("insert", completeCastFiles)
+	parent.AddCommand(splice)
+
+	redact := &cobra.Command{
+		Use:     "redact",
+		Aliases: []string{"rd"},
+		Short:   "Redacts tokens, keys, private ips, emails and home path from a cast.",
+		Long:    `Example: g a rd -r "host=db\.internal\.\w+" -d email --replacement "***" <in.cast> [out.cast]`,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts := &asciinema.RedactOptions{Rules: map[string]string{}}
+			ruleList, _ := cmd.Flags().GetStringArray("rule")
+			for _, r := range ruleList {
+				name, pattern, ok := strings.Cut(r, "=")
+				if !ok || name == "" || pattern == "" {
+					gprint.PrintError("invalid rule: %s, expected name=regex", r)
+					return
+				}
+				opts.Rules[name] = pattern
+			}
+			opts.Disabled, _ = cmd.Flags().GetStringSlice("disable")
+			opts.Replacement, _ = cmd.Flags().GetString("replacement")
+			opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+			if save, _ := cmd.Flags().GetBool("save"); save {
+				if err := asciinema.SaveRedactRules(opts.Rules, opts.Replacement); err != nil {
+					gprint.PrintError("%+v", err)
+					return
+				}
+			}
+			if list, _ := cmd.Flags().GetBool("list"); list {
+				asciinema.PrintRedactRules()
+				return
+			}
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			output := ""
+			if len(args) > 1 {
+				output = args[1]
+			}
+			if err := asciinema.Redact(args[0], output, opts); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: completeCastFiles,
+	}
+	redact.Flags().StringArrayP("rule", "r", []string{}, "custom rule in name=regex form, only the first group is replaced if any")
+	redact.Flags().StringSliceP("disable", "d", nil, "names of rules to skip")
+	redact.Flags().String("replacement", "", fmt.Sprintf("replacement text, default: %s", asciinema.DefaultRedactReplacement))
+	redact.Flags().BoolP("dry-run", "n", false, "only report matches")
+	redact.Flags().Bool("save", false, "save custom rules and replacement to gvc config")
+	redact.Flags().BoolP("list", "l", false, "list rules")
+	parent.AddCommand(redact)
+
+	server := &cobra.Command{
+		Use:     "server",
+		Aliases: []string{"sv"},
+		Short:   "Shows or sets the asciinema server, for self-hosted asciinema-server.",
+		Long:    "Example: g a sv https://asciinema.example.com\nReset to asciinema.org: g a sv --reset",
+		Run: func(cmd *cobra.Command, args []string) {
+			if reset, _ := cmd.Flags().GetBool("reset"); reset {
+				args = []string{""}
+			}
+			if len(args) == 0 {
+				fmt.Println(asciinema.GetAsciinemaServer())
+				return
+			}
+			if err := asciinema.SetAsciinemaServer(args[0]); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+	}
+	server.Flags().Bool("reset", false, "use asciinema.org again")
+	parent.AddCommand(server)
+
+	list := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "Lists recordings uploaded from this machine.",
+		Long:    "Example: g a ls --all",
+		Run: func(cmd *cobra.Command, args []string) {
+			all, _ := cmd.Flags().GetBool("all")
+			asciinema.ListUploads(all)
+		},
+	}
+	list.Flags().BoolP("all", "a", false, "show uploads to all servers")
+	parent.AddCommand(list)
+
+	del := &cobra.Command{
+		Use:     "delete",
+		Aliases: []string{"del"},
+		Short:   "Deletes an uploaded recording.",
+		Long:    "Example: g a del <id|url>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			localOnly, _ := cmd.Flags().GetBool("local")
+			if err := asciinema.DeleteUpload(args[0], localOnly); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+	}
+	del.Flags().Bool("local", false, "only remove it from the local upload list")
+	parent.AddCommand(del)
+
 	cli.rootCmd.AddCommand(parent)
 }
+
+// Flags of rendering, animation flags are only added for animated outputs.
+func addRenderFlags(cmd *cobra.Command, animated bool, defaultFormat string) {
+	cmd.Flags().String("theme", "", fmt.Sprintf("theme: %s, or custom \"bg,fg,color0,...,color15\"", strings.Join(asciinema.ThemeNames(), ", ")))
+	cmd.Flags().Float64("font-size", asciinema.DefaultFontSize, "font size in pixels")
+	cmd.Flags().Float64("line-height", asciinema.DefaultLineHeight, "line height relative to font size")
+	cmd.RegisterFlagCompletionFunc("theme", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return asciinema.ThemeNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	if !animated {
+		return
+	}
+	usage := fmt.Sprintf("output format: %s", strings.Join(asciinema.ConvertFormats(), ", "))
+	if defaultFormat == "" {
+		usage += ", default: by extension of output file"
+	}
+	cmd.Flags().StringP("format", "f", defaultFormat, usage)
+	cmd.Flags().Int("fps", asciinema.DefaultFPS, fmt.Sprintf("max frames per second, up to %d", asciinema.MaxFPS))
+	cmd.Flags().Float64P("speed", "s", 1, "playback speed")
+	cmd.Flags().Float64P("idle-time-limit", "i", 0, "limit idle time to given seconds, default: idle_time_limit in cast or 5")
+	cmd.Flags().Float64("last-frame-hold", asciinema.DefaultLastFrameHold, "seconds to show the last frame, negative for none")
+	cmd.Flags().String("resolution", "", "WIDTHxHEIGHT or WIDTH of mp4/webm videos, requires ffmpeg")
+	cmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return asciinema.ConvertFormats(), cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func getRenderOptions(cmd *cobra.Command) *asciinema.RenderOptions {
+	opts := &asciinema.RenderOptions{}
+	opts.Format, _ = cmd.Flags().GetString("format")
+	opts.Theme, _ = cmd.Flags().GetString("theme")
+	opts.FontSize, _ = cmd.Flags().GetFloat64("font-size")
+	opts.LineHeight, _ = cmd.Flags().GetFloat64("line-height")
+	opts.FPS, _ = cmd.Flags().GetInt("fps")
+	opts.Speed, _ = cmd.Flags().GetFloat64("speed")
+	opts.IdleTimeLimit, _ = cmd.Flags().GetFloat64("idle-time-limit")
+	opts.LastFrameHold, _ = cmd.Flags().GetFloat64("last-frame-hold")
+	opts.Resolution, _ = cmd.Flags().GetString("resolution")
+	return opts
+}
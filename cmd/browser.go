@@ -36,6 +36,12 @@ func RegisterBrowser(cli *Cli) {
 			keep, _ := cmd.Flags().GetBool("keep-temp-files")
 			browser.SaveBrowserData(args[0], keep)
 		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return browser.SupportedBrowsers(), cobra.ShellCompDirectiveNoFileComp
+		},
 	}
 	save.Flags().BoolP("keep-temp-files", "k", false, "Keeps temp files or not")
 	parent.AddCommand(save)
@@ -29,10 +29,10 @@ func RegisterCloc(cli *Cli) {
 		Use:     "cloc",
 		Aliases: []string{"cl"},
 		Short:   "Counts lines of code.",
-		Long:    "Example: cloc <your_path>",
+		Long:    "Example: cloc <your_path>\nDiff: cloc --diff <path_a|git_ref_a> <path_b|git_ref_b>",
 		GroupID: cli.groupID,
 		Run: func(cmd *cobra.Command, args []string) {
-			cloc := cloc.NewCloc(&CCtx{cmd: cmd})
+			cloc := cloc.NewCloc(&CCtx{cmd: cmd, args: args})
 			cloc.Run()
 		},
 	}
@@ -49,6 +49,17 @@ func RegisterCloc(cli *Cli) {
 	parent.Flags().StringP(cloc.FlagNotMatch, "M", "", "Exclude file name (regex).")
 	parent.Flags().StringP(cloc.FlagMatchDir, "d", "", "Include dir name (regex).")
 	parent.Flags().StringP(cloc.FlagNotMatchDir, "D", "", "Exclude dir name (regex).")
+	parent.Flags().Bool(cloc.FlagDiff, false, "Compute differences in code, comment and blank lines between two paths or git refs.")
+
+	parent.RegisterFlagCompletionFunc(cloc.FlagSortTag, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return cloc.SortTags(), cobra.ShellCompDirectiveNoFileComp
+	})
+	parent.RegisterFlagCompletionFunc(cloc.FlagOutputType, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return cloc.OutputTypes(), cobra.ShellCompDirectiveNoFileComp
+	})
+	parent.RegisterFlagCompletionFunc(cloc.FlagIncludeLang, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return cloc.LanguageNames(), cobra.ShellCompDirectiveNoFileComp
+	})
 
 	cli.rootCmd.AddCommand(parent)
 }
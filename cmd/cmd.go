@@ -22,6 +22,7 @@ type Cli struct {
 func NewCli(gitTag, gitHash string) (c *Cli) {
 	c = &Cli{
 		rootCmd: &cobra.Command{
+			Use:   "g",
 			Short: "geek's valuable collections",
 			Long:  "g <Command> <SubCommand> --flags args...",
 		},
@@ -42,6 +43,8 @@ func (c *Cli) initiate() {
 	RegisterGPT(c)
 	RegisterRepo(c)
 	RegisterGopher(c)
+	RegisterCompletion(c)
+	RegisterPlugin(c)
 }
 
 func (that *Cli) Run() {
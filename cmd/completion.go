@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/gvc/pkg/completion"
+	"github.com/spf13/cobra"
+)
+
+func RegisterCompletion(cli *Cli) {
+	cli.rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	parent := &cobra.Command{
+		Use:       "completion",
+		Aliases:   []string{"comp"},
+		Short:     "Generates or installs shell completion scripts.",
+		Long:      "Example: g completion bash|zsh|fish|powershell [--install]",
+		GroupID:   cli.groupID,
+		ValidArgs: completion.Shells,
+	}
+
+	root := cli.rootCmd
+	generators := map[string]completion.Generator{
+		completion.ShellBash: func(w io.Writer) error {
+			return root.GenBashCompletionV2(w, true)
+		},
+		completion.ShellZsh: func(w io.Writer) error {
+			return root.GenZshCompletion(w)
+		},
+		completion.ShellFish: func(w io.Writer) error {
+			return root.GenFishCompletion(w, true)
+		},
+		completion.ShellPowershell: func(w io.Writer) error {
+			return root.GenPowerShellCompletionWithDesc(w)
+		},
+	}
+
+	for _, shell := range completion.Shells {
+		gen := generators[shell]
+		shellName := shell
+		shellCmd := &cobra.Command{
+			Use:   shellName,
+			Short: "Generates completion script for " + shellName + ".",
+			Long:  "Example: g completion " + shellName + " --install",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				install, _ := cmd.Flags().GetBool("install")
+				if !install {
+					gen(os.Stdout)
+					return
+				}
+				if err := completion.Install(shellName, root.Name(), gen); err != nil {
+					gprint.PrintError("%+v", err)
+				}
+			},
+		}
+		shellCmd.Flags().BoolP("install", "i", false, "Installs the completion script for current user.")
+		parent.AddCommand(shellCmd)
+	}
+
+	cli.rootCmd.AddCommand(parent)
+}
+
+// Completes asciinema cast files.
+func completeCastFiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"cast"}, cobra.ShellCompDirectiveFilterFileExt
+}
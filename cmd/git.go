@@ -1,10 +1,207 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/gvc/pkg/git"
 	"github.com/spf13/cobra"
 )
 
+const (
+	hostsFileName string = "hosts-file"
+)
+
+func addHostsUpdateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayP("source", "s", []string{}, "Hosts source, remote url or local file.")
+	cmd.Flags().StringArrayP("include", "i", []string{}, "Only includes domains matching the pattern, like *.github.com.")
+	cmd.Flags().StringArrayP("exclude", "e", []string{}, "Excludes domains matching the pattern.")
+	cmd.Flags().Bool("save", false, "Saves sources and filters to config.")
+}
+
+func newHostsModifier(cmd *cobra.Command) *git.HostsModifier {
+	m := git.NewModifier()
+	hostsFile, _ := cmd.Flags().GetString(hostsFileName)
+	m.SetHostsFile(hostsFile)
+	if cmd.Flags().Lookup("source") == nil {
+		return m
+	}
+	sources, _ := cmd.Flags().GetStringArray("source")
+	include, _ := cmd.Flags().GetStringArray("include")
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	save, _ := cmd.Flags().GetBool("save")
+	m.SetSources(sources...)
+	m.SetFilter(include, exclude)
+	if save {
+		m.SaveConfig()
+	}
+	return m
+}
+
+func newHostsCommand() *cobra.Command {
+	parent := &cobra.Command{
+		Use:     "hosts",
+		Aliases: []string{"h"},
+		Short:   "Manages the hosts file block written by gvc.",
+	}
+	parent.PersistentFlags().StringP(hostsFileName, "f", "", "Uses another hosts file instead of the system one.")
+
+	update := &cobra.Command{
+		Use:     "update",
+		Aliases: []string{"u"},
+		Short:   "Updates hosts file.",
+		Run: func(cmd *cobra.Command, args []string) {
+			m := newHostsModifier(cmd)
+			m.Run()
+		},
+	}
+	addHostsUpdateFlags(update)
+	parent.AddCommand(update)
+
+	status := &cobra.Command{
+		Use:     "status",
+		Aliases: []string{"s"},
+		Short:   "Shows age and entries of the managed block.",
+		Run: func(cmd *cobra.Command, args []string) {
+			m := newHostsModifier(cmd)
+			if err := m.Status(); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+	}
+	parent.AddCommand(status)
+
+	diff := &cobra.Command{
+		Use:     "diff",
+		Aliases: []string{"d"},
+		Short:   "Previews changes before updating hosts file.",
+		Run: func(cmd *cobra.Command, args []string) {
+			m := newHostsModifier(cmd)
+			m.Diff()
+		},
+	}
+	addHostsUpdateFlags(diff)
+	parent.AddCommand(diff)
+
+	restore := &cobra.Command{
+		Use:     "restore",
+		Aliases: []string{"r"},
+		Short:   "Restores hosts file from a backup.",
+		Long:    "Example: g g h r [backup-name], the latest backup is used by default.",
+		Run: func(cmd *cobra.Command, args []string) {
+			m := newHostsModifier(cmd)
+			if list, _ := cmd.Flags().GetBool("list"); list {
+				m.ShowBackups()
+				return
+			}
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			if err := m.Restore(name); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return newHostsModifier(cmd).ListBackups(), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	restore.Flags().BoolP("list", "l", false, "Lists backups.")
+	parent.AddCommand(restore)
+
+	remove := &cobra.Command{
+		Use:     "remove",
+		Aliases: []string{"rm"},
+		Short:   "Removes the managed block from hosts file.",
+		Run: func(cmd *cobra.Command, args []string) {
+			m := newHostsModifier(cmd)
+			if err := m.RemoveBlock(); err != nil {
+				gprint.PrintError("%+v", err)
+			}
+		},
+	}
+	parent.AddCommand(remove)
+	return parent
+}
+
+func newDNSCommand() *cobra.Command {
+	parent := &cobra.Command{
+		Use:     "dns",
+		Aliases: []string{"d"},
+		Short:   "Local DNS server for github acceleration without modifying hosts file.",
+	}
+
+	serve := &cobra.Command{
+		Use:     "serve",
+		Aliases: []string{"s"},
+		Short:   "Starts a local DNS server.",
+		Long:    "Example: g g d s --listen=127.0.0.1:53530 --upstream=udp://223.5.5.5:53",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := git.NewDNSConfig()
+			cfg.Listen, _ = cmd.Flags().GetString("listen")
+			cfg.Upstream, _ = cmd.Flags().GetString("upstream")
+			cfg.DoH, _ = cmd.Flags().GetString("doh")
+			cfg.Refresh, _ = cmd.Flags().GetDuration("refresh")
+			noHostsSources, _ := cmd.Flags().GetBool("no-hosts-sources")
+			cfg.UseHostsSources = !noHostsSources
+			if domains, _ := cmd.Flags().GetStringArray("domain"); len(domains) > 0 {
+				cfg.Domains = domains
+			}
+			ttl, _ := cmd.Flags().GetUint32("ttl")
+			cfg.TTL = ttl
+
+			server := git.NewDNSServer(cfg)
+			server.RefreshRecords()
+			if err := server.Start(); err != nil {
+				gprint.PrintError("%+v", err)
+				return
+			}
+			defer server.Close()
+			gprint.PrintSuccess("DNS server is listening on %s, upstream: %s", server.Addr(), cfg.Upstream)
+
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			<-sig
+		},
+	}
+	serve.Flags().StringP("listen", "l", git.DefaultDNSListen, "Listen address.")
+	serve.Flags().StringP("upstream", "u", git.DefaultDNSUpstream, "Upstream for other domains, udp://host:port, tcp://host:port or DoH url.")
+	serve.Flags().StringP("doh", "o", git.DefaultDNSDoH, "DoH server for looking up configured domains, disabled if empty.")
+	serve.Flags().StringArrayP("domain", "d", []string{}, "Domains answered locally, looked up via DoH and hosts sources.")
+	serve.Flags().Uint32P("ttl", "t", git.DefaultDNSTTL, "TTL for local answers.")
+	serve.Flags().DurationP("refresh", "r", time.Hour, "Refresh interval of local records, disabled if zero.")
+	serve.Flags().Bool("no-hosts-sources", false, "Does not gather IPs from hosts sources.")
+	parent.AddCommand(serve)
+
+	resolved := &cobra.Command{
+		Use:     "resolved-conf",
+		Aliases: []string{"rc"},
+		Short:   "Shows config for systemd-resolved to use the local DNS server.",
+		Run: func(cmd *cobra.Command, args []string) {
+			listen, _ := cmd.Flags().GetString("listen")
+			domains, _ := cmd.Flags().GetStringArray("domain")
+			if len(domains) == 0 {
+				domains = git.DefaultDNSDomains
+			}
+			fmt.Println(git.ResolvedConf(listen, domains))
+			gprint.PrintInfo("Save it to /etc/systemd/resolved.conf.d/gvc.conf, then run: sudo systemctl restart systemd-resolved")
+		},
+	}
+	resolved.Flags().StringP("listen", "l", git.DefaultDNSListen, "Listen address of the local DNS server.")
+	resolved.Flags().StringArrayP("domain", "d", []string{}, "Domains answered locally, the same as --domain of serve.")
+	parent.AddCommand(resolved)
+	return parent
+}
+
 func RegisterGit(cli *Cli) {
 	parent := &cobra.Command{
 		Use:     "git",
@@ -17,37 +214,51 @@ func RegisterGit(cli *Cli) {
 		Use:     "update-hosts",
 		Aliases: []string{"uh", "u"},
 		Short:   "Updates hosts file.",
+		Long:    `Example: g g u -s <url_or_file> -i "*.github.com" -i "*.githubusercontent.com"`,
 		Run: func(cmd *cobra.Command, args []string) {
-			m := git.NewModifier()
+			m := newHostsModifier(cmd)
 			m.Run()
 		},
 	}
+	addHostsUpdateFlags(hosts)
+	hosts.Flags().StringP(hostsFileName, "f", "", "Uses another hosts file instead of the system one.")
 	parent.AddCommand(hosts)
 
+	parent.AddCommand(newHostsCommand())
+	parent.AddCommand(newDNSCommand())
+
 	var (
-		destHostName string = "dest_host"
-		destPortName string = "dest_port"
-		timeoutName  string = "timeout"
+		destHostName    string = "dest_host"
+		destPortName    string = "dest_port"
+		timeoutName     string = "timeout"
+		idleTimeoutName string = "idle_timeout"
 	)
 	crokscrew := &cobra.Command{
 		Use:     "crokscrew",
 		Aliases: []string{"cs", "c"},
-		Short:   "Http proxy for ssh.",
+		Short:   "Http/socks5 proxy for ssh.",
 		Long:    "Example: g g cs --dest_host=xxx --dest_port=xxx --timeout=xxx",
 		Run: func(cmd *cobra.Command, args []string) {
 			destHost, _ := cmd.Flags().GetString(destHostName)
 			destPort, _ := cmd.Flags().GetString(destPortName)
 			timeout, _ := cmd.Flags().GetInt(timeoutName)
+			idleTimeout, _ := cmd.Flags().GetInt(idleTimeoutName)
 			if destHost == "" || destPort == "" {
 				cmd.Help()
 				return
 			}
-			git.GrokscrewHttpSSH(destHost, destPort, timeout)
+			git.GrokscrewHttpSSH(
+				destHost,
+				destPort,
+				time.Duration(timeout)*time.Second,
+				time.Duration(idleTimeout)*time.Second,
+			)
 		},
 	}
 	crokscrew.Flags().StringP(destHostName, "a", "", "Specifies dest host.")
 	crokscrew.Flags().StringP(destPortName, "p", "", "Specifies dest port.")
-	crokscrew.Flags().IntP(timeoutName, "t", 10, "Specifies timeout.")
+	crokscrew.Flags().IntP(timeoutName, "t", 10, "Specifies timeout in seconds for proxy handshake.")
+	crokscrew.Flags().IntP(idleTimeoutName, "i", 0, "Closes idle connection after seconds, disabled if zero.")
 	parent.AddCommand(crokscrew)
 
 	toggle := &cobra.Command{
@@ -60,5 +271,329 @@ func RegisterGit(cli *Cli) {
 	}
 	parent.AddCommand(toggle)
 
+	sshProxy := &cobra.Command{
+		Use:     "ssh-proxy",
+		Aliases: []string{"sp"},
+		Short:   "Manages proxy block in ~/.ssh/config.",
+	}
+	identityName := "identity"
+	setSSHProxy := &cobra.Command{
+		Use:     "set",
+		Aliases: []string{"s"},
+		Short:   "Sets proxy for hosts like github.com or ssh.github.com:443.",
+		Long:    "Example: g g sp s -i gitlab.com=~/.ssh/id_ecdsa gitlab.com gitee.com ssh.github.com:443",
+		Run: func(cmd *cobra.Command, args []string) {
+			identities, _ := cmd.Flags().GetStringToString(identityName)
+			homeDir, _ := os.UserHomeDir()
+			for host, identity := range identities {
+				if strings.HasPrefix(identity, "~") {
+					identities[host] = filepath.Join(homeDir, strings.TrimPrefix(identity, "~"))
+				}
+			}
+			git.SetProxyForSSH(identities, args...)
+		},
+	}
+	setSSHProxy.Flags().StringToStringP(identityName, "i", nil, "Specifies private key for host, like github.com=~/.ssh/id_ed25519.")
+	sshProxy.AddCommand(setSSHProxy)
+	sshProxy.AddCommand(&cobra.Command{
+		Use:     "keys",
+		Aliases: []string{"k"},
+		Short:   "Shows ssh keys found in ~/.ssh.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.ShowSSHKeys()
+		},
+	})
+	sshProxy.AddCommand(&cobra.Command{
+		Use:     "status",
+		Aliases: []string{"st"},
+		Short:   "Shows hosts in the managed block.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.ShowSSHProxyStatus()
+		},
+	})
+	sshProxy.AddCommand(&cobra.Command{
+		Use:     "remove",
+		Aliases: []string{"rm"},
+		Short:   "Removes the managed block.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.RemoveProxyForSSH()
+		},
+	})
+	parent.AddCommand(sshProxy)
+	parent.AddCommand(newSSHKeygenCommand())
+	parent.AddCommand(newHTTPSProxyCommand())
+
+	checkTimeoutName := "timeout"
+	check := &cobra.Command{
+		Use:     "check",
+		Aliases: []string{"ck"},
+		Short:   "Diagnoses connectivity to github/gitee: dns, tcp, proxy, ssh and https.",
+		Run: func(cmd *cobra.Command, args []string) {
+			timeout, _ := cmd.Flags().GetInt(checkTimeoutName)
+			git.NewChecker(time.Duration(timeout) * time.Second).Run()
+		},
+	}
+	check.Flags().IntP(checkTimeoutName, "t", 5, "Timeout in seconds for each step.")
+	parent.AddCommand(check)
+	parent.AddCommand(newWorkspaceCommand())
+
 	cli.rootCmd.AddCommand(parent)
 }
+
+func newSSHKeygenCommand() *cobra.Command {
+	var (
+		fileName       = "file"
+		commentName    = "comment"
+		passphraseName = "passphrase"
+		registerName   = "register"
+		titleName      = "title"
+		forceName      = "force"
+	)
+	keygen := &cobra.Command{
+		Use:     "ssh-keygen",
+		Aliases: []string{"kg"},
+		Short:   "Generates an ed25519 ssh key.",
+		Long:    "Example: g g kg -r github -r gitee",
+		Run: func(cmd *cobra.Command, args []string) {
+			fPath, _ := cmd.Flags().GetString(fileName)
+			comment, _ := cmd.Flags().GetString(commentName)
+			passphrase, _ := cmd.Flags().GetString(passphraseName)
+			platforms, _ := cmd.Flags().GetStringSlice(registerName)
+			title, _ := cmd.Flags().GetString(titleName)
+			force, _ := cmd.Flags().GetBool(forceName)
+			if fPath == "" {
+				homeDir, _ := os.UserHomeDir()
+				fPath = filepath.Join(homeDir, ".ssh", "id_ed25519")
+			}
+			if comment == "" {
+				comment = git.DefaultSSHKeyComment()
+			}
+			if !cmd.Flags().Changed(passphraseName) {
+				var err error
+				if passphrase, err = git.ReadPassphrase(); err != nil {
+					gprint.PrintError("%+v", err)
+					return
+				}
+			}
+			pubKey, err := git.GenerateSSHKey(fPath, comment, passphrase, force)
+			if err != nil {
+				gprint.PrintError("%+v", err)
+				return
+			}
+			gprint.PrintSuccess("Key saved: %s", fPath)
+			fmt.Println(pubKey)
+			if title == "" {
+				title = comment
+			}
+			for _, platform := range platforms {
+				if err := git.RegisterSSHKey(platform, title, pubKey); err != nil {
+					gprint.PrintError("%+v", err)
+				} else {
+					gprint.PrintSuccess("Registered with %s.", platform)
+				}
+			}
+		},
+	}
+	keygen.Flags().StringP(fileName, "f", "", "Private key path, default: ~/.ssh/id_ed25519.")
+	keygen.Flags().StringP(commentName, "C", "", "Comment of the key, default: user@hostname.")
+	keygen.Flags().StringP(passphraseName, "P", "", "Passphrase of private key, prompted for if omitted. It is visible in shell history and ps.")
+	keygen.Flags().StringSliceP(registerName, "r", nil, "Registers public key with github/gitee.")
+	keygen.Flags().StringP(titleName, "t", "", "Title of the registered key, default: comment.")
+	keygen.Flags().Bool(forceName, false, "Overwrites existing key.")
+	keygen.RegisterFlagCompletionFunc(registerName, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{git.SSHKeyPlatformGithub, git.SSHKeyPlatformGitee}, cobra.ShellCompDirectiveNoFileComp
+	})
+	return keygen
+}
+
+func newHTTPSProxyCommand() *cobra.Command {
+	var (
+		proxyName  = "proxy"
+		mirrorName = "mirror"
+	)
+	httpsProxy := &cobra.Command{
+		Use:     "https-proxy",
+		Aliases: []string{"hp"},
+		Short:   "Manages http proxies and mirrors for git in ~/.gitconfig.",
+	}
+
+	set := &cobra.Command{
+		Use:     "set",
+		Aliases: []string{"s"},
+		Short:   "Sets http.proxy for urls, default: https://github.com.",
+		Long:    "Example: g g hp s -p socks5://127.0.0.1:1080 https://github.com https://gitlab.com",
+		Run: func(cmd *cobra.Command, args []string) {
+			proxy, _ := cmd.Flags().GetString(proxyName)
+			git.SetGitHTTPProxy(proxy, args...)
+		},
+	}
+	set.Flags().StringP(proxyName, "p", "", "Proxy uri, local proxy in config is used if not specified.")
+	httpsProxy.AddCommand(set)
+
+	httpsProxy.AddCommand(&cobra.Command{
+		Use:     "unset",
+		Aliases: []string{"u"},
+		Short:   "Unsets http.proxy for urls, all managed ones if no url is specified.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.UnsetGitHTTPProxy(args...)
+		},
+	})
+
+	mirror := &cobra.Command{
+		Use:     "mirror",
+		Aliases: []string{"m"},
+		Short:   "Rewrites urls to a mirror with insteadOf, default: https://github.com/.",
+		Long:    "Example: g g hp m -m https://ghproxy.com/ https://github.com/",
+		Run: func(cmd *cobra.Command, args []string) {
+			m, _ := cmd.Flags().GetString(mirrorName)
+			git.SetGitMirror(m, args...)
+		},
+	}
+	mirror.Flags().StringP(mirrorName, "m", "", "Mirror prefix, reverse proxy in config is used if not specified.")
+	httpsProxy.AddCommand(mirror)
+
+	httpsProxy.AddCommand(&cobra.Command{
+		Use:     "unmirror",
+		Aliases: []string{"um"},
+		Short:   "Removes rewrites for urls, all managed ones if no url is specified.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.UnsetGitMirror(args...)
+		},
+	})
+
+	httpsProxy.AddCommand(&cobra.Command{
+		Use:     "status",
+		Aliases: []string{"st"},
+		Short:   "Shows managed and effective settings.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.ShowGitHTTPStatus()
+		},
+	})
+
+	httpsProxy.AddCommand(&cobra.Command{
+		Use:     "remove",
+		Aliases: []string{"rm"},
+		Short:   "Removes the managed block.",
+		Run: func(cmd *cobra.Command, args []string) {
+			git.RemoveGitConfigBlock()
+		},
+	})
+	return httpsProxy
+}
+
+func newWorkspaceCommand() *cobra.Command {
+	var (
+		dirName      = "dir"
+		workersName  = "workers"
+		fileName     = "file"
+		orgName      = "org"
+		platformName = "platform"
+		sshName      = "ssh"
+	)
+	getWorkspace := func(cmd *cobra.Command) *git.Workspace {
+		dir, _ := cmd.Flags().GetString(dirName)
+		workers, _ := cmd.Flags().GetInt(workersName)
+		return git.NewWorkspace(dir, workers)
+	}
+
+	workspace := &cobra.Command{
+		Use:     "workspace",
+		Aliases: []string{"ws"},
+		Short:   "Manages multiple repos in a workspace directory.",
+	}
+	workspace.PersistentFlags().StringP(dirName, "d", "", "Workspace directory, default: current directory.")
+	workspace.PersistentFlags().IntP(workersName, "w", git.DefaultWorkspaceWorkers, "Max number of repos processed in parallel.")
+
+	clone := &cobra.Command{
+		Use:     "clone",
+		Aliases: []string{"c"},
+		Short:   "Clones repos into <dir>/<host>/<owner>/<name>.",
+		Long:    "Example: g g ws c -f repos.txt, g g ws c -o gvcgo -p github, g g ws c owner/name",
+		Run: func(cmd *cobra.Command, args []string) {
+			fPath, _ := cmd.Flags().GetString(fileName)
+			org, _ := cmd.Flags().GetString(orgName)
+			platform, _ := cmd.Flags().GetString(platformName)
+			useSSH, _ := cmd.Flags().GetBool(sshName)
+			if fPath == "" && org == "" && len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			repos := []*git.RepoURL{}
+			for _, arg := range args {
+				r, err := git.ParseRepoURL(arg, useSSH)
+				if err != nil {
+					gprint.PrintError("%+v", err)
+					return
+				}
+				repos = append(repos, r)
+			}
+			if fPath != "" {
+				rList, err := git.ReadRepoList(fPath, useSSH)
+				if err != nil {
+					gprint.PrintError("%+v", err)
+					return
+				}
+				repos = append(repos, rList...)
+			}
+			if org != "" {
+				rList, err := git.ListOrgRepos(platform, org, useSSH)
+				if err != nil {
+					gprint.PrintError("%+v", err)
+					return
+				}
+				repos = append(repos, rList...)
+			}
+			getWorkspace(cmd).Clone(repos)
+		},
+	}
+	clone.Flags().StringP(fileName, "f", "", "File containing repo urls, one per line.")
+	clone.Flags().StringP(orgName, "o", "", "Clones all repos of an organization or a user.")
+	clone.Flags().StringP(platformName, "p", git.WorkspacePlatformGithub, "Platform of the organization, github or gitee.")
+	clone.Flags().BoolP(sshName, "s", false, "Clones with ssh urls.")
+	clone.RegisterFlagCompletionFunc(platformName, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{git.WorkspacePlatformGithub, git.WorkspacePlatformGitee}, cobra.ShellCompDirectiveNoFileComp
+	})
+	workspace.AddCommand(clone)
+
+	workspace.AddCommand(&cobra.Command{
+		Use:     "status",
+		Aliases: []string{"st"},
+		Short:   "Shows branch, dirty files and ahead/behind of all repos.",
+		Run: func(cmd *cobra.Command, args []string) {
+			getWorkspace(cmd).Status()
+		},
+	})
+
+	workspace.AddCommand(&cobra.Command{
+		Use:     "pull",
+		Aliases: []string{"pl"},
+		Short:   "Pulls all repos in parallel, fast-forward only.",
+		Run: func(cmd *cobra.Command, args []string) {
+			getWorkspace(cmd).Pull()
+		},
+	})
+
+	workspace.AddCommand(&cobra.Command{
+		Use:     "fetch",
+		Aliases: []string{"f"},
+		Short:   "Fetches all remotes of all repos in parallel.",
+		Run: func(cmd *cobra.Command, args []string) {
+			getWorkspace(cmd).Fetch()
+		},
+	})
+
+	workspace.AddCommand(&cobra.Command{
+		Use:     "exec",
+		Aliases: []string{"e"},
+		Short:   "Executes a command in each repo.",
+		Long:    "Example: g g ws e -- git log -1 --oneline\nArgs are not passed to a shell, use \"sh -c '...'\" for pipes.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			getWorkspace(cmd).Exec(args...)
+		},
+	})
+	return workspace
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/gvc/pkg/plugin"
+	"github.com/spf13/cobra"
+)
+
+const (
+	PluginGroupID string = "plugin"
+)
+
+func RegisterPlugin(cli *Cli) {
+	parent := &cobra.Command{
+		Use:     "plugin",
+		Aliases: []string{"pl"},
+		Short:   "Manages third-party plugins(g-<name> executables).",
+		GroupID: cli.groupID,
+	}
+
+	install := &cobra.Command{
+		Use:     "install",
+		Aliases: []string{"i"},
+		Short:   "Installs a plugin with go install.",
+		Long:    "Example: g pl i github.com/xxx/g-hello@latest",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			for _, pkgPath := range args {
+				if err := plugin.Install(pkgPath); err != nil {
+					gprint.PrintError("%+v", err)
+				}
+			}
+		},
+	}
+	parent.AddCommand(install)
+
+	list := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l"},
+		Short:   "Shows installed plugins.",
+		Run: func(cmd *cobra.Command, args []string) {
+			plugin.ShowPlugins()
+		},
+	}
+	parent.AddCommand(list)
+
+	remove := &cobra.Command{
+		Use:     "remove",
+		Aliases: []string{"r"},
+		Short:   "Removes a plugin installed by gvc.",
+		Long:    "Example: g pl r <plugin-name>",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			for _, name := range args {
+				if err := plugin.Remove(name); err != nil {
+					gprint.PrintError("%+v", err)
+				}
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			names := []string{}
+			for _, p := range plugin.Discover() {
+				if p.IsManaged() {
+					names = append(names, p.Name)
+				}
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	parent.AddCommand(remove)
+
+	cli.rootCmd.AddCommand(parent)
+
+	// Plugins must not shadow builtin commands.
+	registerPluginCommands(cli)
+}
+
+func registerPluginCommands(cli *Cli) {
+	pList := plugin.Discover()
+	if len(pList) == 0 {
+		return
+	}
+	cli.rootCmd.AddGroup(&cobra.Group{ID: PluginGroupID, Title: "Plugins: "})
+	for _, p := range pList {
+		if c, _, err := cli.rootCmd.Find([]string{p.Name}); err == nil && c != cli.rootCmd {
+			continue
+		}
+		pl := p
+		cli.rootCmd.AddCommand(&cobra.Command{
+			Use:                pl.Name,
+			Short:              "Plugin: " + pl.Path,
+			GroupID:            PluginGroupID,
+			DisableFlagParsing: true,
+			Run: func(cmd *cobra.Command, args []string) {
+				if code := pl.Run(args...); code != 0 {
+					os.Exit(code)
+				}
+			},
+		})
+	}
+}
@@ -29,15 +29,23 @@ func GetConfPath() string {
 }
 
 type GVConfig struct {
-	GitUserName   string `json:"git_username"`
-	GitToken      string `json:"git_token"`
-	GiteeUserName string `json:"gitee_username"`
-	GiteeToken    string `json:"gitee_token"`
-	Password      string `json:"password"`
-	PicRepo       string `json:"pic_repo"`
-	BackupRepo    string `json:"backup_repo"`
-	LocalProxy    string `json:"local_proxy"`
-	ReverseProxy  string `json:"reverse_proxy"`
+	GitUserName       string            `json:"git_username"`
+	GitToken          string            `json:"git_token"`
+	GiteeUserName     string            `json:"gitee_username"`
+	GiteeToken        string            `json:"gitee_token"`
+	Password          string            `json:"password"`
+	PicRepo           string            `json:"pic_repo"`
+	BackupRepo        string            `json:"backup_repo"`
+	LocalProxy        string            `json:"local_proxy"`
+	ReverseProxy      string            `json:"reverse_proxy"`
+	HostsSources      []string          `json:"hosts_sources"`
+	HostsInclude      []string          `json:"hosts_include"`
+	HostsExclude      []string          `json:"hosts_exclude"`
+	SSHProxyHosts     []string          `json:"ssh_proxy_hosts"`
+	SSHIdentities     map[string]string `json:"ssh_identities"`
+	RedactRules       map[string]string `json:"redact_rules"`
+	RedactReplacement string            `json:"redact_replacement"`
+	AsciinemaServer   string            `json:"asciinema_server"`
 }
 
 func NewGVConfig() *GVConfig {
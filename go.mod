@@ -3,16 +3,24 @@ module github.com/gvcgo/gvc
 go 1.22.1
 
 require (
+	github.com/charmbracelet/bubbletea v0.24.2
+	github.com/charmbracelet/lipgloss v0.8.0
+	github.com/creack/pty v1.1.15
 	github.com/gogf/gf/v2 v2.6.1
 	github.com/gvcgo/asciinema v0.3.8
 	github.com/gvcgo/asciinema-edit v0.0.1
 	github.com/gvcgo/gogpt v0.2.7
 	github.com/gvcgo/goutils v0.8.9
 	github.com/hhatto/gocloc v0.5.2
+	github.com/mattn/go-runewidth v0.0.15
 	github.com/moond4rk/hackbrowserdata v0.4.5
 	github.com/pkg/errors v0.9.1
 	github.com/postfinance/single v0.0.2
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/crypto v0.18.0
+	golang.org/x/image v0.15.0
+	golang.org/x/net v0.20.0
+	golang.org/x/term v0.16.0
 )
 
 require (
@@ -28,13 +36,10 @@ require (
 	github.com/bodgit/sevenzip v1.4.2 // indirect
 	github.com/bodgit/windows v1.0.1 // indirect
 	github.com/charmbracelet/bubbles v0.16.1 // indirect
-	github.com/charmbracelet/bubbletea v0.24.2 // indirect
 	github.com/charmbracelet/glamour v0.6.0 // indirect
 	github.com/charmbracelet/harmonica v0.2.0 // indirect
-	github.com/charmbracelet/lipgloss v0.8.0 // indirect
 	github.com/clbanning/mxj/v2 v2.7.0 // indirect
 	github.com/containerd/console v1.0.4-0.20230313162750-1ae8d489ac81 // indirect
-	github.com/creack/pty v1.1.15 // indirect
 	github.com/creack/termios v0.0.0-20160714173321-88d0029e36a1 // indirect
 	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/dsnet/compress v0.0.2-0.20210315054119-f66993602bf5 // indirect
@@ -65,7 +70,6 @@ require (
 	github.com/magiconair/properties v1.8.6 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-localereader v0.0.1 // indirect
-	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/mattn/go-sqlite3 v1.14.19 // indirect
 	github.com/mholt/archiver/v3 v3.5.1 // indirect
 	github.com/microcosm-cc/bluemonday v1.0.21 // indirect
@@ -100,12 +104,9 @@ require (
 	go.opentelemetry.io/otel v1.15.1 // indirect
 	go.opentelemetry.io/otel/trace v1.15.1 // indirect
 	go4.org v0.0.0-20230225012048-214862532bf5 // indirect
-	golang.org/x/crypto v0.18.0 // indirect
 	golang.org/x/exp v0.0.0-20240103183307-be819d1f06fc // indirect
-	golang.org/x/net v0.20.0 // indirect
 	golang.org/x/sync v0.3.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/term v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/gcfg.v1 v1.2.3 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
@@ -0,0 +1,126 @@
+package asciinema
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+)
+
+/*
+Encodes frames to an animated PNG.
+
+Frames are compressed by image/png, then IDAT chunks are moved into
+fdAT chunks of the animation, see https://wiki.mozilla.org/APNG_Specification.
+*/
+type apngFrame struct {
+	rect     image.Rectangle
+	delayNum uint16
+	delayDen uint16
+	data     [][]byte
+}
+
+type ApngEncoder struct {
+	w       io.Writer
+	ihdr    []byte
+	frames  []*apngFrame
+	elapsed int // milliseconds
+}
+
+func NewApngEncoder(w io.Writer) *ApngEncoder {
+	return &ApngEncoder{w: w}
+}
+
+// Splits a png file into chunks.
+func pngChunks(content []byte) (chunks map[string][][]byte, err error) {
+	if len(content) < 8 {
+		return nil, fmt.Errorf("invalid png")
+	}
+	chunks = map[string][][]byte{}
+	for rest := content[8:]; len(rest) >= 12; {
+		size := int(binary.BigEndian.Uint32(rest))
+		if len(rest) < size+12 {
+			return nil, fmt.Errorf("invalid png chunk")
+		}
+		name := string(rest[4:8])
+		chunks[name] = append(chunks[name], rest[8:8+size])
+		rest = rest[size+12:]
+	}
+	return
+}
+
+func (e *ApngEncoder) Encode(f *Frame) (err error) {
+	buf := &bytes.Buffer{}
+	if err = png.Encode(buf, f.Image.SubImage(f.Rect)); err != nil {
+		return
+	}
+	chunks, err := pngChunks(buf.Bytes())
+	if err != nil {
+		return
+	}
+	if e.ihdr == nil {
+		e.ihdr = chunks["IHDR"][0]
+	}
+	end := int(math.Round((f.Time + f.Duration) * 1000))
+	delay := max(end-e.elapsed, 1)
+	e.elapsed += delay
+	frame := &apngFrame{rect: f.Rect, delayNum: uint16(delay), delayDen: 1000, data: chunks["IDAT"]}
+	if delay > math.MaxUint16 {
+		frame.delayNum, frame.delayDen = uint16(min(delay/10, math.MaxUint16)), 100
+	}
+	e.frames = append(e.frames, frame)
+	return
+}
+
+func writePngChunk(w io.Writer, name string, data []byte) error {
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	header = append(header, name...)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	content := append(header, data...)
+	content = binary.BigEndian.AppendUint32(content, crc.Sum32())
+	_, err := w.Write(content)
+	return err
+}
+
+func (e *ApngEncoder) Close() (err error) {
+	if len(e.frames) == 0 {
+		return fmt.Errorf("no frames")
+	}
+	if _, err = e.w.Write([]byte("\x89PNG\r\n\x1a\n")); err != nil {
+		return
+	}
+	writePngChunk(e.w, "IHDR", e.ihdr)
+	actl := binary.BigEndian.AppendUint32(nil, uint32(len(e.frames)))
+	actl = binary.BigEndian.AppendUint32(actl, 0) // plays forever.
+	writePngChunk(e.w, "acTL", actl)
+	var seq uint32
+	for i, frame := range e.frames {
+		fctl := binary.BigEndian.AppendUint32(nil, seq)
+		for _, v := range []int{frame.rect.Dx(), frame.rect.Dy(), frame.rect.Min.X, frame.rect.Min.Y} {
+			fctl = binary.BigEndian.AppendUint32(fctl, uint32(v))
+		}
+		fctl = binary.BigEndian.AppendUint16(fctl, frame.delayNum)
+		fctl = binary.BigEndian.AppendUint16(fctl, frame.delayDen)
+		fctl = append(fctl, 0, 0) // APNG_DISPOSE_OP_NONE, APNG_BLEND_OP_SOURCE
+		writePngChunk(e.w, "fcTL", fctl)
+		seq++
+		for _, data := range frame.data {
+			if i == 0 {
+				err = writePngChunk(e.w, "IDAT", data)
+			} else {
+				err = writePngChunk(e.w, "fdAT", append(binary.BigEndian.AppendUint32(nil, seq), data...))
+				seq++
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	return writePngChunk(e.w, "IEND", nil)
+}
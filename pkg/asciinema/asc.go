@@ -3,18 +3,13 @@ package asciinema
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/gvcgo/asciinema-edit/cast"
-	"github.com/gvcgo/asciinema-edit/commands/transformer"
-	"github.com/gvcgo/asciinema-edit/editor"
 	acmd "github.com/gvcgo/asciinema/cmd"
 	autil "github.com/gvcgo/asciinema/util"
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/gutils"
 	"github.com/gvcgo/gvc/conf"
 )
 
@@ -59,35 +54,28 @@ func NewAsciinema() *Asciinema {
 	return a
 }
 
-// Authorization to asciinema.org
+/*
+Authorization to asciinema.org or the configured server.
+The url is printed for opening in another device if there is no browser.
+*/
 func (a *Asciinema) Auth() error {
-	authUrl, info := a.cmd.Auth()
-	gprint.PrintInfo(info)
-	var cmd *exec.Cmd
-	if runtime.GOOS == gutils.Darwin {
-		cmd = exec.Command("open", authUrl)
-	} else if runtime.GOOS == gutils.Linux {
-		cmd = exec.Command("x-www-browser", authUrl)
-	} else if runtime.GOOS == gutils.Windows {
-		cmd = exec.Command("cmd", "/c", "start", authUrl)
-	} else {
-		return fmt.Errorf("unsupported os")
-	}
-
-	if err := cmd.Run(); err != nil {
+	client, err := NewAsciinemaClient()
+	if err != nil {
 		return err
 	}
+	authUrl := client.AuthURL()
+	gprint.PrintInfo(`Open the following URL in a web browser to link your install ID with your %s user account:
+%s
+This will associate all recordings uploaded from this machine (past and future ones) to your account.`, client.Server, authUrl)
+	if err := openBrowser(authUrl); err != nil {
+		gprint.PrintWarning("Cannot open a browser (%v), please open the URL above manually.", err)
+	}
 	return nil
 }
 
 // Records an asciinema cast.
 func (a *Asciinema) Record(fPath string) error {
-	a.cmd.Title, a.cmd.FilePath = handleFilePath(fPath)
-	err := a.cmd.Rec()
-	if err == nil {
-		FixCast(a.cmd.FilePath)
-	}
-	return err
+	return a.RecordWithOptions(fPath, nil)
 }
 
 // Plays an asciinema cast.
@@ -96,67 +84,82 @@ func (a *Asciinema) Play(fPath string) error {
 	return a.cmd.Play()
 }
 
-// Uploads an asciinema cast to asciinema.org.
+// Uploads an asciinema cast to asciinema.org or the configured server.
 func (a *Asciinema) Upload(fPath string) error {
-	a.cmd.Title, a.cmd.FilePath = handleFilePath(fPath)
-	if respStr, err := a.cmd.Upload(); err == nil {
-		gprint.PrintInfo(respStr)
-		return err
-	}
-	return nil
+	_, fPath = handleFilePath(fPath)
+	_, err := UploadCast(fPath, false)
+	return err
+}
+
+// Uploads a redacted copy of the cast, the cast itself is not changed.
+func (a *Asciinema) UploadRedacted(fPath string) error {
+	_, fPath = handleFilePath(fPath)
+	_, err := UploadCast(fPath, true)
+	return err
 }
 
 // Cut: Removes a certain range of time frames.
 type cutTransformation struct {
-	from float64
-	to   float64
+	from TimeBound
+	to   TimeBound
 }
 
 func (t *cutTransformation) Transform(c *cast.Cast) (err error) {
-	err = editor.Cut(c, t.from, t.to)
+	from, to, err := resolveRange(c, t.from, t.to)
+	if err != nil {
+		return
+	}
+	first, last, err := eventRange(c.EventStream, from, to)
+	if err != nil {
+		return
+	}
+	cutEvents(c, first, last)
 	return
 }
 
-func (a *Asciinema) Cut(inFilePath, outFilePath string, start, end float64) error {
+// Start and end are seconds or marker names.
+func (a *Asciinema) Cut(inFilePath, outFilePath string, start, end TimeBound) error {
 	transformation := &cutTransformation{
 		from: start,
 		to:   end,
 	}
-	t, err := transformer.New(transformation, inFilePath, outFilePath)
-	if err != nil {
-		return err
-	}
-	defer t.Close()
-	return t.Transform()
+	return transformFile(transformation, inFilePath, outFilePath)
 }
 
 // Speed: Updates the cast speed by a certain factor.
 type speedTransformation struct {
-	from   float64
-	to     float64
+	from   TimeBound
+	to     TimeBound
 	factor float64
 }
 
 func (t *speedTransformation) Transform(c *cast.Cast) (err error) {
-	if t.from == 0 && t.to == 0 {
-		t.from = c.EventStream[0].Time
-		t.to = c.EventStream[len(c.EventStream)-1].Time
+	var from, to float64
+	if t.from == "" && t.to == "" {
+		from = c.EventStream[0].Time
+		to = c.EventStream[len(c.EventStream)-1].Time
+	} else if from, to, err = resolveRange(c, t.from, t.to); err != nil {
+		return
 	}
-
-	err = editor.Speed(c, t.factor, t.from, t.to)
+	if t.factor > 10 || t.factor < 0.1 {
+		return fmt.Errorf("factor must be within 0.1 and 10 range")
+	}
+	if to <= from {
+		return fmt.Errorf("end (%gs) must be after start (%gs)", to, from)
+	}
+	first, last, err := eventRange(c.EventStream, from, to)
+	if err != nil {
+		return
+	}
+	speedEvents(c, t.factor, first, last)
 	return
 }
 
-func (a *Asciinema) Speed(inFilePath, outFilePath string, factor, start, end float64) error {
+func (a *Asciinema) Speed(inFilePath, outFilePath string, factor float64, start, end TimeBound) error {
 	transformation := &speedTransformation{
 		factor: factor,
 		from:   start,
 		to:     end,
 	}
-	t, err := transformer.New(transformation, inFilePath, outFilePath)
-	if err != nil {
-		return err
-	}
-	defer t.Close()
-	return t.Transform()
+	return transformFile(transformation, inFilePath, outFilePath)
 }
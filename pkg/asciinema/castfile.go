@@ -0,0 +1,74 @@
+package asciinema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+)
+
+/*
+Loads a cast file.
+
+Unlike cast.Decode, unknown header fields like extra env names are ignored,
+and events of any type are kept, e.g. "r" for resizing and "m" for markers.
+Casts of v1 and v3 are converted to v2.
+*/
+func LoadCast(fPath string) (c *cast.Cast, err error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	c = &cast.Cast{EventStream: []*cast.Event{}}
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if lineNum == 1 {
+			err = json.Unmarshal([]byte(line), &c.Header)
+			if err != nil || c.Header.Version != CastV2 {
+				return loadOtherVersion(fPath, err)
+			}
+			continue
+		}
+		event := []interface{}{}
+		if json.Unmarshal([]byte(line), &event) != nil || len(event) != 3 {
+			return nil, fmt.Errorf("line %d: invalid event", lineNum)
+		}
+		t, ok1 := event[0].(float64)
+		eType, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, fmt.Errorf("line %d: invalid event", lineNum)
+		}
+		c.EventStream = append(c.EventStream, &cast.Event{Time: t, Type: eType, Data: data})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lineNum == 0 {
+		return nil, fmt.Errorf("empty cast file: %s", fPath)
+	}
+	return
+}
+
+// headerErr is the error of parsing the first line as a v2 header.
+func loadOtherVersion(fPath string, headerErr error) (c *cast.Cast, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return
+	}
+	if c, _, err = decodeCastContent(content); err != nil && headerErr != nil {
+		err = fmt.Errorf("invalid cast header: %w", headerErr)
+	}
+	return
+}
@@ -0,0 +1,244 @@
+package asciinema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Conversions between asciicast v1, v2 and v3.
+
+v1 is a single json object with delays of output in stdout,
+v3 has the terminal size in term, and intervals instead of absolute times in events.
+Casts of any version are loaded into cast.Cast with absolute times, like v2.
+*/
+const (
+	CastV1 = 1
+	CastV2 = 2
+	CastV3 = 3
+)
+
+// asciicast v1, a single json object with all output in stdout.
+type castV1 struct {
+	Version  int               `json:"version"`
+	Width    int               `json:"width"`
+	Height   int               `json:"height"`
+	Duration float64           `json:"duration"`
+	Command  string            `json:"command,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Stdout   [][]interface{}   `json:"stdout"`
+}
+
+func parseCastV1(content []byte) (c *castV1, ok bool) {
+	c = &castV1{}
+	if json.Unmarshal(content, c) != nil || c.Version != 1 {
+		return nil, false
+	}
+	return c, true
+}
+
+// Delays of v1 are turned into absolute times.
+func (c *castV1) toCast() *cast.Cast {
+	result := &cast.Cast{EventStream: []*cast.Event{}}
+	result.Header.Version = CastV2
+	result.Header.Width, result.Header.Height = uint(c.Width), uint(c.Height)
+	result.Header.Command, result.Header.Title = c.Command, c.Title
+	result.Header.Env.Shell, result.Header.Env.Term = c.Env["SHELL"], c.Env["TERM"]
+	t := 0.0
+	for _, frame := range c.Stdout {
+		if len(frame) != 2 {
+			continue
+		}
+		delay, ok1 := frame[0].(float64)
+		data, ok2 := frame[1].(string)
+		if ok1 && ok2 {
+			t += max(delay, 0)
+			result.EventStream = append(result.EventStream, &cast.Event{Time: roundTime(t), Type: "o", Data: data})
+		}
+	}
+	return result
+}
+
+type castV3Theme struct {
+	Fg      string `json:"fg,omitempty"`
+	Bg      string `json:"bg,omitempty"`
+	Palette string `json:"palette,omitempty"`
+}
+
+type castV3Header struct {
+	Version int `json:"version"`
+	Term    struct {
+		Cols  int          `json:"cols"`
+		Rows  int          `json:"rows"`
+		Type  string       `json:"type,omitempty"`
+		Theme *castV3Theme `json:"theme,omitempty"`
+	} `json:"term"`
+	Timestamp     uint              `json:"timestamp,omitempty"`
+	IdleTimeLimit float64           `json:"idle_time_limit,omitempty"`
+	Command       string            `json:"command,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// Lines starting with # are comments in v3, the header is required.
+func parseCastV3(content []byte) (c *cast.Cast, err error) {
+	c = &cast.Cast{EventStream: []*cast.Event{}}
+	header := &castV3Header{}
+	t := 0.0
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if header.Version == 0 {
+			if err = json.Unmarshal([]byte(line), header); err != nil || header.Version != CastV3 {
+				return nil, fmt.Errorf("invalid asciicast v3 header")
+			}
+			continue
+		}
+		event := []interface{}{}
+		if json.Unmarshal([]byte(line), &event) != nil || len(event) != 3 {
+			return nil, fmt.Errorf("line %d: invalid event", i+1)
+		}
+		interval, ok1 := event[0].(float64)
+		eType, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, fmt.Errorf("line %d: invalid event", i+1)
+		}
+		t += max(interval, 0)
+		c.EventStream = append(c.EventStream, &cast.Event{Time: roundTime(t), Type: eType, Data: data})
+	}
+	if header.Version == 0 {
+		return nil, fmt.Errorf("no asciicast v3 header")
+	}
+	h := &c.Header
+	h.Version = CastV2
+	h.Width, h.Height = uint(header.Term.Cols), uint(header.Term.Rows)
+	h.Timestamp, h.IdleTimeLimit = header.Timestamp, header.IdleTimeLimit
+	h.Command, h.Title = header.Command, header.Title
+	h.Env.Shell, h.Env.Term = header.Env["SHELL"], header.Env["TERM"]
+	if h.Env.Term == "" {
+		h.Env.Term = header.Term.Type
+	}
+	if theme := header.Term.Theme; theme != nil {
+		h.Theme.Fg, h.Theme.Bg, h.Theme.Palette = theme.Fg, theme.Bg, theme.Palette
+	}
+	return
+}
+
+// Loads a cast of v1 or v3 from its content.
+func decodeCastContent(content []byte) (c *cast.Cast, version int, err error) {
+	if v1, ok := parseCastV1(content); ok {
+		return v1.toCast(), CastV1, nil
+	}
+	if c, err = parseCastV3(content); err != nil {
+		return nil, 0, fmt.Errorf("unsupported cast, only asciicast v1, v2 and v3 are supported")
+	}
+	return c, CastV3, nil
+}
+
+func writeCastV1(c *cast.Cast, w io.Writer) error {
+	v1 := &castV1{
+		Version:  CastV1,
+		Width:    int(c.Header.Width),
+		Height:   int(c.Header.Height),
+		Duration: roundTime(castEnd(c)),
+		Command:  c.Header.Command,
+		Title:    c.Header.Title,
+		Env:      map[string]string{"SHELL": c.Header.Env.Shell, "TERM": c.Header.Env.Term},
+		Stdout:   [][]interface{}{},
+	}
+	last := 0.0
+	for _, ev := range c.EventStream {
+		if ev.Type == "o" {
+			v1.Stdout = append(v1.Stdout, []interface{}{roundTime(ev.Time - last), ev.Data})
+			last = ev.Time
+		}
+	}
+	_, err := fmt.Fprintln(w, marshalJSON(v1))
+	return err
+}
+
+func writeCastV3(c *cast.Cast, w io.Writer) (err error) {
+	header := &castV3Header{
+		Version:       CastV3,
+		Timestamp:     c.Header.Timestamp,
+		IdleTimeLimit: c.Header.IdleTimeLimit,
+		Command:       c.Header.Command,
+		Title:         c.Header.Title,
+	}
+	header.Term.Cols, header.Term.Rows = int(c.Header.Width), int(c.Header.Height)
+	header.Term.Type = c.Header.Env.Term
+	if t := c.Header.Theme; t.Fg != "" && t.Bg != "" {
+		header.Term.Theme = &castV3Theme{Fg: t.Fg, Bg: t.Bg, Palette: t.Palette}
+	}
+	if c.Header.Env.Shell != "" {
+		header.Env = map[string]string{"SHELL": c.Header.Env.Shell}
+	}
+	if _, err = fmt.Fprintln(w, marshalJSON(header)); err != nil {
+		return
+	}
+	last := 0.0
+	for _, ev := range c.EventStream {
+		if _, err = fmt.Fprintln(w, marshalJSON([]interface{}{roundTime(ev.Time - last), ev.Type, ev.Data})); err != nil {
+			return
+		}
+		last = ev.Time
+	}
+	return
+}
+
+func EncodeCast(c *cast.Cast, w io.Writer, version int) error {
+	switch version {
+	case CastV1:
+		return writeCastV1(c, w)
+	case CastV2:
+		c.Header.Version = CastV2
+		return cast.Encode(w, c)
+	case CastV3:
+		return writeCastV3(c, w)
+	default:
+		return fmt.Errorf("unsupported asciicast version: %d", version)
+	}
+}
+
+// Converts a cast to asciicast v1, v2 or v3, v1 keeps output events only.
+func ConvertCastVersion(inFilePath, outFilePath string, version int) (err error) {
+	c, err := LoadCast(inFilePath)
+	if err != nil {
+		return
+	}
+	if version == CastV1 {
+		dropped := 0
+		for _, ev := range c.EventStream {
+			if ev.Type != "o" {
+				dropped++
+			}
+		}
+		if dropped > 0 {
+			gprint.PrintWarning("%d input, marker and resize events are dropped, v1 keeps output only.", dropped)
+		}
+	}
+	f, err := os.Create(outFilePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err = EncodeCast(c, w, version); err != nil {
+		return
+	}
+	if err = w.Flush(); err == nil {
+		gprint.PrintSuccess("Converted to asciicast v%d: %s", version, outFilePath)
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package asciinema
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+)
+
+func newTestCast() *cast.Cast {
+	c := &cast.Cast{EventStream: []*cast.Event{
+		{Time: 0.5, Type: "o", Data: "$ "},
+		{Time: 1.25, Type: "i", Data: "ls\r"},
+		{Time: 1.3, Type: "o", Data: "ls\r\n\x1b[1;34mdir\x1b[0m  <file> & \"quoted\"\r\n"},
+		{Time: 2.125, Type: "m", Data: "listed"},
+		{Time: 2.5, Type: "r", Data: "100x30"},
+		{Time: 3.000001, Type: "o", Data: "你好\r\n"},
+	}}
+	h := &c.Header
+	h.Version = CastV2
+	h.Width, h.Height = 80, 24
+	h.Timestamp, h.IdleTimeLimit = 1700000000, 2
+	h.Command, h.Title = "bash -l", "round trip"
+	h.Env.Shell, h.Env.Term = "/bin/bash", "xterm-256color"
+	h.Theme.Fg, h.Theme.Bg, h.Theme.Palette = "#ffffff", "#000000", "#000000:#ff0000"
+	return c
+}
+
+func eventsOf(c *cast.Cast, types string) (events []cast.Event) {
+	for _, ev := range c.EventStream {
+		if strings.Contains(types, ev.Type) {
+			events = append(events, *ev)
+		}
+	}
+	return
+}
+
+func TestCastRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		version int
+		// event types kept by the version.
+		types string
+		// header fields that can not be kept by v1.
+		noMeta bool
+	}{
+		{CastV1, "o", true},
+		{CastV2, "oimr", false},
+		{CastV3, "oimr", false},
+	}
+	for _, tt := range tests {
+		want := newTestCast()
+		buf := &bytes.Buffer{}
+		if err := EncodeCast(newTestCast(), buf, tt.version); err != nil {
+			t.Fatalf("v%d: %v", tt.version, err)
+		}
+
+		// decoded by LoadCast, like all editing commands do.
+		fPath := filepath.Join(dir, "encoded.cast")
+		os.WriteFile(fPath, buf.Bytes(), 0o644)
+		got, err := LoadCast(fPath)
+		if err != nil {
+			t.Fatalf("v%d: %v\n%s", tt.version, err, buf)
+		}
+		header := struct {
+			Version int `json:"version"`
+		}{}
+		firstLine, _, _ := strings.Cut(buf.String(), "\n")
+		if json.Unmarshal([]byte(firstLine), &header); header.Version != tt.version {
+			t.Errorf("v%d: encoded as v%d", tt.version, header.Version)
+		}
+		if got.Header.Version != CastV2 {
+			t.Errorf("v%d: loaded header version = %d", tt.version, got.Header.Version)
+		}
+		if !reflect.DeepEqual(eventsOf(got, "oimr"), eventsOf(want, tt.types)) {
+			t.Errorf("v%d: events = %+v, want %+v", tt.version, eventsOf(got, "oimr"), eventsOf(want, tt.types))
+		}
+
+		g, w := got.Header, want.Header
+		if g.Width != w.Width || g.Height != w.Height || g.Title != w.Title || g.Command != w.Command {
+			t.Errorf("v%d: header = %+v", tt.version, g)
+		}
+		if g.Env.Shell != w.Env.Shell || g.Env.Term != w.Env.Term {
+			t.Errorf("v%d: env = %+v", tt.version, g.Env)
+		}
+		if !tt.noMeta && (g.Timestamp != w.Timestamp || g.IdleTimeLimit != w.IdleTimeLimit || g.Theme != w.Theme) {
+			t.Errorf("v%d: header = %+v", tt.version, g)
+		}
+	}
+}
+
+func TestConvertCastVersion(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "v2.cast")
+	f, _ := os.Create(src)
+	EncodeCast(newTestCast(), f, CastV2)
+	f.Close()
+
+	// v2 -> v3 -> v2 keeps everything.
+	v3Path, v2Path := filepath.Join(dir, "v3.cast"), filepath.Join(dir, "back.cast")
+	if err := ConvertCastVersion(src, v3Path, CastV3); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertCastVersion(v3Path, v2Path, CastV2); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := LoadCast(src)
+	got, err := LoadCast(v2Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("v2 -> v3 -> v2:\n got %+v\nwant %+v", got, want)
+	}
+
+	// v3 -> v1 keeps output only, times are kept.
+	v1Path := filepath.Join(dir, "v1.cast")
+	if err := ConvertCastVersion(v3Path, v1Path, CastV1); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadCast(v1Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eventsOf(got, "oimr"), eventsOf(want, "o")) {
+		t.Errorf("v3 -> v1 events = %+v", eventsOf(got, "oimr"))
+	}
+
+	if err := ConvertCastVersion(src, filepath.Join(dir, "v4.cast"), 4); err == nil {
+		t.Error("v4 should not be supported")
+	}
+}
+
+func TestDecodeCastContentErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":         "",
+		"blank lines":   "\n  \n\n",
+		"comments only": "# recorded by gvc\n#\n",
+		"not json":      "hello\n",
+		"v2":            `{"version": 2, "width": 80, "height": 24}` + "\n" + `[0.1, "o", "x"]` + "\n",
+		"invalid event": `{"version": 3, "term": {"cols": 80, "rows": 24}}` + "\n" + `[0.1, "o"]` + "\n",
+		"event first":   "# comment\n" + `[0.1, "o", "x"]` + "\n",
+	}
+	for name, content := range tests {
+		if c, _, err := decodeCastContent([]byte(content)); err == nil {
+			t.Errorf("%s: expected an error, got %+v", name, c)
+		}
+	}
+
+	// comments and blank lines around a valid v3 cast are skipped.
+	content := "# recorded by gvc\n\n" + `{"version": 3, "term": {"cols": 80, "rows": 24}}` + "\n# a comment\n" + `[0.1, "o", "x"]` + "\n" + `[0.2, "o", "y"]` + "\n"
+	c, version, err := decodeCastContent([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != CastV3 || len(c.EventStream) != 2 || c.EventStream[1].Time != 0.3 {
+		t.Errorf("version %d, events %+v", version, c.EventStream)
+	}
+}
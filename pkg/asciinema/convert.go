@@ -1,32 +1,147 @@
 package asciinema
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/gvcgo/asciinema-edit/cast"
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/gutils"
 )
 
-func isAggInstalled() bool {
-	_, err := gutils.ExecuteSysCommand(true, "", "agg", "--help")
-	return err == nil
+/*
+Converts casts to animated images or SVG with the builtin renderer,
+to videos with ffmpeg, and to HTML pages with the SVG player.
+*/
+const (
+	FormatGif  = "gif"
+	FormatApng = "apng"
+	FormatWebp = "webp"
+	FormatSvg  = "svg"
+	FormatHtml = "html"
+	FormatPng  = "png" // static png of snapshots.
+)
+
+var formatExts = map[string][]string{
+	FormatGif:  {".gif"},
+	FormatApng: {".png", ".apng"},
+	FormatWebp: {".webp"},
+	FormatSvg:  {".svg"},
+	FormatMp4:  {".mp4"},
+	FormatWebm: {".webm"},
+	FormatHtml: {".html", ".htm"},
 }
 
-func (a *Asciinema) ConvertToGif(fPath, outFilePath string) (err error) {
-	if !isAggInstalled() {
-		gprint.PrintError("agg<https://github.com/asciinema/agg> is not installed.")
-		gprint.PrintInfo("Please use vm<https://github.com/gvcgo/version-manager> to install agg.")
+func ConvertFormats() []string {
+	return []string{FormatGif, FormatApng, FormatWebp, FormatSvg, FormatMp4, FormatWebm, FormatHtml}
+}
+
+// Format of the output file, extension is added when it does not match the format.
+func outputFormat(outFilePath, format string) (string, string, error) {
+	ext := strings.ToLower(filepath.Ext(outFilePath))
+	if format == "" {
+		format = FormatGif
+		for f, exts := range formatExts {
+			for _, e := range exts {
+				if e == ext {
+					format = f
+				}
+			}
+		}
+	}
+	exts, ok := formatExts[format]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported format: %s, available: %s", format, strings.Join(ConvertFormats(), ", "))
+	}
+	for _, e := range exts {
+		if e == ext {
+			return outFilePath, format, nil
+		}
+	}
+	return outFilePath + exts[0], format, nil
+}
+
+func newFrameEncoder(format string, w io.Writer) FrameEncoder {
+	switch format {
+	case FormatApng:
+		return NewApngEncoder(w)
+	case FormatWebp:
+		return NewWebpEncoder(w)
+	default:
+		return NewGifEncoder(w)
+	}
+}
+
+func encodeFrames(c *cast.Cast, opts *RenderOptions, enc FrameEncoder) (frames int, err error) {
+	err = RenderFrames(c, opts, func(frame *Frame) error {
+		frames++
+		return enc.Encode(frame)
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	return
+}
+
+// Renders a cast to an animated image, SVG, video or HTML page, returns path of the output file.
+func Convert(fPath, outFilePath string, opts *RenderOptions) (result string, err error) {
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+	result, format, err := outputFormat(outFilePath, opts.Format)
+	if err != nil {
 		return
 	}
-	if !strings.HasSuffix(outFilePath, ".gif") {
-		outFilePath += ".gif"
+	c, err := LoadCast(fPath)
+	if err != nil {
+		return
+	}
+	frames := 0
+	if isVideoFormat(format) {
+		// ffmpeg writes the output file itself.
+		var enc *VideoEncoder
+		if enc, err = NewVideoEncoder(format, result, opts); err != nil {
+			return
+		}
+		if frames, err = encodeFrames(c, opts, enc); err != nil {
+			os.Remove(result)
+			return
+		}
+	} else {
+		var f *os.File
+		if f, err = os.Create(result); err != nil {
+			return
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		if format == FormatSvg {
+			err = ExportSVG(c, opts, w)
+		} else if format == FormatHtml {
+			err = ExportHTML(c, opts, strings.TrimSuffix(filepath.Base(fPath), filepath.Ext(fPath)), w)
+		} else {
+			frames, err = encodeFrames(c, opts, newFrameEncoder(format, w))
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(result)
+			return
+		}
+	}
+	if frames > 0 {
+		gprint.PrintSuccess("%d frames rendered to %s", frames, result)
+	} else {
+		gprint.PrintSuccess("Rendered to %s", result)
 	}
-	homeDir, _ := os.UserHomeDir()
-	_, err = gutils.ExecuteSysCommand(false, homeDir,
-		"agg", fPath, outFilePath,
-	)
 	return
 }
 
-// TODO: upload converted file to github/gitee repo.
+func (a *Asciinema) ConvertToGif(fPath, outFilePath string) (err error) {
+	_, err = Convert(fPath, outFilePath, &RenderOptions{Format: FormatGif})
+	return
+}
@@ -0,0 +1,358 @@
+package asciinema
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/gvcgo/asciinema-edit/commands/transformer"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Edits casts with transformations.
+
+transformer.New decodes casts strictly and rejects markers and resize events,
+so casts are loaded by LoadCast before transformations are applied.
+*/
+func transformFile(t transformer.Transformation, inFilePath, outFilePath string) (err error) {
+	c, err := LoadCast(inFilePath)
+	if err != nil {
+		return
+	}
+	if len(c.EventStream) == 0 {
+		return fmt.Errorf("no events in %s", inFilePath)
+	}
+	sortEvents(c.EventStream)
+	if err = t.Transform(c); err != nil {
+		return fmt.Errorf("failed to transform cast: %w", err)
+	}
+	return SaveCast(c, outFilePath)
+}
+
+func sortEvents(events []*cast.Event) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time < events[j].Time })
+}
+
+// Saves a cast, events are sorted by time.
+func SaveCast(c *cast.Cast, fPath string) (err error) {
+	sortEvents(c.EventStream)
+	for _, ev := range c.EventStream {
+		ev.Time = roundTime(ev.Time)
+	}
+	f, err := os.Create(fPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err = cast.Encode(w, c); err != nil {
+		return
+	}
+	return w.Flush()
+}
+
+/*
+A time in seconds or a marker name, markers are "m" events of asciicast v2.
+*/
+type TimeBound string
+
+func (b TimeBound) Resolve(c *cast.Cast) (float64, error) {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return 0, nil
+	}
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		return t, nil
+	}
+	markers := []string{}
+	for _, ev := range c.EventStream {
+		if ev.Type == "m" {
+			if ev.Data == s {
+				return ev.Time, nil
+			}
+			markers = append(markers, ev.Data)
+		}
+	}
+	if len(markers) == 0 {
+		return 0, fmt.Errorf("marker %s not found, the cast has no markers", s)
+	}
+	return 0, fmt.Errorf("marker %s not found, available: %s", s, strings.Join(markers, ", "))
+}
+
+/*
+Index range of events between from and to, both included.
+
+editor.FindIndex misses bounds equal to the time of an event, which is always the case for markers,
+and takes a part of events of the same time, so ranges are found here, events must be sorted by time.
+*/
+func eventRange(events []*cast.Event, from, to float64) (first, last int, err error) {
+	first = sort.Search(len(events), func(i int) bool { return events[i].Time >= from })
+	last = sort.Search(len(events), func(i int) bool { return events[i].Time > to }) - 1
+	if first > last {
+		err = fmt.Errorf("no events between %gs and %gs", from, to)
+	}
+	return
+}
+
+// Removes events from first to last, events after them are moved to the time of the first removed one.
+func cutEvents(c *cast.Cast, first, last int) {
+	events := c.EventStream
+	if last+1 < len(events) {
+		delta := events[last+1].Time - events[first].Time
+		for _, ev := range events[last+1:] {
+			ev.Time -= delta
+		}
+	}
+	c.EventStream = append(events[:first:first], events[last+1:]...)
+}
+
+// Scales intervals between events from first to last by factor, events after them are shifted.
+func speedEvents(c *cast.Cast, factor float64, first, last int) {
+	events := c.EventStream
+	prev, t := events[first].Time, events[first].Time
+	for _, ev := range events[first+1 : last+1] {
+		t += (ev.Time - prev) * factor
+		prev, ev.Time = ev.Time, t
+	}
+	for _, ev := range events[last+1:] {
+		ev.Time += t - prev
+	}
+}
+
+// Resolves a range, to must not be before from.
+func resolveRange(c *cast.Cast, from, to TimeBound) (start, end float64, err error) {
+	if start, err = from.Resolve(c); err != nil {
+		return
+	}
+	if end, err = to.Resolve(c); err != nil {
+		return
+	}
+	if end < start {
+		err = fmt.Errorf("end (%s) must not be before start (%s)", to, from)
+	}
+	return
+}
+
+func castEnd(c *cast.Cast) float64 {
+	if len(c.EventStream) == 0 {
+		return 0
+	}
+	return c.EventStream[len(c.EventStream)-1].Time
+}
+
+func resizeEvent(t float64, cols, rows int) *cast.Event {
+	return &cast.Event{Time: t, Type: "r", Data: fmt.Sprintf("%dx%d", cols, rows)}
+}
+
+/*
+Header size is enlarged to fit all parts, so players ignoring resize events still show everything,
+and the original size is restored at the beginning by a resize event.
+*/
+func reconcileSize(c *cast.Cast, parts ...*cast.Cast) {
+	cols, rows := c.Header.Width, c.Header.Height
+	for _, p := range parts {
+		c.Header.Width = max(c.Header.Width, p.Header.Width)
+		c.Header.Height = max(c.Header.Height, p.Header.Height)
+	}
+	if c.Header.Width != cols || c.Header.Height != rows {
+		c.EventStream = append([]*cast.Event{resizeEvent(0, int(cols), int(rows))}, c.EventStream...)
+	}
+}
+
+// Shifts events of src by offset, resize events are added if its size differs from cols x rows.
+func shiftedEvents(src *cast.Cast, offset float64, cols, rows int) (events []*cast.Event) {
+	w, h := int(src.Header.Width), int(src.Header.Height)
+	if w != cols || h != rows {
+		events = append(events, resizeEvent(offset, w, h))
+	}
+	for _, ev := range src.EventStream {
+		events = append(events, &cast.Event{Time: ev.Time + offset, Type: ev.Type, Data: ev.Data})
+	}
+	return
+}
+
+// Size of the terminal at the end of a cast.
+func lastSize(c *cast.Cast) (cols, rows int) {
+	cols, rows = int(c.Header.Width), int(c.Header.Height)
+	for _, ev := range c.EventStream {
+		if ev.Type == "r" {
+			if w, h, ok := parseResize(ev.Data); ok {
+				cols, rows = w, h
+			}
+		}
+	}
+	return
+}
+
+// Concat: Appends casts one after another.
+type concatTransformation struct {
+	casts []*cast.Cast
+	gap   float64 // seconds between casts.
+}
+
+func (t *concatTransformation) Transform(c *cast.Cast) (err error) {
+	for _, next := range t.casts {
+		cols, rows := lastSize(c)
+		c.EventStream = append(c.EventStream, shiftedEvents(next, castEnd(c)+t.gap, cols, rows)...)
+	}
+	reconcileSize(c, t.casts...)
+	c.Header.Duration = 0
+	return
+}
+
+func loadCasts(fPaths []string) (casts []*cast.Cast, err error) {
+	for _, fPath := range fPaths {
+		var c *cast.Cast
+		if c, err = LoadCast(fPath); err != nil {
+			return nil, fmt.Errorf("%s: %w", fPath, err)
+		}
+		casts = append(casts, c)
+	}
+	return
+}
+
+func Concat(inFilePaths []string, outFilePath string, gap float64) (err error) {
+	if len(inFilePaths) < 2 {
+		return fmt.Errorf("at least two casts are required")
+	}
+	casts, err := loadCasts(inFilePaths[1:])
+	if err != nil {
+		return
+	}
+	if err = transformFile(&concatTransformation{casts: casts, gap: gap}, inFilePaths[0], outFilePath); err == nil {
+		gprint.PrintSuccess("%d casts concatenated to %s", len(inFilePaths), outFilePath)
+	}
+	return
+}
+
+// InsertPause: Delays events at or after a time.
+type insertPauseTransformation struct {
+	at       TimeBound
+	duration float64
+}
+
+func (t *insertPauseTransformation) Transform(c *cast.Cast) (err error) {
+	if t.duration <= 0 {
+		return fmt.Errorf("duration of pause must be positive")
+	}
+	at, err := t.at.Resolve(c)
+	if err != nil {
+		return
+	}
+	for _, ev := range c.EventStream {
+		if ev.Time >= at {
+			ev.Time += t.duration
+		}
+	}
+	return
+}
+
+func InsertPause(inFilePath, outFilePath string, at TimeBound, duration float64) error {
+	return transformFile(&insertPauseTransformation{at: at, duration: duration}, inFilePath, outFilePath)
+}
+
+/*
+Trim: Removes leading and trailing idle time.
+
+Events without visible text, like mode settings, are idle. Leading idle events
+are moved to 0 and the first visible event starts after keep seconds,
+trailing idle events are moved to keep seconds after the last visible event.
+*/
+type trimTransformation struct {
+	leading  bool
+	trailing bool
+	keep     float64
+}
+
+func isVisibleEvent(ev *cast.Event) bool {
+	return ev.Type == "o" && strings.TrimSpace(StripANSI(ev.Data)) != ""
+}
+
+func (t *trimTransformation) Transform(c *cast.Cast) (err error) {
+	first, last := -1, -1
+	for i, ev := range c.EventStream {
+		if isVisibleEvent(ev) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return fmt.Errorf("no visible output in the cast")
+	}
+	if t.leading {
+		if shift := c.EventStream[first].Time - t.keep; shift > 0 {
+			for i, ev := range c.EventStream {
+				if i < first {
+					ev.Time = math.Max(ev.Time-shift, 0)
+				} else {
+					ev.Time -= shift
+				}
+			}
+		}
+	}
+	if t.trailing {
+		end := c.EventStream[last].Time + t.keep
+		for _, ev := range c.EventStream[last+1:] {
+			ev.Time = math.Min(ev.Time, end)
+		}
+	}
+	c.Header.Duration = 0
+	return
+}
+
+func Trim(inFilePath, outFilePath string, leading, trailing bool, keep float64) error {
+	return transformFile(&trimTransformation{leading: leading, trailing: trailing, keep: math.Max(keep, 0)}, inFilePath, outFilePath)
+}
+
+/*
+Splice: Replaces a range of a cast with another cast,
+events after the range are shifted by the difference of durations.
+*/
+type spliceTransformation struct {
+	from   TimeBound
+	to     TimeBound
+	insert *cast.Cast
+}
+
+func (t *spliceTransformation) Transform(c *cast.Cast) (err error) {
+	from, to, err := resolveRange(c, t.from, t.to)
+	if err != nil {
+		return
+	}
+	delta := castEnd(t.insert) - (to - from)
+	before, after := []*cast.Event{}, []*cast.Event{}
+	for _, ev := range c.EventStream {
+		if ev.Time < from {
+			before = append(before, ev)
+		} else if ev.Time > to {
+			ev.Time += delta
+			after = append(after, ev)
+		}
+	}
+	cols, rows := lastSize(&cast.Cast{Header: c.Header, EventStream: before})
+	events := append(before, shiftedEvents(t.insert, from, cols, rows)...)
+	// size of the original cast is restored after the inserted one.
+	if w, h := lastSize(t.insert); w != cols || h != rows {
+		events = append(events, resizeEvent(from+castEnd(t.insert), cols, rows))
+	}
+	c.EventStream = append(events, after...)
+	reconcileSize(c, t.insert)
+	c.Header.Duration = 0
+	return
+}
+
+func Splice(inFilePath, outFilePath string, from, to TimeBound, insertFilePath string) (err error) {
+	insert, err := LoadCast(insertFilePath)
+	if err != nil {
+		return
+	}
+	return transformFile(&spliceTransformation{from: from, to: to, insert: insert}, inFilePath, outFilePath)
+}
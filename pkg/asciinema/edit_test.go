@@ -0,0 +1,281 @@
+package asciinema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+)
+
+// A cast of events written as "time type data".
+func castOf(cols, rows int, events ...string) *cast.Cast {
+	c := &cast.Cast{}
+	c.Header.Version = CastV2
+	c.Header.Width, c.Header.Height = uint(cols), uint(rows)
+	for _, e := range events {
+		var ev cast.Event
+		fmt.Sscanf(e, "%g %s %s", &ev.Time, &ev.Type, &ev.Data)
+		c.EventStream = append(c.EventStream, &ev)
+	}
+	return c
+}
+
+func eventList(c *cast.Cast) (events []string) {
+	for _, ev := range c.EventStream {
+		events = append(events, fmt.Sprintf("%g %s %s", roundTime(ev.Time), ev.Type, ev.Data))
+	}
+	return
+}
+
+func TestTimeBoundResolve(t *testing.T) {
+	c := newTestCast()
+	tests := []struct {
+		bound TimeBound
+		want  float64
+		err   string
+	}{
+		{"", 0, ""},
+		{" 1.5 ", 1.5, ""},
+		{"listed", 2.125, ""},
+		{"missing", 0, "available: listed"},
+	}
+	for _, tt := range tests {
+		got, err := tt.bound.Resolve(c)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: error %v, want %s", tt.bound, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: %v, %v, want %v", tt.bound, got, err, tt.want)
+		}
+	}
+	if _, err := TimeBound("start").Resolve(castOf(80, 24, "0 o a")); err == nil || !strings.Contains(err.Error(), "no markers") {
+		t.Errorf("marker of a cast without markers: %v", err)
+	}
+	if _, _, err := resolveRange(c, "3", "listed"); err == nil {
+		t.Error("end before start should fail")
+	}
+}
+
+func TestEventRange(t *testing.T) {
+	events := castOf(80, 24, "0 o a", "1 o b", "1 o c", "2 o d", "3 o e").EventStream
+	tests := []struct {
+		from, to    float64
+		first, last int
+	}{
+		{1, 1, 1, 2},
+		{0, 0, 0, 0},
+		{-1, 0.5, 0, 0},
+		{0.5, 2, 1, 3},
+		{2, 10, 3, 4},
+	}
+	for _, tt := range tests {
+		first, last, err := eventRange(events, tt.from, tt.to)
+		if err != nil || first != tt.first || last != tt.last {
+			t.Errorf("%g - %g: %d - %d, %v, want %d - %d", tt.from, tt.to, first, last, err, tt.first, tt.last)
+		}
+	}
+	if _, _, err := eventRange(events, 1.2, 1.8); err == nil {
+		t.Error("range without events should fail")
+	}
+}
+
+func TestCut(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []string
+		from, to TimeBound
+		want     []string
+	}{
+		{
+			name:   "markers",
+			events: []string{"0 o a", "1 m start", "1 o b", "2 o c", "3 m end", "4 o d"},
+			from:   "start", to: "end",
+			want: []string{"0 o a", "1 o d"},
+		},
+		{
+			name:   "first event",
+			events: []string{"0 o a", "0 o b", "1.5 o c"},
+			from:   "0", to: "0",
+			want: []string{"0 o c"},
+		},
+		{
+			name:   "same time",
+			events: []string{"0 o a", "1 o b", "1 o c", "2 o d"},
+			from:   "1", to: "1",
+			want: []string{"0 o a", "1 o d"},
+		},
+		{
+			name:   "to the end",
+			events: []string{"0 o a", "1 o b", "2 o c"},
+			from:   "0.5", to: "9",
+			want: []string{"0 o a"},
+		},
+	}
+	for _, tt := range tests {
+		c := castOf(80, 24, tt.events...)
+		if err := (&cutTransformation{from: tt.from, to: tt.to}).Transform(c); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := eventList(c); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if err := (&cutTransformation{from: "0.2", to: "0.8"}).Transform(castOf(80, 24, "0 o a", "1 o b")); err == nil {
+		t.Error("cut without events in range should fail")
+	}
+}
+
+func TestSpeed(t *testing.T) {
+	tests := []struct {
+		name     string
+		factor   float64
+		from, to TimeBound
+		want     []string
+	}{
+		{"range", 0.5, "1", "3", []string{"0 o a", "1 o b", "1 m m", "2 o d", "3 o e"}},
+		{"whole cast", 2, "", "", []string{"0 o a", "2 o b", "2 m m", "6 o d", "8 o e"}},
+		{"marker", 2, "", "m", []string{"0 o a", "2 o b", "2 m m", "4 o d", "5 o e"}},
+	}
+	for _, tt := range tests {
+		c := castOf(80, 24, "0 o a", "1 o b", "1 m m", "3 o d", "4 o e")
+		tr := &speedTransformation{factor: tt.factor, from: tt.from, to: tt.to}
+		if err := tr.Transform(c); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := eventList(c); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	for _, tr := range []*speedTransformation{{factor: 20}, {factor: 2, from: "1", to: "1"}} {
+		if err := tr.Transform(castOf(80, 24, "0 o a", "1 o b", "2 o c")); err == nil {
+			t.Errorf("%+v should fail", *tr)
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	c := castOf(80, 24, "0 o a", "1 o b")
+	next := castOf(100, 30, "0.5 o x")
+	last := castOf(80, 24, "0 o y")
+	if err := (&concatTransformation{casts: []*cast.Cast{next, last}, gap: 1}).Transform(c); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0 r 80x24", "0 o a", "1 o b", "2 r 100x30", "2.5 o x", "3.5 r 80x24", "3.5 o y"}
+	if got := eventList(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("events %q, want %q", got, want)
+	}
+	if c.Header.Width != 100 || c.Header.Height != 30 {
+		t.Errorf("size %dx%d, want 100x30", c.Header.Width, c.Header.Height)
+	}
+
+	// casts are read from and written to files.
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.cast"), filepath.Join(dir, "b.cast")}
+	for i, c := range []*cast.Cast{castOf(80, 24, "0 o a"), castOf(80, 24, "0.25 o b")} {
+		if err := SaveCast(c, paths[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "out.cast")
+	if err := Concat(paths, out, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadCast(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := eventList(got); !reflect.DeepEqual(events, []string{"0 o a", "0.75 o b"}) {
+		t.Errorf("concatenated file events %q", events)
+	}
+	if err := Concat(paths[:1], out, 0); err == nil {
+		t.Error("concat of one cast should fail")
+	}
+}
+
+func TestSplice(t *testing.T) {
+	tests := []struct {
+		name     string
+		insert   *cast.Cast
+		from, to TimeBound
+		want     []string
+	}{
+		{
+			name:   "same size",
+			insert: castOf(80, 24, "0 o x", "0.5 o y"),
+			from:   "1", to: "3",
+			want: []string{"0 o a", "1 o x", "1.5 o y", "2.5 o e"},
+		},
+		{
+			name:   "markers",
+			insert: castOf(80, 24, "0 o x"),
+			from:   "begin", to: "end",
+			want: []string{"0 o a", "1 o x", "2 o e"},
+		},
+		{
+			name:   "larger",
+			insert: castOf(100, 30, "0 o x", "0.5 o y"),
+			from:   "1", to: "3",
+			want: []string{"0 r 80x24", "0 o a", "1 r 100x30", "1 o x", "1.5 o y", "1.5 r 80x24", "2.5 o e"},
+		},
+	}
+	for _, tt := range tests {
+		c := castOf(80, 24, "0 o a", "1 m begin", "1 o b", "2 o c", "3 o d", "3 m end", "4 o e")
+		if err := (&spliceTransformation{from: tt.from, to: tt.to, insert: tt.insert}).Transform(c); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := eventList(c); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrim(t *testing.T) {
+	events := []string{"0.5 o \x1b[?25l", "3 o $", "4 o ls", "9 o \x1b[0m"}
+	tests := []struct {
+		leading, trailing bool
+		want              []string
+	}{
+		{true, true, []string{"0 o \x1b[?25l", "0.5 o $", "1.5 o ls", "2 o \x1b[0m"}},
+		{true, false, []string{"0 o \x1b[?25l", "0.5 o $", "1.5 o ls", "6.5 o \x1b[0m"}},
+		{false, true, []string{"0.5 o \x1b[?25l", "3 o $", "4 o ls", "4.5 o \x1b[0m"}},
+	}
+	for _, tt := range tests {
+		c := castOf(80, 24, events...)
+		if err := (&trimTransformation{leading: tt.leading, trailing: tt.trailing, keep: 0.5}).Transform(c); err != nil {
+			t.Fatal(err)
+		}
+		if got := eventList(c); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("leading %v, trailing %v: %q, want %q", tt.leading, tt.trailing, got, tt.want)
+		}
+	}
+	if err := (&trimTransformation{leading: true}).Transform(castOf(80, 24, "1 o \x1b[?25l")); err == nil {
+		t.Error("trim of a cast without visible output should fail")
+	}
+}
+
+func TestTransformFileSortsEvents(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.cast"), filepath.Join(dir, "out.cast")
+	content := `{"version": 2, "width": 80, "height": 24}` + "\n" + `[2, "o", "c"]` + "\n" + `[0, "o", "a"]` + "\n" + `[1, "o", "b"]` + "\n"
+	os.WriteFile(in, []byte(content), 0o644)
+	if err := transformFile(&cutTransformation{from: "1", to: "1"}, in, out); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadCast(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := eventList(got); !reflect.DeepEqual(events, []string{"0 o a", "1 o c"}) {
+		t.Errorf("events %q", events)
+	}
+}
@@ -1,7 +1,6 @@
 package asciinema
 
 import (
-	"os"
 	"strings"
 )
 
@@ -18,19 +17,9 @@ func verify(line string) bool {
 	return true
 }
 
+// Drops lines in descardingList, see Redactor for redacting secrets.
 func FixCast(fPath string) {
-	content, _ := os.ReadFile(fPath)
-	if len(content) > 0 {
-		sList := strings.Split(string(content), "\n")
-		data := []string{}
-		for _, line := range sList {
-			if verify(line) {
-				data = append(data, line)
-			}
-		}
-		if len(data) > 0 {
-			s := strings.Join(data, "\n")
-			os.WriteFile(fPath, []byte(s), os.ModePerm)
-		}
+	if r, err := NewRedactor(nil, ""); err == nil {
+		r.RedactFile(fPath, "", false)
 	}
 }
@@ -0,0 +1,99 @@
+package asciinema
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
+	"sort"
+)
+
+// Encodes rendered frames into an animation.
+type FrameEncoder interface {
+	Encode(f *Frame) error
+	Close() error
+}
+
+/*
+Encodes frames to an animated GIF.
+Each frame only contains the changed area with its own palette,
+colors are exact unless the area has more than 256 colors.
+*/
+type GifEncoder struct {
+	w       io.Writer
+	anim    *gif.GIF
+	elapsed int // centiseconds
+}
+
+func NewGifEncoder(w io.Writer) *GifEncoder {
+	return &GifEncoder{w: w, anim: &gif.GIF{}}
+}
+
+func (e *GifEncoder) Encode(f *Frame) error {
+	if len(e.anim.Image) == 0 {
+		b := f.Image.Bounds()
+		e.anim.Config = image.Config{Width: b.Dx(), Height: b.Dy()}
+	}
+	end := int(math.Round((f.Time + f.Duration) * 100))
+	// most browsers show frames shorter than 20ms slower.
+	delay := max(end-e.elapsed, 2)
+	e.elapsed += delay
+	e.anim.Image = append(e.anim.Image, palettedImage(f.Image, f.Rect))
+	e.anim.Delay = append(e.anim.Delay, delay)
+	e.anim.Disposal = append(e.anim.Disposal, gif.DisposalNone)
+	return nil
+}
+
+func (e *GifEncoder) Close() error {
+	if e.anim.Config.ColorModel == nil && len(e.anim.Image) > 0 {
+		e.anim.Config.ColorModel = e.anim.Image[0].Palette
+	}
+	return gif.EncodeAll(e.w, e.anim)
+}
+
+func rgbKey(pix []uint8) uint32 {
+	return uint32(pix[0])<<16 | uint32(pix[1])<<8 | uint32(pix[2])
+}
+
+// Converts an area to a paletted image, the most frequent 256 colors are kept.
+func palettedImage(src *image.RGBA, rect image.Rectangle) *image.Paletted {
+	counts := map[uint32]int{}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			counts[rgbKey(src.Pix[src.PixOffset(x, y):])]++
+		}
+	}
+	keys := make([]uint32, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > 256 {
+		keys = keys[:256]
+	}
+	palette := make(color.Palette, len(keys))
+	indexes := make(map[uint32]uint8, len(counts))
+	for i, k := range keys {
+		palette[i] = color.RGBA{R: uint8(k >> 16), G: uint8(k >> 8), B: uint8(k), A: 0xff}
+		indexes[k] = uint8(i)
+	}
+	dst := image.NewPaletted(rect, palette)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			k := rgbKey(src.Pix[src.PixOffset(x, y):])
+			index, ok := indexes[k]
+			if !ok {
+				index = uint8(palette.Index(color.RGBA{R: uint8(k >> 16), G: uint8(k >> 8), B: uint8(k), A: 0xff}))
+				indexes[k] = index
+			}
+			dst.Pix[dst.PixOffset(x, y)] = index
+		}
+	}
+	return dst
+}
@@ -0,0 +1,91 @@
+package asciinema
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+)
+
+/*
+Exports casts to a standalone HTML page.
+
+The player is the animated SVG of ExportSVG, controlled by the Web Animations API,
+so the page works offline without any player scripts from CDN.
+The transcript is included for searching and copying.
+*/
+const htmlPlayerScript = `(function(){
+var anim=null,g=document.querySelector('.player svg .a');
+if(g&&g.getAnimations){anim=g.getAnimations()[0]||null}
+var btn=document.getElementById('play'),seek=document.getElementById('seek'),
+time=document.getElementById('time'),speed=document.getElementById('speed');
+if(!anim){document.querySelector('.controls').style.display='none';return}
+var total=anim.effect.getComputedTiming().duration;
+function fmt(ms){var s=Math.floor(ms/1000);return Math.floor(s/60)+':'+('0'+s%60).slice(-2)}
+function update(){var t=(anim.currentTime||0)%total;seek.value=t/total*1000;
+time.textContent=fmt(t)+' / '+fmt(total);btn.textContent=anim.playState==='running'?'❚❚':'▶';}
+btn.onclick=function(){anim.playState==='running'?anim.pause():anim.play();update()};
+seek.oninput=function(){anim.currentTime=seek.value/1000*total;update()};
+speed.onchange=function(){anim.playbackRate=parseFloat(speed.value)};
+document.addEventListener('keydown',function(e){if(e.key===' '&&e.target.tagName!=='SELECT'){e.preventDefault();btn.onclick()}});
+setInterval(update,200);update();
+})();`
+
+const htmlPageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%[1]s</title>
+<style>
+body{margin:0;padding:24px;font-family:sans-serif;background:#f4f4f4;color:#222}
+.player{display:inline-block;max-width:100%%}
+.player svg{display:block;max-width:100%%;height:auto}
+.controls{display:flex;align-items:center;gap:8px;padding:6px 0}
+.controls input{flex:1}
+.controls button{width:36px}
+.controls span{font-family:monospace;font-size:13px}
+pre{background:#fff;padding:12px;overflow:auto;font-size:13px}
+</style>
+</head>
+<body>
+<h2>%[1]s</h2>
+<div class="player">
+%[2]s
+<div class="controls">
+<button id="play">▶</button>
+<input id="seek" type="range" min="0" max="1000" value="0">
+<span id="time"></span>
+<select id="speed"><option value="0.5">0.5x</option><option value="1" selected>1x</option><option value="1.5">1.5x</option><option value="2">2x</option></select>
+</div>
+</div>
+<details>
+<summary>Transcript</summary>
+<pre>%[3]s</pre>
+</details>
+<script>%[4]s</script>
+</body>
+</html>
+`
+
+// Renders a cast to an HTML page with a player and the transcript, title is the file name if empty.
+func ExportHTML(c *cast.Cast, opts *RenderOptions, title string, w io.Writer) (err error) {
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+	if c.Header.Title != "" {
+		title = c.Header.Title
+	}
+	player, transcript := &bytes.Buffer{}, &bytes.Buffer{}
+	if err = ExportSVG(c, opts, player); err != nil {
+		return
+	}
+	if err = WriteTranscript(c, transcript, true); err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(w, htmlPageTemplate, html.EscapeString(title), player.String(),
+		html.EscapeString(transcript.String()), htmlPlayerScript)
+	return
+}
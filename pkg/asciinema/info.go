@@ -0,0 +1,186 @@
+package asciinema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Statistics of a cast.
+*/
+type CastPause struct {
+	At       float64 // time of the event after the pause.
+	Duration float64
+}
+
+type CastStats struct {
+	Header      map[string]interface{}
+	Cols        int
+	Rows        int
+	MaxCols     int
+	MaxRows     int
+	Duration    float64
+	EventCounts map[string]int
+	OutputBytes int
+	InputBytes  int
+	Markers     []*cast.Event
+	Pauses      []*CastPause // longest pauses first.
+}
+
+/*
+Header fields as they are in the file, the first line of v2 and v3 after comments,
+or the whole file without stdout for v1, which may be pretty-printed in lines.
+*/
+func readHeaderFields(fPath string) (header map[string]interface{}, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return
+	}
+	header = map[string]interface{}{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			if json.Unmarshal([]byte(line), &header) == nil {
+				delete(header, "stdout")
+				return
+			}
+			break
+		}
+	}
+	if err = json.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("invalid cast header: %w", err)
+	}
+	delete(header, "stdout")
+	return
+}
+
+func GetCastStats(fPath string, maxPauses int) (stats *CastStats, err error) {
+	c, err := LoadCast(fPath)
+	if err != nil {
+		return
+	}
+	stats = &CastStats{EventCounts: map[string]int{}}
+	if stats.Header, err = readHeaderFields(fPath); err != nil {
+		return
+	}
+	stats.Cols, stats.Rows = int(c.Header.Width), int(c.Header.Height)
+	stats.MaxCols, stats.MaxRows = castSize(c)
+	stats.Duration = castEnd(c)
+	last := 0.0
+	for _, ev := range c.EventStream {
+		stats.EventCounts[ev.Type]++
+		switch ev.Type {
+		case "o":
+			stats.OutputBytes += len(ev.Data)
+		case "i":
+			stats.InputBytes += len(ev.Data)
+		case "m":
+			stats.Markers = append(stats.Markers, ev)
+		}
+		if gap := ev.Time - last; gap > 0 {
+			stats.Pauses = append(stats.Pauses, &CastPause{At: ev.Time, Duration: gap})
+		}
+		last = max(last, ev.Time)
+	}
+	sort.SliceStable(stats.Pauses, func(i, j int) bool { return stats.Pauses[i].Duration > stats.Pauses[j].Duration })
+	stats.Pauses = stats.Pauses[:min(len(stats.Pauses), maxPauses)]
+	return
+}
+
+func formatBytes(n int) string {
+	size, units := float64(n), []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for ; size >= 1024 && i < len(units)-1; i++ {
+		size /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
+
+func formatHeaderValue(key string, v interface{}) string {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := []string{}
+		for _, k := range keys {
+			items = append(items, fmt.Sprintf("%s=%v", k, value[k]))
+		}
+		return strings.Join(items, ", ")
+	case float64:
+		if key == "timestamp" {
+			return fmt.Sprintf("%.0f (%s)", value, time.Unix(int64(value), 0).Format("2006-01-02 15:04:05"))
+		}
+		return fmt.Sprintf("%g", value)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// Shows header fields and statistics of a cast.
+func ShowCastInfo(fPath string, maxPauses int) (err error) {
+	stats, err := GetCastStats(fPath, maxPauses)
+	if err != nil {
+		return
+	}
+	item := func(key, format string, args ...interface{}) {
+		fmt.Printf("%s %s\n", gprint.CyanStr("%-16s", key), fmt.Sprintf(format, args...))
+	}
+	item("File", "%s", fPath)
+	keys := []string{}
+	for k := range stats.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Println(gprint.CyanStr("Header"))
+	for _, k := range keys {
+		fmt.Printf("  %-14s %s\n", k, formatHeaderValue(k, stats.Header[k]))
+	}
+	size := fmt.Sprintf("%dx%d", stats.Cols, stats.Rows)
+	if stats.MaxCols != stats.Cols || stats.MaxRows != stats.Rows {
+		size += fmt.Sprintf(" (up to %dx%d after resizing)", stats.MaxCols, stats.MaxRows)
+	}
+	item("Terminal", "%s", size)
+	item("Duration", "%.3fs", stats.Duration)
+	types := []string{}
+	total := 0
+	for t, n := range stats.EventCounts {
+		types = append(types, t)
+		total += n
+	}
+	sort.Strings(types)
+	counts := []string{}
+	for _, t := range types {
+		counts = append(counts, fmt.Sprintf("%s: %d", t, stats.EventCounts[t]))
+	}
+	item("Events", "%d (%s)", total, strings.Join(counts, ", "))
+	item("Output", "%s", formatBytes(stats.OutputBytes))
+	if stats.InputBytes > 0 {
+		item("Input", "%s", formatBytes(stats.InputBytes))
+	}
+	if len(stats.Markers) > 0 {
+		markers := []string{}
+		for _, m := range stats.Markers {
+			markers = append(markers, fmt.Sprintf("%s@%.3fs", m.Data, m.Time))
+		}
+		item("Markers", "%s", strings.Join(markers, ", "))
+	}
+	if len(stats.Pauses) > 0 {
+		fmt.Println(gprint.CyanStr("Longest pauses"))
+		for _, p := range stats.Pauses {
+			fmt.Printf("  %8.3fs before %.3fs\n", p.Duration, p.At)
+		}
+	}
+	return
+}
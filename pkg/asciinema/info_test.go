@@ -0,0 +1,70 @@
+package asciinema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetCastStats(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		content  string
+		version  float64
+		duration float64
+	}{
+		{
+			name: "pretty-printed v1",
+			content: `{
+  "version": 1,
+  "width": 80,
+  "height": 24,
+  "title": "demo",
+  "stdout": [[0.5, "a"], [1.5, "b"]]
+}
+`,
+			version:  CastV1,
+			duration: 2,
+		},
+		{
+			name:     "v1 in a line",
+			content:  `{"version": 1, "width": 80, "height": 24, "title": "demo", "stdout": [[0.5, "a"], [1.5, "b"]]}` + "\n",
+			version:  CastV1,
+			duration: 2,
+		},
+		{
+			name:     "v2",
+			content:  `{"version": 2, "width": 80, "height": 24, "title": "demo"}` + "\n" + `[0.5, "o", "a"]` + "\n" + `[2, "o", "b"]` + "\n",
+			version:  CastV2,
+			duration: 2,
+		},
+		{
+			name:     "v3 with comments",
+			content:  "# recorded by gvc\n" + `{"version": 3, "term": {"cols": 80, "rows": 24}, "title": "demo"}` + "\n" + `[0.5, "o", "a"]` + "\n" + `[1.5, "o", "b"]` + "\n",
+			version:  CastV3,
+			duration: 2,
+		},
+	}
+	for _, tt := range tests {
+		fPath := filepath.Join(dir, "demo.cast")
+		os.WriteFile(fPath, []byte(tt.content), 0o644)
+		stats, err := GetCastStats(fPath, 3)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if stats.Header["version"] != tt.version || stats.Header["title"] != "demo" {
+			t.Errorf("%s: header %v", tt.name, stats.Header)
+		}
+		if _, ok := stats.Header["stdout"]; ok {
+			t.Errorf("%s: stdout of v1 should not be in header", tt.name)
+		}
+		if stats.Cols != 80 || stats.Rows != 24 || stats.Duration != tt.duration || stats.EventCounts["o"] != 2 {
+			t.Errorf("%s: %dx%d, duration %v, events %v", tt.name, stats.Cols, stats.Rows, stats.Duration, stats.EventCounts)
+		}
+		if len(stats.Pauses) != 2 || stats.Pauses[0].Duration < stats.Pauses[1].Duration {
+			t.Errorf("%s: pauses %+v", tt.name, stats.Pauses)
+		}
+	}
+}
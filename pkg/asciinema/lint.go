@@ -0,0 +1,218 @@
+package asciinema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Checks casts for problems that break players or editing, and fixes them if possible.
+*/
+const (
+	LintVersion = "version"
+	LintHeader  = "header"
+	LintJSON    = "json"
+	LintEvent   = "event"
+	LintType    = "type"
+	LintOrder   = "order"
+	LintEscape  = "escape"
+	LintPause   = "pause"
+)
+
+type LintIssue struct {
+	Line    int
+	Kind    string
+	Message string
+	Fixable bool
+}
+
+type LintOptions struct {
+	MaxPause float64 // seconds, idle_time_limit in cast header or DefaultIdleTimeLimit if 0, negative to skip.
+	Fix      bool
+	Output   string // fixed cast is written to the input file if empty.
+}
+
+type castLinter struct {
+	opts   *LintOptions
+	issues []*LintIssue
+}
+
+func (l *castLinter) add(line int, kind string, fixable bool, format string, args ...interface{}) {
+	l.issues = append(l.issues, &LintIssue{Line: line, Kind: kind, Fixable: fixable, Message: fmt.Sprintf(format, args...)})
+}
+
+/*
+Lints lines of an asciicast v2, returns fixed lines.
+Unchanged lines are kept as they are, nil is returned if the cast can not be fixed.
+*/
+func (l *castLinter) lint(lines []string) (fixed []string) {
+	headerLine := strings.TrimSpace(lines[0])
+	header := &CastHeader{}
+	if err := json.Unmarshal([]byte(headerLine), header); err != nil {
+		l.add(1, LintHeader, false, "invalid header: %v", err)
+		return nil
+	}
+	if header.Version != 2 {
+		l.add(1, LintVersion, false, "unsupported version: %d", header.Version)
+		return nil
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		l.add(1, LintHeader, false, "invalid terminal size: %dx%d", header.Width, header.Height)
+		return nil
+	}
+	maxPause := l.opts.MaxPause
+	if maxPause == 0 {
+		maxPause = header.IdleTimeLimit
+	}
+	if maxPause == 0 {
+		maxPause = DefaultIdleTimeLimit
+	}
+
+	fixed = []string{headerLine}
+	last, shift := 0.0, 0.0 // shift is the time removed by fixing pauses.
+	for i, line := range lines[1:] {
+		lineNum := i + 2
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !verify(line) {
+			l.add(lineNum, LintEscape, true, "terminal query echoed into the cast")
+			continue
+		}
+		event := []interface{}{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			l.add(lineNum, LintJSON, true, "invalid json: %v", err)
+			continue
+		}
+		var t float64
+		var eType string
+		ok := len(event) == 3
+		if ok {
+			var ok1, ok2, ok3 bool
+			t, ok1 = event[0].(float64)
+			eType, ok2 = event[1].(string)
+			_, ok3 = event[2].(string)
+			ok = ok1 && ok2 && ok3
+		}
+		if !ok {
+			l.add(lineNum, LintEvent, true, "event should be [time, type, data]")
+			continue
+		}
+		if !strings.Contains("oimr", eType) || len(eType) != 1 {
+			l.add(lineNum, LintType, false, "unknown event type: %s", eType)
+		}
+		changed := false
+		if t < last {
+			l.add(lineNum, LintOrder, true, "time %.6f is before the previous event at %.6f", t, last)
+			t, changed = last, true
+		} else if maxPause > 0 && t-last > maxPause {
+			l.add(lineNum, LintPause, true, "pause of %.3fs before this event, longer than %gs", t-last, maxPause)
+			shift += t - last - maxPause
+		}
+		last = t
+		if shift > 0 {
+			t, changed = t-shift, true
+		}
+		if changed {
+			event[0] = roundTime(t)
+			line = marshalJSON(event)
+		}
+		fixed = append(fixed, line)
+	}
+	return
+}
+
+func (l *castLinter) lintFile(fPath string) (fixed []string, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return nil, fmt.Errorf("empty cast file: %s", fPath)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if header, _ := readHeaderFields(fPath); header["version"] != float64(CastV2) {
+		if c, version, err := decodeCastContent(content); err == nil {
+			l.add(1, LintVersion, true, "asciicast v%d, most players and editors only support v2", version)
+			buf := &strings.Builder{}
+			EncodeCast(c, buf, CastV2)
+			lines = strings.Split(buf.String(), "\n")
+		}
+	}
+	return l.lint(lines), nil
+}
+
+// Writes to a temp file first, which replaces the target only if it can be loaded.
+func writeCastSafely(fPath string, lines []string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(fPath), ".lint-*.cast")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(strings.Join(lines, "\n") + "\n")
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return
+	}
+	if _, err = LoadCast(tmp.Name()); err != nil {
+		return fmt.Errorf("fixed cast is invalid: %w", err)
+	}
+	return os.Rename(tmp.Name(), fPath)
+}
+
+/*
+Lints a cast and prints issues, returns issues that are not fixed.
+*/
+func LintCast(fPath string, opts *LintOptions) (remaining []*LintIssue, err error) {
+	if opts == nil {
+		opts = &LintOptions{}
+	}
+	l := &castLinter{opts: opts}
+	fixed, err := l.lintFile(fPath)
+	if err != nil {
+		return
+	}
+	for _, issue := range l.issues {
+		kind := gprint.YellowStr("%-8s", issue.Kind)
+		if !issue.Fixable {
+			kind = gprint.RedStr("%-8s", issue.Kind)
+		}
+		fmt.Printf("%s:%d  %s  %s\n", fPath, issue.Line, kind, issue.Message)
+	}
+	fixable := 0
+	for _, issue := range l.issues {
+		if issue.Fixable {
+			fixable++
+		}
+	}
+	if !opts.Fix || fixable == 0 || fixed == nil {
+		if len(l.issues) == 0 {
+			gprint.PrintSuccess("No issues found in %s", fPath)
+		} else {
+			gprint.PrintWarning("%d issues found, %d can be fixed with --fix.", len(l.issues), fixable)
+		}
+		return l.issues, nil
+	}
+	output := opts.Output
+	if output == "" {
+		output = fPath
+	}
+	if err = writeCastSafely(output, fixed); err != nil {
+		return
+	}
+	for _, issue := range l.issues {
+		if !issue.Fixable {
+			remaining = append(remaining, issue)
+		}
+	}
+	gprint.PrintSuccess("%d issues fixed, cast saved to %s", fixable, output)
+	return
+}
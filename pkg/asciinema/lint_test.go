@@ -0,0 +1,33 @@
+package asciinema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLintCastRemaining(t *testing.T) {
+	dir := t.TempDir()
+	header := `{"version": 2, "width": 80, "height": 24}` + "\n"
+	tests := []struct {
+		name      string
+		events    string
+		fix       bool
+		remaining int
+	}{
+		{"clean", `[0.5, "o", "a"]` + "\n", false, 0},
+		{"not fixed", `[0.5, "o", "a"]` + "\n" + `[9, "o", "b"]` + "\n", false, 1},
+		{"fixed", `[0.5, "o", "a"]` + "\n" + `[9, "o", "b"]` + "\n", true, 0},
+		{"unfixable left", `[0.5, "x", "a"]` + "\n" + `[9, "o", "b"]` + "\n", true, 1},
+	}
+	for _, tt := range tests {
+		fPath := filepath.Join(dir, "demo.cast")
+		os.WriteFile(fPath, []byte(header+tt.events), 0o644)
+		var remaining []*LintIssue
+		var err error
+		captureStdout(t, func() { remaining, err = LintCast(fPath, &LintOptions{Fix: tt.fix}) })
+		if err != nil || len(remaining) != tt.remaining {
+			t.Errorf("%s: %d issues remaining, %v, want %d", tt.name, len(remaining), err, tt.remaining)
+		}
+	}
+}
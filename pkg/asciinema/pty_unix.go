@@ -0,0 +1,21 @@
+//go:build !windows
+
+package asciinema
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/creack/pty"
+)
+
+const ptySupported = true
+
+// Starts command in a pty with the given size.
+func startPty(command string, cols, rows int, env []string) (cmd *exec.Cmd, ptmx *os.File, err error) {
+	cmd = exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "ASCIINEMA_REC=1")
+	cmd.Env = append(cmd.Env, env...)
+	ptmx, err = pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	return
+}
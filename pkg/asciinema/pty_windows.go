@@ -0,0 +1,15 @@
+//go:build windows
+
+package asciinema
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+const ptySupported = false
+
+func startPty(command string, cols, rows int, env []string) (cmd *exec.Cmd, ptmx *os.File, err error) {
+	return nil, nil, fmt.Errorf("pty is not supported on windows")
+}
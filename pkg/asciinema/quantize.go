@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/gvcgo/asciinema-edit/cast"
-	"github.com/gvcgo/asciinema-edit/commands/transformer"
 	"github.com/gvcgo/asciinema-edit/editor"
 	"github.com/pkg/errors"
 )
@@ -108,11 +107,5 @@ func (a *Asciinema) Quantize(inFilePath, outFilePath string, ranges []string) (e
 	if err != nil {
 		return
 	}
-	var t *transformer.Transformer
-	t, err = transformer.New(transformation, inFilePath, outFilePath)
-	if err != nil {
-		return
-	}
-	defer t.Close()
-	return t.Transform()
+	return transformFile(transformation, inFilePath, outFilePath)
 }
@@ -0,0 +1,209 @@
+package asciinema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"golang.org/x/term"
+)
+
+/*
+Options for recording.
+*/
+var DefaultEnvWhitelist = []string{"SHELL", "TERM"}
+
+type RecordOptions struct {
+	Title         string
+	Command       string  // records a single command instead of a shell if specified.
+	IdleTimeLimit float64 // seconds, idle time longer than this is shortened.
+	Cols          int
+	Rows          int
+	EnvWhitelist  []string // env names saved in cast header.
+	Append        bool
+	NoRedact      bool // skips redaction of secrets after recording.
+}
+
+func (o *RecordOptions) env() (env map[string]string) {
+	env = map[string]string{}
+	names := o.EnvWhitelist
+	if len(names) == 0 {
+		names = DefaultEnvWhitelist
+	}
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			env[name] = v
+		}
+	}
+	return
+}
+
+func (o *RecordOptions) header(cols, rows int) *CastHeader {
+	return &CastHeader{
+		Version:       2,
+		Width:         cols,
+		Height:        rows,
+		IdleTimeLimit: o.IdleTimeLimit,
+		Command:       o.Command,
+		Title:         o.Title,
+		Env:           o.env(),
+	}
+}
+
+/*
+Records with asciinema runner, then writes the cast with options applied.
+*/
+func (a *Asciinema) RecordWithOptions(fPath string, opts *RecordOptions) (err error) {
+	if opts == nil {
+		opts = &RecordOptions{}
+	}
+	title, fPath := handleFilePath(fPath)
+	if strings.TrimSpace(opts.Command) != "" && runtime.GOOS == gutils.Windows {
+		return fmt.Errorf("--command is not supported on %s", runtime.GOOS)
+	}
+
+	recorded := filepath.Join(GetAsciinemaWorkDir(), "recording.temp.cast")
+	defer os.Remove(recorded)
+	a.cmd.Title, a.cmd.FilePath = opts.Title, recorded
+	if a.cmd.Title == "" {
+		a.cmd.Title = title
+	}
+	if opts.IdleTimeLimit > 0 {
+		a.cmd.MaxWait = opts.IdleTimeLimit
+	}
+	restoreSize := requestTerminalSize(opts.Cols, opts.Rows)
+	restoreShell := useCommand(opts.Command)
+	err = a.cmd.Rec()
+	restoreShell()
+	restoreSize()
+	if err != nil {
+		return
+	}
+
+	if err = writeRecording(recorded, fPath, title, opts); err != nil {
+		return
+	}
+	if opts.NoRedact {
+		FixCast(fPath)
+		return
+	}
+	return AutoRedact(fPath)
+}
+
+/*
+Writes events recorded by the runner to fPath.
+
+When appending, events are shifted after the last event of fPath,
+title and idle time limit are only updated if specified,
+and a resize event is added if the terminal size has changed.
+*/
+func writeRecording(recorded, fPath, defaultTitle string, opts *RecordOptions) (err error) {
+	c, err := LoadCast(recorded)
+	if err != nil {
+		return
+	}
+	cols, rows := int(c.Header.Width), int(c.Header.Height)
+	appendMode := false
+	if opts.Append {
+		_, err1 := os.Stat(fPath)
+		appendMode = err1 == nil
+	}
+	w, err := NewCastWriter(fPath, opts.header(cols, rows), appendMode)
+	if err != nil {
+		return
+	}
+	h := w.Header()
+	if appendMode {
+		if opts.Title != "" {
+			h.Title = opts.Title
+		}
+		if opts.IdleTimeLimit > 0 {
+			h.IdleTimeLimit = opts.IdleTimeLimit
+		}
+		if h.Width != cols || h.Height != rows {
+			w.WriteEvent(0, "r", []byte(fmt.Sprintf("%dx%d", cols, rows)))
+		}
+	} else if h.Title == "" {
+		h.Title = defaultTitle
+	}
+	for _, e := range c.EventStream {
+		if err = w.WriteEvent(e.Time, e.Type, []byte(e.Data)); err != nil {
+			w.Close()
+			return
+		}
+	}
+	return w.Close()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+/*
+Asciinema runner records $SHELL, so a command is recorded by setting $SHELL to it.
+The command itself still sees the original $SHELL.
+*/
+func useCommand(command string) (restore func()) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return func() {}
+	}
+	shell, ok := os.LookupEnv("SHELL")
+	if ok {
+		os.Setenv("SHELL", fmt.Sprintf("export SHELL=%s; %s", shellQuote(shell), command))
+	} else {
+		os.Setenv("SHELL", "unset SHELL; "+command)
+	}
+	return func() {
+		if ok {
+			os.Setenv("SHELL", shell)
+		} else {
+			os.Unsetenv("SHELL")
+		}
+	}
+}
+
+/*
+Asciinema runner records with the size of current terminal,
+so the terminal is asked to resize with the xterm window manipulation sequence.
+*/
+func requestTerminalSize(cols, rows int) (restore func()) {
+	restore = func() {}
+	if cols <= 0 && rows <= 0 {
+		return
+	}
+	fd := int(os.Stdout.Fd())
+	oldCols, oldRows, err := term.GetSize(fd)
+	if err != nil || oldCols <= 0 || oldRows <= 0 {
+		gprint.PrintWarning("Cannot get terminal size, --cols and --rows are ignored.")
+		return
+	}
+	if cols <= 0 {
+		cols = oldCols
+	}
+	if rows <= 0 {
+		rows = oldRows
+	}
+	if cols == oldCols && rows == oldRows {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "\x1b[8;%d;%dt", rows, cols)
+	c, r := oldCols, oldRows
+	for i := 0; i < 10; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if c, r, _ = term.GetSize(fd); c == cols && r == rows {
+			break
+		}
+	}
+	if c != cols || r != rows {
+		gprint.PrintWarning("Terminal does not support resizing, recording with %dx%d.", c, r)
+	}
+	return func() {
+		fmt.Fprintf(os.Stdout, "\x1b[8;%d;%dt", oldRows, oldCols)
+	}
+}
@@ -0,0 +1,116 @@
+package asciinema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, fPath, content string) {
+	t.Helper()
+	if err := os.WriteFile(fPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteRecording(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SHELL", "/bin/zsh")
+	t.Setenv("TERM", "xterm-256color")
+	recorded := filepath.Join(dir, "recorded.cast")
+	// written by asciinema runner.
+	writeTestFile(t, recorded, `{"version":2,"width":80,"height":24,"timestamp":1700000000,"duration":1.5,"command":"/bin/zsh","title":"runner","env":{"TERM":"xterm","SHELL":"/bin/zsh"}}
+[0.5,"o","hello\r\n"]
+[1.5,"o","world\r\n"]
+`)
+
+	fPath := filepath.Join(dir, "demo.cast")
+	opts := &RecordOptions{IdleTimeLimit: 2, EnvWhitelist: []string{"TERM"}}
+	if err := writeRecording(recorded, fPath, "demo", opts); err != nil {
+		t.Fatal(err)
+	}
+	header, last, err := ReadCastHeader(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Width != 80 || header.Height != 24 || header.Title != "demo" || header.IdleTimeLimit != 2 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	if header.Command != "" || len(header.Env) != 1 || header.Env["TERM"] != "xterm-256color" {
+		t.Errorf("command and env should come from options: %+v", header)
+	}
+	if header.Duration != 1.5 || last != 1.5 {
+		t.Errorf("duration = %v, last event = %v, want 1.5", header.Duration, last)
+	}
+
+	// append with a new title and idle time limit, in a bigger terminal.
+	writeTestFile(t, recorded, `{"version":2,"width":100,"height":30,"timestamp":1700000100,"env":{}}
+[0.25,"o","again\r\n"]
+`)
+	opts = &RecordOptions{Title: "new title", IdleTimeLimit: 1, Append: true}
+	if err := writeRecording(recorded, fPath, "demo", opts); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCast(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Header.Width != 80 || c.Header.Title != "new title" || c.Header.IdleTimeLimit != 1 || c.Header.Duration != 1.75 {
+		t.Errorf("unexpected header after append: %+v", c.Header)
+	}
+	want := []struct {
+		time  float64
+		eType string
+		data  string
+	}{
+		{0.5, "o", "hello\r\n"},
+		{1.5, "o", "world\r\n"},
+		{1.5, "r", "100x30"},
+		{1.75, "o", "again\r\n"},
+	}
+	if len(c.EventStream) != len(want) {
+		t.Fatalf("got %d events, want %d", len(c.EventStream), len(want))
+	}
+	for i, w := range want {
+		e := c.EventStream[i]
+		if e.Time != w.time || e.Type != w.eType || e.Data != w.data {
+			t.Errorf("event %d = %v %q %q, want %v %q %q", i, e.Time, e.Type, e.Data, w.time, w.eType, w.data)
+		}
+	}
+
+	// append without title keeps the old one.
+	opts = &RecordOptions{Append: true}
+	if err := writeRecording(recorded, fPath, "demo", opts); err != nil {
+		t.Fatal(err)
+	}
+	if header, _, _ = ReadCastHeader(fPath); header.Title != "new title" || header.IdleTimeLimit != 1 {
+		t.Errorf("title and idle time limit should be kept: %+v", header)
+	}
+
+	// appending to a missing file creates it.
+	missing := filepath.Join(dir, "missing.cast")
+	if err := writeRecording(recorded, missing, "missing", &RecordOptions{Append: true}); err != nil {
+		t.Fatal(err)
+	}
+	if header, _, _ = ReadCastHeader(missing); header.Width != 100 || header.Title != "missing" {
+		t.Errorf("unexpected header: %+v", header)
+	}
+}
+
+func TestUseCommand(t *testing.T) {
+	t.Setenv("SHELL", "/bin/it's")
+	restore := useCommand("  make demo ")
+	if got := os.Getenv("SHELL"); got != `export SHELL='/bin/it'\''s'; make demo` {
+		t.Errorf("SHELL = %q", got)
+	}
+	restore()
+	if got := os.Getenv("SHELL"); got != "/bin/it's" {
+		t.Errorf("SHELL is not restored: %q", got)
+	}
+
+	restore = useCommand("")
+	if got := os.Getenv("SHELL"); got != "/bin/it's" {
+		t.Errorf("SHELL should not change without command: %q", got)
+	}
+	restore()
+}
@@ -0,0 +1,492 @@
+package asciinema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Redacts secrets from casts.
+
+Rules are regular expressions, only the first group is replaced if a rule has groups.
+Output and input events are matched as continuous streams, so secrets echoed
+character by character are also found. Lines containing items in descardingList are dropped.
+*/
+const DefaultRedactReplacement = "[REDACTED]"
+
+type RedactRule struct {
+	Name        string
+	Pattern     string
+	Replacement string // DefaultRedactReplacement or the replacement of Redactor if empty.
+	Except      string // matches of this pattern are kept.
+	re          *regexp.Regexp
+	except      *regexp.Regexp
+}
+
+func (r *RedactRule) compile() (err error) {
+	if r.re == nil {
+		if r.re, err = regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid redact rule %s: %w", r.Name, err)
+		}
+	}
+	if r.Except != "" && r.except == nil {
+		if r.except, err = regexp.Compile(r.Except); err != nil {
+			return fmt.Errorf("invalid redact rule %s: %w", r.Name, err)
+		}
+	}
+	return
+}
+
+func BuiltinRedactRules() (rules []*RedactRule) {
+	rules = []*RedactRule{
+		{Name: "github-token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+		{Name: "gitee-token", Pattern: `(?i)gitee\S{0,20}?(?:token|password|secret)["']?\s*[:=]\s*["']?([0-9a-f]{32})\b`},
+		{Name: "aws-access-key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{Name: "aws-secret-key", Pattern: `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`},
+		{Name: "private-ip", Pattern: `\b(?:10\.\d{1,3}|172\.(?:1[6-9]|2\d|3[01])|192\.168)\.\d{1,3}\.\d{1,3}\b`},
+		{Name: "email", Pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`, Except: `^git@`},
+	}
+	// tokens saved in gvc config are always secrets.
+	cfg := conf.NewGVConfig()
+	tokens := []string{}
+	for _, token := range []string{cfg.GitToken, cfg.GiteeToken, cfg.Password} {
+		if len(token) >= 8 {
+			tokens = append(tokens, regexp.QuoteMeta(token))
+		}
+	}
+	if len(tokens) > 0 {
+		rules = append(rules, &RedactRule{Name: "gvc-token", Pattern: strings.Join(tokens, "|")})
+	}
+	if home, _ := os.UserHomeDir(); len(home) > 1 {
+		rules = append(rules, &RedactRule{Name: "home-path", Pattern: regexp.QuoteMeta(filepath.Clean(home)) + `\b`, Replacement: "~"})
+	}
+	return
+}
+
+// Built-in rules and custom rules in gvc config.
+func DefaultRedactRules() []*RedactRule {
+	rules := BuiltinRedactRules()
+	cfg := conf.NewGVConfig()
+	names := []string{}
+	for name := range cfg.RedactRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rules = append(rules, &RedactRule{Name: name, Pattern: cfg.RedactRules[name]})
+	}
+	return rules
+}
+
+type RedactMatch struct {
+	Time float64
+	Rule string
+	Text string
+}
+
+// Text with the middle part masked, so reports do not leak secrets.
+func (m *RedactMatch) Masked() string {
+	runes := []rune(m.Text)
+	keep := min(len(runes)/4, 4)
+	return string(runes[:keep]) + strings.Repeat("*", len(runes)-2*keep) + string(runes[len(runes)-keep:])
+}
+
+type Redactor struct {
+	Rules       []*RedactRule
+	Replacement string
+	Matches     []*RedactMatch
+}
+
+func NewRedactor(rules []*RedactRule, replacement string) (r *Redactor, err error) {
+	if replacement == "" {
+		replacement = conf.NewGVConfig().RedactReplacement
+	}
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	for _, rule := range rules {
+		if err = rule.compile(); err != nil {
+			return
+		}
+	}
+	return &Redactor{Rules: rules, Replacement: replacement}, nil
+}
+
+type redactSpan struct {
+	start, end  int
+	rule        *RedactRule
+	replacement string
+}
+
+// Spans of matches sorted by position, overlapping spans are merged.
+func (r *Redactor) spans(text string) (spans []*redactSpan) {
+	for _, rule := range r.Rules {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = r.Replacement
+		}
+		for _, m := range rule.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if rule.except != nil && rule.except.MatchString(text[start:end]) {
+				continue
+			}
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if end > start {
+				spans = append(spans, &redactSpan{start: start, end: end, rule: rule, replacement: replacement})
+			}
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := []*redactSpan{}
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.start < merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// Marshals without escaping html characters, which are common in replacements like <secret>.
+func marshalJSON(v interface{}) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+/*
+Redacts texts as a continuous stream, returns the redacted texts.
+Replacement is put in the text where a match starts, the rest of the match is removed.
+Replacements are escaped if texts are json.
+*/
+func (r *Redactor) redactStream(texts []string, times []float64, isJSON bool) []string {
+	offsets := make([]int, len(texts)+1)
+	for i, t := range texts {
+		offsets[i+1] = offsets[i] + len(t)
+	}
+	joined := strings.Join(texts, "")
+	spans := r.spans(joined)
+	if len(spans) == 0 {
+		return texts
+	}
+	result := make([]string, len(texts))
+	si := 0
+	for i := range texts {
+		var b strings.Builder
+		for pos := offsets[i]; pos < offsets[i+1]; {
+			for si < len(spans) && spans[si].end <= pos {
+				si++
+			}
+			if si < len(spans) && spans[si].start <= pos {
+				s := spans[si]
+				if s.start == pos {
+					if isJSON {
+						b.WriteString(strings.Trim(marshalJSON(s.replacement), `"`))
+					} else {
+						b.WriteString(s.replacement)
+					}
+					r.Matches = append(r.Matches, &RedactMatch{Time: times[i], Rule: s.rule.Name, Text: joined[s.start:s.end]})
+				}
+				pos = min(s.end, offsets[i+1])
+				continue
+			}
+			next := offsets[i+1]
+			if si < len(spans) {
+				next = min(next, spans[si].start)
+			}
+			b.WriteString(joined[pos:next])
+			pos = next
+		}
+		result[i] = b.String()
+	}
+	return result
+}
+
+// Redacts string values in the header, like title, command and env.
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		return r.redactStream([]string{value}, []float64{0}, false)[0]
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = r.redactValue(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = r.redactValue(item)
+		}
+	}
+	return v
+}
+
+type redactEvent struct {
+	line  int
+	event []interface{}
+}
+
+/*
+Redacts cast content line by line, lines that are not events are kept as they are.
+Returns nil if nothing is changed.
+*/
+func (r *Redactor) RedactLines(lines []string) []string {
+	result := []string{}
+	changed := false
+	streams := map[string][]*redactEvent{}
+	for _, line := range lines {
+		if !verify(line) {
+			changed = true
+			continue
+		}
+		result = append(result, line)
+		event := []interface{}{}
+		if json.Unmarshal([]byte(line), &event) != nil || len(event) != 3 {
+			continue
+		}
+		if _, ok := event[0].(float64); !ok {
+			continue
+		}
+		eType, ok1 := event[1].(string)
+		_, ok2 := event[2].(string)
+		if !ok1 || !ok2 {
+			continue
+		}
+		streams[eType] = append(streams[eType], &redactEvent{line: len(result) - 1, event: event})
+	}
+	if len(result) > 0 && strings.HasPrefix(strings.TrimSpace(result[0]), "{") {
+		// the raw line is redacted to keep the order of fields, the header is re-encoded if it breaks.
+		before := len(r.Matches)
+		line := r.redactStream([]string{result[0]}, []float64{0}, true)[0]
+		header := map[string]interface{}{}
+		if len(r.Matches) > before && json.Unmarshal([]byte(line), &header) != nil {
+			r.Matches = r.Matches[:before]
+			if json.Unmarshal([]byte(result[0]), &header) == nil {
+				r.redactValue(header)
+				line = marshalJSON(header)
+			}
+		}
+		if line != result[0] {
+			result[0], changed = line, true
+		}
+	}
+	types := []string{}
+	for eType := range streams {
+		types = append(types, eType)
+	}
+	sort.Strings(types)
+	for _, eType := range types {
+		events := streams[eType]
+		texts, times := make([]string, len(events)), make([]float64, len(events))
+		for i, e := range events {
+			texts[i], times[i] = e.event[2].(string), e.event[0].(float64)
+		}
+		// markers and other events are redacted one by one.
+		if eType != "o" && eType != "i" {
+			for i := range texts {
+				texts[i] = r.redactStream(texts[i:i+1], times[i:i+1], false)[0]
+			}
+		} else {
+			texts = r.redactStream(texts, times, false)
+		}
+		for i, e := range events {
+			if texts[i] != e.event[2].(string) {
+				e.event[2] = texts[i]
+				result[e.line], changed = marshalJSON(e.event), true
+			}
+		}
+	}
+	sort.SliceStable(r.Matches, func(i, j int) bool { return r.Matches[i].Time < r.Matches[j].Time })
+	if !changed {
+		return nil
+	}
+	return result
+}
+
+/*
+Redacts a cast file and writes the result to outFilePath, the input file is updated if outFilePath is empty.
+Nothing is written in dryRun mode.
+*/
+func (r *Redactor) RedactFile(fPath, outFilePath string, dryRun bool) (err error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	f.Close()
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("empty cast file: %s", fPath)
+	}
+	result := r.RedactLines(lines)
+	if dryRun || (result == nil && outFilePath == "") {
+		return
+	}
+	if result == nil {
+		result = lines
+	}
+	if outFilePath == "" {
+		outFilePath = fPath
+	}
+	return os.WriteFile(outFilePath, []byte(strings.Join(result, "\n")+"\n"), 0o644)
+}
+
+func (r *Redactor) PrintReport() {
+	if len(r.Matches) == 0 {
+		gprint.PrintInfo("No secrets found.")
+		return
+	}
+	for _, m := range r.Matches {
+		fmt.Printf("%s  %s  %s\n", gprint.CyanStr("%10.3fs", m.Time), gprint.YellowStr("%-16s", m.Rule), m.Masked())
+	}
+	gprint.PrintWarning("%d matches redacted.", len(r.Matches))
+}
+
+/*
+Redacts a cast with the default rules in place, used after recording.
+*/
+func AutoRedact(fPath string) (err error) {
+	r, err := NewRedactor(DefaultRedactRules(), "")
+	if err != nil {
+		return
+	}
+	if err = r.RedactFile(fPath, "", false); err == nil && len(r.Matches) > 0 {
+		r.PrintReport()
+	}
+	return
+}
+
+/*
+Redacts a copy of the cast with the default rules before it is published,
+returns the path of the copy, which has the same base name in a temp dir.
+*/
+func RedactedCopy(fPath string) (result string, err error) {
+	r, err := NewRedactor(DefaultRedactRules(), "")
+	if err != nil {
+		return
+	}
+	dir, err := os.MkdirTemp("", "gvc-redact-")
+	if err != nil {
+		return
+	}
+	result = filepath.Join(dir, filepath.Base(fPath))
+	if err = r.RedactFile(fPath, result, false); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	if len(r.Matches) > 0 {
+		r.PrintReport()
+	}
+	return
+}
+
+// Removes the temp copy created by RedactedCopy.
+func RemoveRedactedCopy(fPath string) {
+	os.RemoveAll(filepath.Dir(fPath))
+}
+
+/*
+Options of the redact command.
+*/
+type RedactOptions struct {
+	Rules       map[string]string // extra rules, name: pattern.
+	Disabled    []string          // names of rules to skip.
+	Replacement string
+	DryRun      bool // only reports matches.
+}
+
+func (o *RedactOptions) rules() (rules []*RedactRule) {
+	disabled := map[string]bool{}
+	for _, name := range o.Disabled {
+		disabled[strings.TrimSpace(name)] = true
+	}
+	names := []string{}
+	for name := range o.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, rule := range DefaultRedactRules() {
+		if _, ok := o.Rules[rule.Name]; !ok && !disabled[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	for _, name := range names {
+		if !disabled[name] {
+			rules = append(rules, &RedactRule{Name: name, Pattern: o.Rules[name]})
+		}
+	}
+	return
+}
+
+// Redacts a cast, the input file is updated if outFilePath is empty.
+func Redact(fPath, outFilePath string, opts *RedactOptions) (err error) {
+	if opts == nil {
+		opts = &RedactOptions{}
+	}
+	r, err := NewRedactor(opts.rules(), opts.Replacement)
+	if err != nil {
+		return
+	}
+	if err = r.RedactFile(fPath, outFilePath, opts.DryRun); err != nil {
+		return
+	}
+	r.PrintReport()
+	if !opts.DryRun && len(r.Matches) > 0 {
+		if outFilePath == "" {
+			outFilePath = fPath
+		}
+		gprint.PrintSuccess("Redacted cast saved to %s", outFilePath)
+	}
+	return
+}
+
+// Saves custom rules and replacement to gvc config.
+func SaveRedactRules(rules map[string]string, replacement string) (err error) {
+	for name, pattern := range rules {
+		if err = (&RedactRule{Name: name, Pattern: pattern}).compile(); err != nil {
+			return
+		}
+	}
+	cfg := conf.NewGVConfig()
+	if cfg.RedactRules == nil {
+		cfg.RedactRules = map[string]string{}
+	}
+	for name, pattern := range rules {
+		cfg.RedactRules[name] = pattern
+	}
+	if replacement != "" {
+		cfg.RedactReplacement = replacement
+	}
+	cfg.Save()
+	gprint.PrintSuccess("Redact rules saved to %s", conf.GetConfPath())
+	return
+}
+
+func PrintRedactRules() {
+	for _, rule := range DefaultRedactRules() {
+		pattern := rule.Pattern
+		if rule.Name == "gvc-token" {
+			pattern = "<tokens in gvc config>"
+		}
+		fmt.Printf("%s  %s\n", gprint.YellowStr("%-16s", rule.Name), pattern)
+	}
+}
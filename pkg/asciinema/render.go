@@ -0,0 +1,424 @@
+package asciinema
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+/*
+Options for rendering casts to images.
+*/
+const (
+	DefaultFontSize      float64 = 14
+	DefaultLineHeight    float64 = 1.4
+	DefaultFPS           int     = 30
+	MaxFPS               int     = 50
+	DefaultIdleTimeLimit float64 = 5
+	DefaultLastFrameHold float64 = 3
+)
+
+type RenderOptions struct {
+	Format        string // gif, apng, webp, svg, mp4 or webm, guessed from extension of the output file if empty.
+	Theme         string // theme name or custom theme, theme in cast header is used if empty.
+	FontSize      float64
+	LineHeight    float64
+	FPS           int     // frames per second at most.
+	Speed         float64 // playback speed.
+	IdleTimeLimit float64 // seconds, idle_time_limit in cast header or DefaultIdleTimeLimit if 0.
+	LastFrameHold float64 // seconds the last frame is shown, DefaultLastFrameHold if 0, negative for none.
+	Resolution    string  // WIDTHxHEIGHT or WIDTH of videos, size of the canvas if empty.
+}
+
+func (o *RenderOptions) normalize(h *cast.Header) {
+	if o.FontSize <= 0 {
+		o.FontSize = DefaultFontSize
+	}
+	if o.LineHeight <= 0 {
+		o.LineHeight = DefaultLineHeight
+	}
+	if o.FPS <= 0 {
+		o.FPS = DefaultFPS
+	}
+	o.FPS = min(o.FPS, MaxFPS)
+	if o.Speed <= 0 {
+		o.Speed = 1
+	}
+	if o.IdleTimeLimit <= 0 {
+		o.IdleTimeLimit = h.IdleTimeLimit
+	}
+	if o.IdleTimeLimit <= 0 {
+		o.IdleTimeLimit = DefaultIdleTimeLimit
+	}
+	if o.LastFrameHold == 0 {
+		o.LastFrameHold = DefaultLastFrameHold
+	}
+	if o.LastFrameHold < 0 {
+		o.LastFrameHold = 0
+	}
+}
+
+func (o *RenderOptions) theme(h *cast.Header) (*Theme, error) {
+	if o.Theme == "" {
+		if theme := ThemeFromHeader(h); theme != nil {
+			return theme, nil
+		}
+	}
+	return ParseTheme(o.Theme)
+}
+
+var (
+	monoFonts     [4]*opentype.Font // regular, bold, italic, bold italic.
+	monoFontsErr  error
+	monoFontsOnce sync.Once
+)
+
+func loadMonoFonts() error {
+	monoFontsOnce.Do(func() {
+		for i, ttf := range [][]byte{gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF} {
+			if monoFonts[i], monoFontsErr = opentype.Parse(ttf); monoFontsErr != nil {
+				return
+			}
+		}
+	})
+	return monoFontsErr
+}
+
+type glyphKey struct {
+	char  rune
+	face  int
+	width int
+}
+
+type renderedCell struct {
+	cell   TermCell
+	cursor bool
+	valid  bool
+}
+
+/*
+Draws terminal screens with the embedded Go Mono font.
+Only cells changed since last drawing are redrawn.
+Go Mono has no CJK or emoji glyphs, they are drawn as boxes of their cell width.
+*/
+type ScreenRenderer struct {
+	theme    *Theme
+	faces    [4]font.Face
+	cellW    int
+	cellH    int
+	ascent   int
+	descent  int
+	baseline int
+	padding  int
+	cols     int
+	rows     int
+	canvas   *image.RGBA
+	cells    [][]renderedCell
+	glyphs   map[glyphKey]*image.Alpha
+}
+
+func NewScreenRenderer(theme *Theme, fontSize, lineHeight float64, cols, rows int) (r *ScreenRenderer, err error) {
+	if err = loadMonoFonts(); err != nil {
+		return
+	}
+	r = &ScreenRenderer{theme: theme, cols: cols, rows: rows, glyphs: map[glyphKey]*image.Alpha{}}
+	for i, f := range monoFonts {
+		if r.faces[i], err = opentype.NewFace(f, &opentype.FaceOptions{Size: fontSize, DPI: 72, Hinting: font.HintingFull}); err != nil {
+			return nil, err
+		}
+	}
+	advance, _ := r.faces[0].GlyphAdvance('M')
+	metrics := r.faces[0].Metrics()
+	r.cellW = max(advance.Round(), 1)
+	r.ascent, r.descent = metrics.Ascent.Ceil(), metrics.Descent.Ceil()
+	r.cellH = max(int(math.Ceil(fontSize*lineHeight)), r.ascent+r.descent)
+	r.baseline = (r.cellH-r.ascent-r.descent)/2 + r.ascent
+	r.padding = int(fontSize / 2)
+
+	r.canvas = image.NewRGBA(image.Rect(0, 0, cols*r.cellW+2*r.padding, rows*r.cellH+2*r.padding))
+	draw.Draw(r.canvas, r.canvas.Bounds(), &image.Uniform{theme.Background}, image.Point{}, draw.Src)
+	r.cells = make([][]renderedCell, rows)
+	for y := range r.cells {
+		r.cells[y] = make([]renderedCell, cols)
+	}
+	return
+}
+
+func (r *ScreenRenderer) Canvas() *image.RGBA {
+	return r.canvas
+}
+
+func (r *ScreenRenderer) CellSize() (w, h int) {
+	return r.cellW, r.cellH
+}
+
+// Box drawing and block elements fill the whole cell height.
+func isBoxChar(c rune) bool {
+	return c >= 0x2500 && c <= 0x259f
+}
+
+// Glyph mask of the cell size, alpha is reduced to 16 levels to keep colors of frames few.
+func (r *ScreenRenderer) glyph(c rune, faceIndex, width int) *image.Alpha {
+	key := glyphKey{c, faceIndex, width}
+	if mask, ok := r.glyphs[key]; ok {
+		return mask
+	}
+	w := r.cellW * width
+	mask := image.NewAlpha(image.Rect(0, 0, w, r.cellH))
+	face := r.faces[faceIndex]
+	dot := fixed.P(0, r.baseline)
+	if advance, ok := face.GlyphAdvance(c); ok {
+		dot.X = (fixed.I(w) - advance) / 2
+	}
+	if isBoxChar(c) {
+		dot.Y = fixed.I(r.ascent)
+	}
+	dr, m, mp, _, ok := face.Glyph(dot, c)
+	switch {
+	case !ok:
+		// missing glyph, draws a box.
+		box := image.Rect(1, r.baseline-r.ascent+1, w-1, r.baseline+r.descent-1)
+		draw.Draw(mask, box, image.Opaque, image.Point{}, draw.Src)
+		draw.Draw(mask, box.Inset(1), image.Transparent, image.Point{}, draw.Src)
+	case isBoxChar(c):
+		em := image.NewAlpha(image.Rect(0, 0, w, r.ascent+r.descent))
+		draw.DrawMask(em, dr, image.Opaque, image.Point{}, m, mp, draw.Over)
+		for y := 0; y < r.cellH; y++ {
+			srcY := y * em.Rect.Dy() / r.cellH
+			copy(mask.Pix[y*mask.Stride:y*mask.Stride+w], em.Pix[srcY*em.Stride:srcY*em.Stride+w])
+		}
+	default:
+		draw.DrawMask(mask, dr, image.Opaque, image.Point{}, m, mp, draw.Over)
+	}
+	for i, a := range mask.Pix {
+		mask.Pix[i] = uint8((int(a) + 8) / 17 * 17)
+	}
+	r.glyphs[key] = mask
+	return mask
+}
+
+func (r *ScreenRenderer) drawCell(x, y int, cell TermCell, cursor bool) image.Rectangle {
+	width := 1
+	if cell.Wide && x+1 < r.cols {
+		width = 2
+	}
+	rect := image.Rect(0, 0, r.cellW*width, r.cellH).Add(image.Pt(r.padding+x*r.cellW, r.padding+y*r.cellH))
+	fg, bg := r.theme.CellColors(cell.Style)
+	if cursor {
+		fg, bg = bg, fg
+	}
+	draw.Draw(r.canvas, rect, &image.Uniform{bg}, image.Point{}, draw.Src)
+	if cell.Char != ' ' && cell.Char != 0 && fg != bg {
+		faceIndex := 0
+		if cell.Style.Attrs&AttrBold != 0 {
+			faceIndex |= 1
+		}
+		if cell.Style.Attrs&AttrItalic != 0 {
+			faceIndex |= 2
+		}
+		draw.DrawMask(r.canvas, rect, &image.Uniform{fg}, image.Point{}, r.glyph(cell.Char, faceIndex, width), image.Point{}, draw.Over)
+	}
+	thickness := max(r.cellH/20, 1)
+	if cell.Style.Attrs&AttrUnderline != 0 {
+		lineY := rect.Min.Y + min(r.baseline+thickness+1, r.cellH-thickness)
+		draw.Draw(r.canvas, image.Rect(rect.Min.X, lineY, rect.Max.X, lineY+thickness), &image.Uniform{fg}, image.Point{}, draw.Src)
+	}
+	if cell.Style.Attrs&AttrStrike != 0 {
+		lineY := rect.Min.Y + r.baseline - r.ascent*3/10
+		draw.Draw(r.canvas, image.Rect(rect.Min.X, lineY, rect.Max.X, lineY+thickness), &image.Uniform{fg}, image.Point{}, draw.Src)
+	}
+	return rect
+}
+
+// Draws the terminal screen, returns the changed area.
+func (r *ScreenRenderer) Render(t *Terminal) (dirty image.Rectangle) {
+	blank := TermCell{Char: ' '}
+	changed := make([]bool, r.cols)
+	current := make([]renderedCell, r.cols)
+	for y := 0; y < r.rows; y++ {
+		for x := 0; x < r.cols; x++ {
+			cell := blank
+			if x < t.Cols && y < t.Rows {
+				cell = t.Cell(x, y)
+			}
+			cursor := t.CursorVisible && x == t.CursorX && y == t.CursorY
+			current[x] = renderedCell{cell: cell, cursor: cursor, valid: true}
+			changed[x] = current[x] != r.cells[y][x]
+		}
+		// both halves of a wide char are redrawn together.
+		for x := 0; x < r.cols; x++ {
+			if !changed[x] {
+				continue
+			}
+			if current[x].cell.Wide && x+1 < r.cols {
+				changed[x+1] = true
+			}
+			if current[x].cell.Char == 0 && x > 0 {
+				changed[x-1] = true
+			}
+		}
+		for x := 0; x < r.cols; x++ {
+			if !changed[x] {
+				continue
+			}
+			c := current[x]
+			if c.cell.Char == 0 && x > 0 && current[x-1].cell.Wide {
+				continue
+			}
+			if c.cell.Char == 0 {
+				c.cell = blank
+			}
+			dirty = dirty.Union(r.drawCell(x, y, c.cell, c.cursor))
+		}
+		copy(r.cells[y], current)
+	}
+	return
+}
+
+/*
+A frame of rendered cast.
+Image is the whole canvas and is reused after the frame is handled.
+*/
+type Frame struct {
+	Image    *image.RGBA
+	Rect     image.Rectangle // area changed since the previous frame.
+	Time     float64
+	Duration float64
+}
+
+// Size of the terminal, the largest one is used when the cast has "r" events.
+func castSize(c *cast.Cast) (cols, rows int) {
+	cols, rows = int(c.Header.Width), int(c.Header.Height)
+	for _, ev := range c.EventStream {
+		if ev.Type == "r" {
+			if w, h, ok := parseResize(ev.Data); ok {
+				cols, rows = max(cols, w), max(rows, h)
+			}
+		}
+	}
+	return
+}
+
+func parseResize(data string) (cols, rows int, ok bool) {
+	w, h, found := strings.Cut(data, "x")
+	if !found {
+		return
+	}
+	var err1, err2 error
+	cols, err1 = strconv.Atoi(w)
+	rows, err2 = strconv.Atoi(h)
+	return cols, rows, err1 == nil && err2 == nil && cols > 0 && rows > 0
+}
+
+// Applies an event to the terminal.
+func applyEvent(t *Terminal, ev *cast.Event) {
+	switch ev.Type {
+	case "o":
+		t.Feed(ev.Data)
+	case "r":
+		if cols, rows, ok := parseResize(ev.Data); ok {
+			t.Resize(cols, rows)
+		}
+	}
+}
+
+/*
+Replays a cast, onSlot is called with the terminal state of each 1/fps slot having events.
+
+Times are adjusted by idle time limit and speed, opts should be normalized.
+Returns the adjusted time of the last event.
+*/
+func replayCast(c *cast.Cast, opts *RenderOptions, onSlot func(term *Terminal, t float64) error) (end float64, err error) {
+	term := NewTerminal(int(c.Header.Width), int(c.Header.Height))
+	fps := float64(opts.FPS)
+	last, slot := 0.0, 0
+	for _, ev := range c.EventStream {
+		gap := math.Min(math.Max(ev.Time-last, 0), opts.IdleTimeLimit)
+		end += gap / opts.Speed
+		last = math.Max(ev.Time, last)
+		if s := int(end * fps); s > slot {
+			if err = onSlot(term, float64(slot)/fps); err != nil {
+				return
+			}
+			slot = s
+		}
+		applyEvent(term, ev)
+	}
+	err = onSlot(term, float64(slot)/fps)
+	return
+}
+
+// Options are normalized and size of the cast is checked.
+func prepareRender(c *cast.Cast, opts *RenderOptions) (theme *Theme, cols, rows int, err error) {
+	opts.normalize(&c.Header)
+	if theme, err = opts.theme(&c.Header); err != nil {
+		return
+	}
+	cols, rows = castSize(c)
+	if cols <= 0 || rows <= 0 {
+		err = fmt.Errorf("invalid terminal size: %dx%d", cols, rows)
+	}
+	return
+}
+
+/*
+Renders frames of a cast and passes them to emit in order.
+Events in the same 1/fps slot are merged into one frame, and frames without changes are dropped.
+*/
+func RenderFrames(c *cast.Cast, opts *RenderOptions, emit func(f *Frame) error) (err error) {
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+	theme, cols, rows, err := prepareRender(c, opts)
+	if err != nil {
+		return
+	}
+	sr, err := NewScreenRenderer(theme, opts.FontSize, opts.LineHeight, cols, rows)
+	if err != nil {
+		return
+	}
+
+	var pending, spare *image.RGBA
+	var pendingFrame *Frame
+	end, err := replayCast(c, opts, func(term *Terminal, t float64) error {
+		rect := sr.Render(term)
+		if rect.Empty() && pendingFrame != nil {
+			return nil
+		}
+		if pendingFrame == nil {
+			// the first frame covers the whole canvas.
+			rect = sr.Canvas().Bounds()
+		} else {
+			pendingFrame.Duration = t - pendingFrame.Time
+			if err := emit(pendingFrame); err != nil {
+				return err
+			}
+			spare = pending
+		}
+		if spare == nil {
+			spare = image.NewRGBA(sr.Canvas().Bounds())
+		}
+		copy(spare.Pix, sr.Canvas().Pix)
+		pending, spare = spare, nil
+		pendingFrame = &Frame{Image: pending, Rect: rect, Time: t}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	pendingFrame.Duration = math.Max(end-pendingFrame.Time, 0) + opts.LastFrameHold
+	return emit(pendingFrame)
+}
@@ -0,0 +1,34 @@
+package asciinema
+
+import (
+	"testing"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+)
+
+func TestRenderOptionsNormalize(t *testing.T) {
+	h := &cast.Header{IdleTimeLimit: 2}
+	tests := []struct {
+		opts       RenderOptions
+		idle, hold float64
+		fps        int
+	}{
+		{RenderOptions{}, 2, DefaultLastFrameHold, DefaultFPS},
+		{RenderOptions{IdleTimeLimit: 1, LastFrameHold: 0.5, FPS: 100}, 1, 0.5, MaxFPS},
+		{RenderOptions{LastFrameHold: -1}, 2, 0, DefaultFPS},
+	}
+	for i, tt := range tests {
+		o := tt.opts
+		o.normalize(h)
+		if o.IdleTimeLimit != tt.idle || o.LastFrameHold != tt.hold || o.FPS != tt.fps {
+			t.Errorf("%d: idle %v, hold %v, fps %d, want %v %v %d", i, o.IdleTimeLimit, o.LastFrameHold, o.FPS, tt.idle, tt.hold, tt.fps)
+		}
+		if o.FontSize != DefaultFontSize || o.LineHeight != DefaultLineHeight || o.Speed != 1 {
+			t.Errorf("%d: %+v", i, o)
+		}
+	}
+	o := &RenderOptions{}
+	if o.normalize(&cast.Header{}); o.IdleTimeLimit != DefaultIdleTimeLimit {
+		t.Errorf("idle time limit without header = %v", o.IdleTimeLimit)
+	}
+}
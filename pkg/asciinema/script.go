@@ -0,0 +1,264 @@
+package asciinema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+var ansiRegExp = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>78c]`)
+
+// Removes ANSI escape sequences.
+func StripANSI(s string) string {
+	return ansiRegExp.ReplaceAllString(s, "")
+}
+
+/*
+Runs a tape in a pty.
+
+Times of events come from a virtual clock driven by the tape only:
+typing and key presses advance it by TypingSpeed, Sleep by its duration,
+while Wait does not advance it at all. Output is stamped with the virtual time
+at which it arrives, output of the same time is merged into one event,
+so the same tape produces the same cast on any machine.
+*/
+type TapeRunner struct {
+	tape    *Tape
+	writer  *CastWriter
+	clock   time.Duration
+	buffer  []byte // output since last matched Wait.
+	pending []byte // output at current clock, not written yet.
+	stopped bool
+	lock    sync.Mutex
+	updated chan struct{}
+}
+
+func NewTapeRunner(tape *Tape) *TapeRunner {
+	return &TapeRunner{tape: tape, updated: make(chan struct{}, 1)}
+}
+
+func (r *TapeRunner) header() *CastHeader {
+	s := r.tape.Settings
+	h := &CastHeader{
+		Version: 2,
+		Width:   s.Cols,
+		Height:  s.Rows,
+		Title:   s.Title,
+		Env:     map[string]string{"SHELL": s.Shell, "TERM": "xterm-256color"},
+	}
+	// See https://reproducible-builds.org/docs/source-date-epoch/
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		h.Timestamp = epoch
+	}
+	return h
+}
+
+func (r *TapeRunner) env() (env []string) {
+	env = []string{"TERM=xterm-256color", "PS1=" + r.tape.Settings.Prompt}
+	for k, v := range r.tape.Settings.Env {
+		env = append(env, k+"="+v)
+	}
+	return
+}
+
+func (r *TapeRunner) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	if !r.stopped {
+		r.buffer = append(r.buffer, p...)
+		r.pending = append(r.pending, p...)
+	}
+	r.lock.Unlock()
+	select {
+	case r.updated <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Writes pending output, lock must be held.
+func (r *TapeRunner) flush() (err error) {
+	if len(r.pending) > 0 {
+		err = r.writer.WriteEvent(r.clock.Seconds(), "o", r.pending)
+		r.pending = nil
+	}
+	return
+}
+
+func (r *TapeRunner) advance(d time.Duration) (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	err = r.flush()
+	r.clock += d
+	return
+}
+
+// Output after this is dropped.
+func (r *TapeRunner) stop() (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = true
+	return r.flush()
+}
+
+// Waits until output matches pattern, matched output is discarded.
+func (r *TapeRunner) waitFor(pattern *regexp.Regexp, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		r.lock.Lock()
+		matched := pattern.MatchString(StripANSI(string(r.buffer)))
+		if matched {
+			r.buffer = nil
+		}
+		r.lock.Unlock()
+		if matched {
+			return nil
+		}
+		select {
+		case <-r.updated:
+		case <-timer.C:
+			return fmt.Errorf("timeout after %s waiting for /%s/", timeout, pattern)
+		}
+	}
+}
+
+func (r *TapeRunner) typeText(input *os.File, text string, speed time.Duration) (err error) {
+	for _, c := range text {
+		if err = r.advance(speed); err != nil {
+			return
+		}
+		if _, err = input.WriteString(string(c)); err != nil {
+			return
+		}
+		time.Sleep(speed)
+	}
+	return
+}
+
+func (r *TapeRunner) runStep(input *os.File, step *TapeStep) error {
+	s := r.tape.Settings
+	switch step.Action {
+	case TapeType:
+		return r.typeText(input, step.Text, s.TypingSpeed)
+	case TapePress:
+		return r.typeText(input, strings.Repeat(step.Text, step.Count), s.TypingSpeed)
+	case TapeSleep:
+		time.Sleep(step.Duration)
+		return r.advance(step.Duration)
+	case TapeWait:
+		timeout := step.Duration
+		if timeout == 0 {
+			timeout = s.WaitTimeout
+		}
+		return r.waitFor(step.Pattern, timeout)
+	}
+	return nil
+}
+
+// Runs the tape and writes events to fPath.
+func (r *TapeRunner) Run(fPath string) (err error) {
+	s := r.tape.Settings
+	if r.writer, err = NewCastWriter(fPath, r.header(), false); err != nil {
+		return
+	}
+	cmd, ptmx, err := startPty(s.Shell, s.Cols, s.Rows, r.env())
+	if err != nil {
+		r.writer.Close()
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err1 := ptmx.Read(buf)
+			if n > 0 {
+				r.Write(buf[:n])
+			}
+			if err1 != nil {
+				break
+			}
+		}
+		close(done)
+	}()
+
+	if s.Prompt != "" {
+		if err1 := r.waitFor(regexp.MustCompile(regexp.QuoteMeta(s.Prompt)), s.WaitTimeout); err1 != nil {
+			gprint.PrintWarning("prompt not found: %s", err1)
+		}
+	}
+	for _, step := range r.tape.Steps {
+		if err = r.runStep(ptmx, step); err != nil {
+			err = fmt.Errorf("line %d: %w", step.Line, err)
+			break
+		}
+	}
+
+	// lets the last output arrive before the shell is killed.
+	time.Sleep(100 * time.Millisecond)
+	if err1 := r.stop(); err == nil {
+		err = err1
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	ptmx.Close()
+	if err1 := r.writer.Close(); err == nil {
+		err = err1
+	}
+	return
+}
+
+/*
+Output file of a tape: output flag, "Output" in tape relative to the tape file,
+or the tape file with .cast extension.
+*/
+func tapeOutputPath(tapePath, output string, tape *Tape) string {
+	if output != "" {
+		return output
+	}
+	if tape.Settings.Output != "" {
+		if filepath.IsAbs(tape.Settings.Output) {
+			return tape.Settings.Output
+		}
+		return filepath.Join(filepath.Dir(tapePath), tape.Settings.Output)
+	}
+	return strings.TrimSuffix(tapePath, filepath.Ext(tapePath)) + ".cast"
+}
+
+// Records a cast from a tape script, asciinema runner is not needed.
+func RunScript(tapePath, output string) (err error) {
+	if !ptySupported {
+		return fmt.Errorf("scripts are not supported on windows")
+	}
+	f, err := os.Open(tapePath)
+	if err != nil {
+		return
+	}
+	tape, err := ParseTape(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", tapePath, err)
+	}
+	title, fPath := handleFilePath(tapeOutputPath(tapePath, output, tape))
+	if tape.Settings.Title == "" {
+		tape.Settings.Title = title
+	}
+	if err = NewTapeRunner(tape).Run(fPath); err != nil {
+		return
+	}
+	if err = AutoRedact(fPath); err != nil {
+		return
+	}
+	gprint.PrintSuccess("Cast generated: %s", fPath)
+	return
+}
@@ -0,0 +1,329 @@
+package asciinema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	autil "github.com/gvcgo/asciinema/util"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Client of asciinema.org or a self-hosted asciinema-server.
+
+Server URL: $ASCIINEMA_API_URL > asciinema_server in gvc config > asciinema.org.
+Recordings are uploaded with the install ID of this machine, which is linked to
+an account by auth, uploads are saved locally for list and delete.
+*/
+const (
+	DefaultAsciinemaServer = autil.DefaultAPIURL
+	uploadsFileName        = "uploads.json"
+)
+
+func GetAsciinemaServer() string {
+	server := os.Getenv("ASCIINEMA_API_URL")
+	if server == "" {
+		server = conf.NewGVConfig().AsciinemaServer
+	}
+	if server == "" {
+		server = DefaultAsciinemaServer
+	}
+	return strings.TrimRight(server, "/")
+}
+
+// Sets the server in gvc config, asciinema.org is used again if serverURL is empty.
+func SetAsciinemaServer(serverURL string) (err error) {
+	serverURL = strings.TrimRight(strings.TrimSpace(serverURL), "/")
+	if serverURL != "" {
+		u, err := url.Parse(serverURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid server url: %s", serverURL)
+		}
+	}
+	cfg := conf.NewGVConfig()
+	cfg.AsciinemaServer = serverURL
+	cfg.Save()
+	gprint.PrintSuccess("Asciinema server: %s", GetAsciinemaServer())
+	return
+}
+
+// Install ID of this machine, created by asciinema on first use.
+func getInstallID() (string, error) {
+	cfg, err := autil.GetConfig(map[string]string{autil.DefaultHomeEnv: GetAsciinemaWorkDir()})
+	if err != nil {
+		return "", fmt.Errorf("failed to load asciinema config: %w", err)
+	}
+	if cfg.ApiToken() == "" {
+		return "", fmt.Errorf("no install id in asciinema config")
+	}
+	return cfg.ApiToken(), nil
+}
+
+type UploadRecord struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Server     string    `json:"server"`
+	File       string    `json:"file"`
+	Title      string    `json:"title"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func getUploadsPath() string {
+	return filepath.Join(GetAsciinemaWorkDir(), uploadsFileName)
+}
+
+func loadUploads() (records []*UploadRecord) {
+	if content, err := os.ReadFile(getUploadsPath()); err == nil {
+		json.Unmarshal(content, &records)
+	}
+	return
+}
+
+func saveUploads(records []*UploadRecord) error {
+	content, _ := json.MarshalIndent(records, "", "    ")
+	return os.WriteFile(getUploadsPath(), content, 0o600)
+}
+
+type AsciinemaClient struct {
+	Server    string
+	InstallID string
+	client    *http.Client
+}
+
+func NewAsciinemaClient() (c *AsciinemaClient, err error) {
+	c = &AsciinemaClient{Server: GetAsciinemaServer()}
+	if c.InstallID, err = getInstallID(); err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := conf.NewGVConfig().LocalProxy; proxy != "" {
+		if u, err := url.Parse(proxy); err == nil {
+			transport.Proxy = http.ProxyURL(u)
+		}
+	}
+	c.client = &http.Client{Transport: transport, Timeout: 10 * time.Minute}
+	return
+}
+
+func (c *AsciinemaClient) AuthURL() string {
+	return fmt.Sprintf("%s/connect/%s", c.Server, c.InstallID)
+}
+
+// The server identifies the uploader by the password of basic auth, which is the install ID.
+func (c *AsciinemaClient) do(req *http.Request) (resp *http.Response, err error) {
+	username := os.Getenv("USER")
+	if username == "" {
+		username = os.Getenv("USERNAME")
+	}
+	req.SetBasicAuth(username, c.InstallID)
+	req.Header.Set("User-Agent", "gvc-asciinema/1.0")
+	req.Header.Set("Accept", "application/json")
+	if resp, err = c.client.Do(req); err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp, fmt.Errorf("%s responded %s: %s", c.Server, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return
+}
+
+func (c *AsciinemaClient) Upload(fPath string) (record *UploadRecord, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return
+	}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("asciicast", "ascii.cast")
+	part.Write(content)
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, c.Server+"/api/asciicasts", body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := c.do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	// json of newer servers, or the url in plain text.
+	result := struct {
+		URL     string `json:"url"`
+		Message string `json:"message"`
+	}{}
+	if json.Unmarshal(respBody, &result) != nil {
+		result.URL = strings.TrimSpace(string(respBody))
+	}
+	if result.URL == "" {
+		result.URL = resp.Header.Get("Location")
+	}
+	if result.URL == "" {
+		return nil, fmt.Errorf("no url in response of %s", c.Server)
+	}
+	if result.Message != "" {
+		gprint.PrintInfo(result.Message)
+	}
+	record = &UploadRecord{
+		ID:         path.Base(strings.TrimRight(result.URL, "/")),
+		URL:        result.URL,
+		Server:     c.Server,
+		File:       fPath,
+		UploadedAt: time.Now(),
+	}
+	if header, err := readHeaderFields(fPath); err == nil {
+		record.Title, _ = header["title"].(string)
+	}
+	return
+}
+
+func (c *AsciinemaClient) Delete(id string) (err error) {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/asciicasts/%s", c.Server, url.PathEscape(id)), nil)
+	if err != nil {
+		return
+	}
+	resp, err := c.do(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed) {
+		err = fmt.Errorf("%w\nthe recording is not found, or the server does not support deleting by api", err)
+	}
+	return
+}
+
+// Opens a url in browser, fails if there is no browser, like in ssh sessions.
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case gutils.Darwin:
+		cmd = exec.Command("open", u)
+	case gutils.Windows:
+		cmd = exec.Command("cmd", "/c", "start", u)
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return fmt.Errorf("no display")
+		}
+		for _, opener := range []string{"xdg-open", "x-www-browser", "sensible-browser"} {
+			if p, err := exec.LookPath(opener); err == nil {
+				cmd = exec.Command(p, u)
+				break
+			}
+		}
+		if cmd == nil {
+			return fmt.Errorf("no browser found")
+		}
+	}
+	return cmd.Run()
+}
+
+/*
+Uploads and management of uploaded recordings.
+*/
+func UploadCast(fPath string, redact bool) (record *UploadRecord, err error) {
+	client, err := NewAsciinemaClient()
+	if err != nil {
+		return
+	}
+	uploaded := fPath
+	if redact {
+		if uploaded, err = RedactedCopy(fPath); err != nil {
+			return
+		}
+		defer RemoveRedactedCopy(uploaded)
+	}
+	if record, err = client.Upload(uploaded); err != nil {
+		return
+	}
+	record.File = fPath
+	records := append(loadUploads(), record)
+	if err := saveUploads(records); err != nil {
+		gprint.PrintWarning("failed to save upload history: %+v", err)
+	}
+	gprint.PrintSuccess("Uploaded to %s", record.URL)
+	return
+}
+
+func ListUploads(all bool) {
+	server := GetAsciinemaServer()
+	records := []*UploadRecord{}
+	for _, r := range loadUploads() {
+		if all || r.Server == server {
+			records = append(records, r)
+		}
+	}
+	if len(records) == 0 {
+		gprint.PrintInfo("No uploads to %s.", server)
+		return
+	}
+	for _, r := range records {
+		title := r.Title
+		if title == "" {
+			title = filepath.Base(r.File)
+		}
+		fmt.Printf("%s  %s  %s  %s\n",
+			gprint.CyanStr("%-24s", r.ID),
+			r.UploadedAt.Format("2006-01-02 15:04"),
+			gprint.YellowStr("%-20s", title),
+			r.URL,
+		)
+	}
+}
+
+func findUpload(records []*UploadRecord, idOrURL string) int {
+	idOrURL = strings.TrimRight(idOrURL, "/")
+	for i, r := range records {
+		if r.ID == idOrURL || r.URL == idOrURL {
+			return i
+		}
+	}
+	return -1
+}
+
+// Deletes an uploaded recording on its server, only the local record is removed if localOnly.
+func DeleteUpload(idOrURL string, localOnly bool) (err error) {
+	records := loadUploads()
+	i := findUpload(records, idOrURL)
+	if i < 0 {
+		return fmt.Errorf("upload not found: %s, see g a list --all", idOrURL)
+	}
+	record := records[i]
+	if !localOnly {
+		client, err := NewAsciinemaClient()
+		if err != nil {
+			return err
+		}
+		client.Server = record.Server
+		if err = client.Delete(record.ID); err != nil {
+			return fmt.Errorf("%w\ndelete it at %s, then run with --local to forget it", err, record.URL)
+		}
+	}
+	if err = saveUploads(append(records[:i], records[i+1:]...)); err != nil {
+		return
+	}
+	if localOnly {
+		gprint.PrintSuccess("Removed %s from upload list", record.URL)
+	} else {
+		gprint.PrintSuccess("Deleted %s", record.URL)
+	}
+	return
+}
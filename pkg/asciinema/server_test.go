@@ -0,0 +1,321 @@
+package asciinema
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*
+A stand-in of asciinema-server, recordings are kept in memory.
+The uploader is identified by the password of basic auth, like asciinema-server does.
+*/
+type fakeServer struct {
+	*httptest.Server
+	plainText bool // responds the url in plain text like older servers.
+	mu        sync.Mutex
+	casts     map[string]*fakeCast
+	nextID    int
+}
+
+type fakeCast struct {
+	owner   string
+	content []byte
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	s := &fakeServer{casts: map[string]*fakeCast{}, nextID: 1}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/asciicasts", s.handleUpload)
+	mux.HandleFunc("DELETE /api/asciicasts/{id}", s.handleDelete)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) installID(w http.ResponseWriter, r *http.Request) (token string, ok bool) {
+	if _, token, ok = r.BasicAuth(); !ok || token == "" {
+		http.Error(w, "install id required", http.StatusUnauthorized)
+		return "", false
+	}
+	return token, true
+}
+
+func (s *fakeServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.installID(w, r)
+	if !ok {
+		return
+	}
+	file, _, err := r.FormFile("asciicast")
+	if err != nil {
+		http.Error(w, "asciicast file required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	content, _ := io.ReadAll(file)
+	header := &CastHeader{}
+	firstLine, _ := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+	if json.Unmarshal([]byte(firstLine), header) != nil || header.Version != 2 {
+		http.Error(w, "invalid asciicast", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	id := strconv.Itoa(s.nextID)
+	s.nextID++
+	s.casts[id] = &fakeCast{owner: token, content: content}
+	s.mu.Unlock()
+
+	u := fmt.Sprintf("%s/a/%s", s.URL, id)
+	w.WriteHeader(http.StatusCreated)
+	if s.plainText {
+		fmt.Fprintln(w, u)
+	} else {
+		json.NewEncoder(w).Encode(map[string]string{"url": u, "message": "View the recording at: " + u})
+	}
+}
+
+func (s *fakeServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.installID(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, found := s.casts[r.PathValue("id")]
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if c.owner != token {
+		http.Error(w, "not the owner", http.StatusForbidden)
+		return
+	}
+	delete(s.casts, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *fakeServer) cast(id string) *fakeCast {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.casts[id]
+}
+
+// Captures what f writes to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func writeTestCast(t *testing.T, dir, title string) string {
+	t.Helper()
+	fPath := filepath.Join(dir, "demo.cast")
+	content := fmt.Sprintf(`{"version": 2, "width": 80, "height": 24, "title": %q}`+"\n"+`[0.5, "o", "hello\r\n"]`+"\n", title)
+	if err := os.WriteFile(fPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fPath
+}
+
+func TestGetAsciinemaServer(t *testing.T) {
+	setTestHome(t, "{}")
+	t.Setenv("ASCIINEMA_API_URL", "")
+	if got := GetAsciinemaServer(); got != DefaultAsciinemaServer {
+		t.Errorf("default server = %s", got)
+	}
+	if err := SetAsciinemaServer("https://asc.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetAsciinemaServer(); got != "https://asc.example.com" {
+		t.Errorf("configured server = %s", got)
+	}
+	t.Setenv("ASCIINEMA_API_URL", "http://127.0.0.1:3000")
+	if got := GetAsciinemaServer(); got != "http://127.0.0.1:3000" {
+		t.Errorf("server from env = %s", got)
+	}
+
+	for _, invalid := range []string{"asc.example.com", "ftp://asc.example.com", "http://"} {
+		if err := SetAsciinemaServer(invalid); err == nil {
+			t.Errorf("SetAsciinemaServer(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestAuthURL(t *testing.T) {
+	setTestHome(t, "{}")
+	t.Setenv("ASCIINEMA_API_URL", "https://asc.example.com")
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+
+	client, err := NewAsciinemaClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.InstallID == "" {
+		t.Fatal("install id should be created on first use")
+	}
+	if got, want := client.AuthURL(), "https://asc.example.com/connect/"+client.InstallID; got != want {
+		t.Errorf("auth url = %s, want %s", got, want)
+	}
+	// the same install id is used again.
+	if again, err := getInstallID(); err != nil || again != client.InstallID {
+		t.Errorf("install id = %s, %v, want %s", again, err, client.InstallID)
+	}
+	// auth falls back to printing the url.
+	if runtime.GOOS == "linux" {
+		if err := openBrowser(client.AuthURL()); err == nil {
+			t.Error("openBrowser should fail without a display")
+		}
+	}
+}
+
+func TestUploadListDelete(t *testing.T) {
+	for _, plainText := range []bool{false, true} {
+		t.Run(fmt.Sprintf("plain text %v", plainText), func(t *testing.T) {
+			home := setTestHome(t, "{}")
+			t.Setenv("ASCIINEMA_API_URL", "")
+			server := newFakeServer(t)
+			server.plainText = plainText
+			if err := SetAsciinemaServer(server.URL); err != nil {
+				t.Fatal(err)
+			}
+			installID, err := getInstallID()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fPath := writeTestCast(t, home, "my demo")
+			record, err := UploadCast(fPath, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.ID != "1" || record.URL != server.URL+"/a/1" || record.Server != server.URL {
+				t.Errorf("record = %+v", record)
+			}
+			if record.File != fPath || record.Title != "my demo" {
+				t.Errorf("record file = %s, title = %s", record.File, record.Title)
+			}
+			uploaded := server.cast("1")
+			if uploaded == nil || uploaded.owner != installID {
+				t.Fatalf("uploaded cast = %+v, want owner %s", uploaded, installID)
+			}
+			if content, _ := os.ReadFile(fPath); !bytes.Equal(uploaded.content, content) {
+				t.Errorf("uploaded content = %q", uploaded.content)
+			}
+
+			info, err := os.Stat(getUploadsPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+				t.Errorf("uploads.json mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			// uploads to other servers are only listed with all.
+			records := append(loadUploads(), &UploadRecord{ID: "other", URL: "https://asc.example.com/a/other", Server: "https://asc.example.com"})
+			if err := saveUploads(records); err != nil {
+				t.Fatal(err)
+			}
+			out := captureStdout(t, func() { ListUploads(false) })
+			if !strings.Contains(out, record.URL) || !strings.Contains(out, "my demo") || strings.Contains(out, "other") {
+				t.Errorf("list output:\n%s", out)
+			}
+			if out := captureStdout(t, func() { ListUploads(true) }); !strings.Contains(out, "asc.example.com/a/other") {
+				t.Errorf("list --all output:\n%s", out)
+			}
+
+			if err := DeleteUpload(record.URL, false); err != nil {
+				t.Fatal(err)
+			}
+			if server.cast("1") != nil {
+				t.Error("cast should be deleted on server")
+			}
+			if records := loadUploads(); len(records) != 1 || records[0].ID != "other" {
+				t.Errorf("uploads after delete = %+v", records)
+			}
+			if err := DeleteUpload("other", true); err != nil {
+				t.Fatal(err)
+			}
+			if records := loadUploads(); len(records) != 0 {
+				t.Errorf("uploads after local delete = %+v", records)
+			}
+			if err := DeleteUpload("1", false); err == nil || !strings.Contains(err.Error(), "upload not found") {
+				t.Errorf("delete of unknown upload: %v", err)
+			}
+		})
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	home := setTestHome(t, "{}")
+	server := newFakeServer(t)
+	t.Setenv("ASCIINEMA_API_URL", server.URL)
+
+	// only v2 casts are accepted.
+	fPath := filepath.Join(home, "v1.cast")
+	os.WriteFile(fPath, []byte(`{"version": 1, "width": 80, "height": 24, "stdout": []}`+"\n"), 0o644)
+	if _, err := UploadCast(fPath, false); err == nil || !strings.Contains(err.Error(), "422") {
+		t.Errorf("upload of invalid cast: %v", err)
+	}
+	if records := loadUploads(); len(records) != 0 {
+		t.Errorf("failed upload should not be saved: %+v", records)
+	}
+
+	record, err := UploadCast(writeTestCast(t, home, ""), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// recordings of other install ids can not be deleted.
+	server.mu.Lock()
+	server.casts[record.ID].owner = "someone-else"
+	server.mu.Unlock()
+	if err := DeleteUpload(record.ID, false); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("delete of others' recording: %v", err)
+	}
+	if records := loadUploads(); len(records) != 1 {
+		t.Errorf("upload should be kept after failed delete: %+v", records)
+	}
+
+	// deleted on server already.
+	server.mu.Lock()
+	delete(server.casts, record.ID)
+	server.mu.Unlock()
+	if err := DeleteUpload(record.ID, false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("delete of missing recording: %v", err)
+	}
+
+	client, err := NewAsciinemaClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.InstallID = ""
+	if err := client.Delete(record.ID); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("delete without install id: %v", err)
+	}
+}
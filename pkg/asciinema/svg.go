@@ -0,0 +1,294 @@
+package asciinema
+
+import (
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Renders casts to SVG.
+
+Screens are drawn with text and rects, identical lines are defined once and reused.
+Animations stack all screens vertically and move the stack with CSS keyframes.
+*/
+const svgFontFamily = `'Go Mono','DejaVu Sans Mono',Menlo,Consolas,monospace`
+
+type svgRenderer struct {
+	theme    *Theme
+	fontSize float64
+	cellW    float64
+	cellH    float64
+	baseline float64
+	cols     int
+	rows     int
+	defs     strings.Builder
+	lineIDs  map[string]string
+}
+
+func newSVGRenderer(theme *Theme, opts *RenderOptions, cols, rows int) *svgRenderer {
+	r := &svgRenderer{
+		theme:    theme,
+		fontSize: opts.FontSize,
+		cellW:    opts.FontSize * 0.6,
+		cellH:    math.Ceil(opts.FontSize * opts.LineHeight),
+		cols:     cols,
+		rows:     rows,
+		lineIDs:  map[string]string{},
+	}
+	r.baseline = (r.cellH-r.fontSize)/2 + r.fontSize*0.8
+	return r
+}
+
+func svgNum(v float64) string {
+	// adding 0 turns -0 into 0.
+	return strconv.FormatFloat(math.Round(v*100)/100+0, 'f', -1, 64)
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func svgEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+type svgCellStyle struct {
+	fg, bg color.RGBA
+	attrs  CellAttrs
+}
+
+func (r *svgRenderer) cellStyle(c TermCell, cursor bool) svgCellStyle {
+	fg, bg := r.theme.CellColors(c.Style)
+	if cursor {
+		fg, bg = bg, fg
+	}
+	return svgCellStyle{fg: fg, bg: bg, attrs: c.Style.Attrs & (AttrBold | AttrItalic | AttrUnderline | AttrStrike)}
+}
+
+func (r *svgRenderer) textElement(x int, text string, s svgCellStyle) string {
+	attrs := fmt.Sprintf(`x="%s" y="%s" fill="%s"`, svgNum(float64(x)*r.cellW), svgNum(r.baseline), svgColor(s.fg))
+	if s.attrs&AttrBold != 0 {
+		attrs += ` font-weight="bold"`
+	}
+	if s.attrs&AttrItalic != 0 {
+		attrs += ` font-style="italic"`
+	}
+	decorations := []string{}
+	if s.attrs&AttrUnderline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if s.attrs&AttrStrike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		attrs += fmt.Sprintf(` text-decoration="%s"`, strings.Join(decorations, " "))
+	}
+	return fmt.Sprintf(`<text %s>%s</text>`, attrs, svgEscape(text))
+}
+
+// SVG elements of a line at y=0, cursorX is -1 if the cursor is not on it.
+func (r *svgRenderer) line(cells []TermCell, cursorX int) string {
+	styles := make([]svgCellStyle, len(cells))
+	for x, c := range cells {
+		styles[x] = r.cellStyle(c, x == cursorX || (c.Char == 0 && x-1 == cursorX))
+	}
+	var b strings.Builder
+	// backgrounds
+	for x := 0; x < len(cells); {
+		end := x + 1
+		for end < len(cells) && styles[end].bg == styles[x].bg {
+			end++
+		}
+		if styles[x].bg != r.theme.Background {
+			fmt.Fprintf(&b, `<rect x="%s" width="%s" height="%s" fill="%s"/>`,
+				svgNum(float64(x)*r.cellW), svgNum(float64(end-x)*r.cellW), svgNum(r.cellH), svgColor(styles[x].bg))
+		}
+		x = end
+	}
+	// texts, wide chars are placed one by one.
+	for x := 0; x < len(cells); {
+		c := cells[x]
+		if c.Char == 0 {
+			x++
+			continue
+		}
+		end := x + 1
+		if !c.Wide {
+			for end < len(cells) && !cells[end].Wide && cells[end].Char != 0 &&
+				styles[end].fg == styles[x].fg && styles[end].attrs == styles[x].attrs {
+				end++
+			}
+		}
+		var text strings.Builder
+		for _, cell := range cells[x:end] {
+			text.WriteRune(cell.Char)
+		}
+		content := text.String()
+		if styles[x].attrs&(AttrUnderline|AttrStrike) == 0 {
+			content = strings.TrimRight(content, " ")
+		}
+		if strings.TrimSpace(content) != "" || (content != "" && styles[x].attrs&(AttrUnderline|AttrStrike) != 0) {
+			b.WriteString(r.textElement(x, content, styles[x]))
+		}
+		x = end
+	}
+	return b.String()
+}
+
+// Id of a line defined in defs, empty for blank lines.
+func (r *svgRenderer) lineID(content string) string {
+	if content == "" {
+		return ""
+	}
+	if id, ok := r.lineIDs[content]; ok {
+		return id
+	}
+	id := fmt.Sprintf("l%d", len(r.lineIDs))
+	r.lineIDs[content] = id
+	fmt.Fprintf(&r.defs, `<g id="%s">%s</g>`, id, content)
+	return id
+}
+
+func (r *svgRenderer) screen(s *Screen, offsetY float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<g transform="translate(0,%s)">`, svgNum(offsetY))
+	for y, line := range s.Lines {
+		if y >= r.rows {
+			break
+		}
+		cursorX := -1
+		if s.CursorVisible && s.CursorY == y {
+			cursorX = s.CursorX
+		}
+		if id := r.lineID(r.line(line[:min(len(line), r.cols)], cursorX)); id != "" {
+			fmt.Fprintf(&b, `<use href="#%s" y="%s"/>`, id, svgNum(float64(y)*r.cellH))
+		}
+	}
+	b.WriteString("</g>")
+	return b.String()
+}
+
+/*
+Writes screens as SVG, screens are animated when there are more than one.
+times are start times of screens, total is the duration of the animation.
+*/
+func (r *svgRenderer) write(w io.Writer, screens []*Screen, times []float64, total float64) error {
+	padding := math.Round(r.fontSize / 2)
+	width, height := float64(r.cols)*r.cellW, float64(r.rows)*r.cellH
+	var body strings.Builder
+	for i, s := range screens {
+		body.WriteString(r.screen(s, float64(i)*height))
+	}
+	style := "text{white-space:pre}"
+	if len(screens) > 1 {
+		var frames strings.Builder
+		for i, t := range times {
+			fmt.Fprintf(&frames, "%s%%{transform:translateY(%spx)}", strconv.FormatFloat(t/total*100, 'f', 3, 64), svgNum(-float64(i)*height))
+		}
+		style += fmt.Sprintf(".a{animation:k %ss steps(1,end) infinite}@keyframes k{%s}", svgNum(total), frames.String())
+	}
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]s" height="%[2]s" viewBox="0 0 %[1]s %[2]s" font-family="%[3]s" font-size="%[4]s">`+
+		`<style>%[5]s</style><rect width="100%%" height="100%%" rx="4" fill="%[6]s"/>`+
+		`<defs>%[7]s</defs><svg x="%[8]s" y="%[8]s" width="%[9]s" height="%[10]s"><g class="a">%[11]s</g></svg></svg>`,
+		svgNum(width+2*padding), svgNum(height+2*padding), svgFontFamily, svgNum(r.fontSize),
+		style, svgColor(r.theme.Background), r.defs.String(),
+		svgNum(padding), svgNum(width), svgNum(height), body.String())
+	return err
+}
+
+// Renders a cast to an animated SVG.
+func ExportSVG(c *cast.Cast, opts *RenderOptions, w io.Writer) (err error) {
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+	theme, cols, rows, err := prepareRender(c, opts)
+	if err != nil {
+		return
+	}
+	screens, times := []*Screen{}, []float64{}
+	end, err := replayCast(c, opts, func(term *Terminal, t float64) error {
+		s := term.Snapshot()
+		if len(screens) == 0 || !s.Equal(screens[len(screens)-1]) {
+			screens, times = append(screens, s), append(times, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	total := math.Max(end+opts.LastFrameHold, times[len(times)-1]+0.1)
+	return newSVGRenderer(theme, opts, cols, rows).write(w, screens, times, total)
+}
+
+// Terminal state at the given time of the cast file.
+func TerminalAt(c *cast.Cast, at float64) *Terminal {
+	term := NewTerminal(int(c.Header.Width), int(c.Header.Height))
+	for _, ev := range c.EventStream {
+		if ev.Time > at {
+			break
+		}
+		applyEvent(term, ev)
+	}
+	return term
+}
+
+/*
+Renders the terminal state at the given seconds to SVG or PNG,
+format is guessed from extension of the output file if not specified.
+*/
+func Snapshot(fPath, outFilePath string, at float64, opts *RenderOptions) (result string, err error) {
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+	format, ext := opts.Format, strings.ToLower(filepath.Ext(outFilePath))
+	if format == "" {
+		format = FormatSvg
+		if ext == ".png" {
+			format = FormatPng
+		}
+	}
+	if format != FormatSvg && format != FormatPng {
+		return "", fmt.Errorf("unsupported snapshot format: %s, available: svg, png", format)
+	}
+	result = outFilePath
+	if ext != "."+format {
+		result += "." + format
+	}
+	c, err := LoadCast(fPath)
+	if err != nil {
+		return
+	}
+	theme, cols, rows, err := prepareRender(c, opts)
+	if err != nil {
+		return
+	}
+	term := TerminalAt(c, at)
+	f, err := os.Create(result)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if format == FormatSvg {
+		err = newSVGRenderer(theme, opts, cols, rows).write(f, []*Screen{term.Snapshot()}, nil, 0)
+	} else {
+		var sr *ScreenRenderer
+		if sr, err = NewScreenRenderer(theme, opts.FontSize, opts.LineHeight, cols, rows); err == nil {
+			sr.Render(term)
+			err = png.Encode(f, sr.Canvas())
+		}
+	}
+	if err == nil {
+		gprint.PrintSuccess("Snapshot at %ss saved to %s", svgNum(at), result)
+	}
+	return
+}
@@ -0,0 +1,265 @@
+package asciinema
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Tape files describe scripted terminal demos, one command per line:
+
+	# comments start with "#"
+	Output demo.cast
+	Set Shell "bash --noprofile --norc"
+	Set Cols 80
+	Set Rows 24
+	Set Title "demo"
+	Set Prompt "$ "
+	Set TypingSpeed 60ms
+	Set WaitTimeout 15s
+	Env GREETING "hello"
+	Type "echo $GREETING"
+	Enter
+	Wait /hello/
+	Sleep 1s
+	Press Ctrl+C 2
+
+Set and Env apply to the whole script.
+*/
+const (
+	TapeOutput = "Output"
+	TapeSet    = "Set"
+	TapeEnv    = "Env"
+	TapeType   = "Type"
+	TapePress  = "Press"
+	TapeSleep  = "Sleep"
+	TapeWait   = "Wait"
+)
+
+var TapeKeys = map[string]string{
+	"Enter":     "\r",
+	"Tab":       "\t",
+	"Space":     " ",
+	"Backspace": "\x7f",
+	"Escape":    "\x1b",
+	"Up":        "\x1b[A",
+	"Down":      "\x1b[B",
+	"Right":     "\x1b[C",
+	"Left":      "\x1b[D",
+	"Home":      "\x1b[H",
+	"End":       "\x1b[F",
+	"Delete":    "\x1b[3~",
+}
+
+type TapeSettings struct {
+	Output      string
+	Shell       string
+	Cols        int
+	Rows        int
+	Title       string
+	Prompt      string
+	TypingSpeed time.Duration
+	WaitTimeout time.Duration
+	Env         map[string]string
+}
+
+type TapeStep struct {
+	Line     int
+	Action   string         // Type, Press, Sleep or Wait.
+	Text     string         // text to type or key sequence to press.
+	Count    int            // times to press.
+	Duration time.Duration  // sleep duration or wait timeout.
+	Pattern  *regexp.Regexp // pattern to wait for.
+}
+
+type Tape struct {
+	Settings TapeSettings
+	Steps    []*TapeStep
+}
+
+func NewTape() *Tape {
+	return &Tape{
+		Settings: TapeSettings{
+			Shell:       "bash --noprofile --norc",
+			Cols:        80,
+			Rows:        24,
+			Prompt:      "$ ",
+			TypingSpeed: 50 * time.Millisecond,
+			WaitTimeout: 15 * time.Second,
+			Env:         map[string]string{},
+		},
+	}
+}
+
+// Splits a line into words, double-quoted strings and /regexp/ are kept as a whole.
+func splitTapeLine(line string) (words []string, err error) {
+	line = strings.TrimSpace(line)
+	for line != "" {
+		var word string
+		switch line[0] {
+		case '"':
+			var prefix string
+			if prefix, err = strconv.QuotedPrefix(line); err != nil {
+				return nil, fmt.Errorf("unterminated string: %s", line)
+			}
+			word, _ = strconv.Unquote(prefix)
+			line = line[len(prefix):]
+		case '/':
+			end := strings.LastIndex(line, "/")
+			if end == 0 {
+				return nil, fmt.Errorf("unterminated regexp: %s", line)
+			}
+			word, line = line[:end+1], line[end+1:]
+		default:
+			idx := strings.IndexAny(line, " \t")
+			if idx < 0 {
+				idx = len(line)
+			}
+			word, line = line[:idx], line[idx:]
+		}
+		words = append(words, word)
+		line = strings.TrimLeft(line, " \t")
+	}
+	return
+}
+
+// Durations like "500ms", "2s", or seconds without unit.
+func parseTapeDuration(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Keys like "Enter", "Ctrl+C" or a single character.
+func parseTapeKey(key string) (string, error) {
+	if seq, ok := TapeKeys[key]; ok {
+		return seq, nil
+	}
+	if strings.HasPrefix(strings.ToLower(key), "ctrl+") && len(key) == 6 {
+		c := strings.ToUpper(key[5:])[0]
+		if c >= '@' && c <= '_' {
+			return string([]byte{c - '@'}), nil
+		}
+	}
+	if len([]rune(key)) == 1 {
+		return key, nil
+	}
+	return "", fmt.Errorf("unknown key: %s", key)
+}
+
+func (t *Tape) parseSet(words []string) (err error) {
+	if len(words) != 3 {
+		return fmt.Errorf("usage: Set <name> <value>")
+	}
+	s := &t.Settings
+	name, value := words[1], words[2]
+	switch name {
+	case "Shell":
+		s.Shell = value
+	case "Cols", "Width":
+		s.Cols, err = strconv.Atoi(value)
+	case "Rows", "Height":
+		s.Rows, err = strconv.Atoi(value)
+	case "Title":
+		s.Title = value
+	case "Prompt":
+		s.Prompt = value
+	case "TypingSpeed":
+		s.TypingSpeed, err = parseTapeDuration(value)
+	case "WaitTimeout":
+		s.WaitTimeout, err = parseTapeDuration(value)
+	default:
+		err = fmt.Errorf("unknown setting: %s", name)
+	}
+	return
+}
+
+func (t *Tape) parseLine(lineNum int, line string) (err error) {
+	words, err := splitTapeLine(line)
+	if err != nil || len(words) == 0 {
+		return
+	}
+	step := &TapeStep{Line: lineNum, Action: words[0], Count: 1}
+	switch words[0] {
+	case TapeOutput:
+		if len(words) != 2 {
+			return fmt.Errorf("usage: Output <file.cast>")
+		}
+		t.Settings.Output = words[1]
+		return
+	case TapeSet:
+		return t.parseSet(words)
+	case TapeEnv:
+		if len(words) != 3 {
+			return fmt.Errorf("usage: Env <name> <value>")
+		}
+		t.Settings.Env[words[1]] = words[2]
+		return
+	case TapeType:
+		if len(words) != 2 {
+			return fmt.Errorf(`usage: Type "text"`)
+		}
+		step.Text = words[1]
+	case TapeSleep:
+		if len(words) != 2 {
+			return fmt.Errorf("usage: Sleep <duration>")
+		}
+		step.Duration, err = parseTapeDuration(words[1])
+	case TapeWait:
+		if len(words) < 2 || len(words) > 3 {
+			return fmt.Errorf("usage: Wait /regexp/ [timeout]")
+		}
+		pattern := strings.TrimSuffix(strings.TrimPrefix(words[1], "/"), "/")
+		if step.Pattern, err = regexp.Compile(pattern); err != nil {
+			return
+		}
+		if len(words) == 3 {
+			step.Duration, err = parseTapeDuration(words[2])
+		}
+	default:
+		// "Press <key> [count]", or key names used as commands like "Enter 2".
+		keyWords := words
+		if words[0] == TapePress {
+			keyWords = words[1:]
+		}
+		if len(keyWords) == 0 || len(keyWords) > 2 {
+			return fmt.Errorf("usage: Press <key> [count]")
+		}
+		step.Action = TapePress
+		if step.Text, err = parseTapeKey(keyWords[0]); err != nil {
+			return
+		}
+		if len(keyWords) == 2 {
+			if step.Count, err = strconv.Atoi(keyWords[1]); err != nil {
+				return
+			}
+		}
+	}
+	if err == nil {
+		t.Steps = append(t.Steps, step)
+	}
+	return
+}
+
+func ParseTape(r io.Reader) (t *Tape, err error) {
+	t = NewTape()
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err = t.parseLine(lineNum, line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	return t, scanner.Err()
+}
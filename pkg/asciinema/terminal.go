@@ -0,0 +1,916 @@
+package asciinema
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+/*
+A VT100/xterm terminal emulator, replays output of casts into a screen of cells.
+
+Supported: cursor movement, erasing, inserting and deleting, scroll regions,
+SGR with 16/256/true colors, alternate screen, DEC line drawing charset,
+tab stops, wide characters and resizing. Queries and unknown sequences are ignored.
+*/
+const (
+	ColorDefault uint8 = iota
+	ColorIndexed
+	ColorRGB
+)
+
+type TermColor struct {
+	Type    uint8
+	Index   uint8
+	R, G, B uint8
+}
+
+type CellAttrs uint8
+
+const (
+	AttrBold CellAttrs = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+type CellStyle struct {
+	FG    TermColor
+	BG    TermColor
+	Attrs CellAttrs
+}
+
+type TermCell struct {
+	Char  rune // 0 for the right half of a wide char.
+	Wide  bool
+	Style CellStyle
+}
+
+type savedCursor struct {
+	x, y       int
+	style      CellStyle
+	originMode bool
+	charsets   [2]bool
+	charset    int
+}
+
+// States of the escape sequence parser.
+const (
+	stateGround = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateString // DCS, SOS, PM and APC, ignored.
+)
+
+type Terminal struct {
+	Cols          int
+	Rows          int
+	CursorX       int
+	CursorY       int
+	CursorVisible bool
+	Title         string
+
+	lines       [][]TermCell
+	primary     [][]TermCell
+	alternate   [][]TermCell
+	altActive   bool
+	style       CellStyle
+	wrapPending bool
+	autoWrap    bool
+	originMode  bool
+	insertMode  bool
+	top         int // scroll region
+	bottom      int
+	tabs        []bool
+	charsets    [2]bool // G0 and G1, true for DEC line drawing.
+	charset     int
+	saved       savedCursor
+	lastChar    rune
+
+	state        int
+	params       []byte
+	intermediate []byte
+	oscData      []byte
+	escSeen      bool // ESC in OSC or string state.
+}
+
+func NewTerminal(cols, rows int) *Terminal {
+	t := &Terminal{}
+	t.reset(cols, rows)
+	return t
+}
+
+func (t *Terminal) reset(cols, rows int) {
+	*t = Terminal{Cols: cols, Rows: rows, CursorVisible: true, autoWrap: true}
+	t.primary = t.newScreen()
+	t.alternate = t.newScreen()
+	t.lines = t.primary
+	t.bottom = rows - 1
+	t.resetTabs()
+}
+
+func (t *Terminal) blank() TermCell {
+	return TermCell{Char: ' ', Style: CellStyle{BG: t.style.BG}}
+}
+
+func (t *Terminal) newLine() []TermCell {
+	line := make([]TermCell, t.Cols)
+	b := t.blank()
+	for i := range line {
+		line[i] = b
+	}
+	return line
+}
+
+func (t *Terminal) newScreen() [][]TermCell {
+	s := make([][]TermCell, t.Rows)
+	for i := range s {
+		s[i] = t.newLine()
+	}
+	return s
+}
+
+func (t *Terminal) resetTabs() {
+	t.tabs = make([]bool, t.Cols)
+	for i := 8; i < t.Cols; i += 8 {
+		t.tabs[i] = true
+	}
+}
+
+// Cell at column x and row y of current screen.
+func (t *Terminal) Cell(x, y int) TermCell {
+	return t.lines[y][x]
+}
+
+// Text of a row with trailing spaces removed.
+func (t *Terminal) LineText(y int) string {
+	var b strings.Builder
+	for _, c := range t.lines[y] {
+		if c.Char != 0 {
+			b.WriteRune(c.Char)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// A copy of the terminal screen.
+type Screen struct {
+	Cols          int
+	Rows          int
+	Lines         [][]TermCell
+	CursorX       int
+	CursorY       int
+	CursorVisible bool
+}
+
+func (t *Terminal) Snapshot() *Screen {
+	s := &Screen{Cols: t.Cols, Rows: t.Rows, CursorX: t.CursorX, CursorY: t.CursorY, CursorVisible: t.CursorVisible}
+	s.Lines = make([][]TermCell, len(t.lines))
+	for y, line := range t.lines {
+		s.Lines[y] = append([]TermCell{}, line...)
+	}
+	return s
+}
+
+func (s *Screen) Equal(o *Screen) bool {
+	if s.Cols != o.Cols || s.Rows != o.Rows || s.CursorVisible != o.CursorVisible ||
+		(s.CursorVisible && (s.CursorX != o.CursorX || s.CursorY != o.CursorY)) {
+		return false
+	}
+	for y, line := range s.Lines {
+		for x, c := range line {
+			if c != o.Lines[y][x] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Resizes the terminal, content is kept from the top left corner.
+func (t *Terminal) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 || (cols == t.Cols && rows == t.Rows) {
+		return
+	}
+	resize := func(screen [][]TermCell) [][]TermCell {
+		oldCols := t.Cols
+		t.Cols = cols
+		result := make([][]TermCell, rows)
+		for y := range result {
+			line := t.newLine()
+			if y < len(screen) {
+				copy(line, screen[y][:min(oldCols, cols)])
+			}
+			result[y] = line
+		}
+		t.Cols = oldCols
+		return result
+	}
+	t.primary, t.alternate = resize(t.primary), resize(t.alternate)
+	t.Cols, t.Rows = cols, rows
+	if t.altActive {
+		t.lines = t.alternate
+	} else {
+		t.lines = t.primary
+	}
+	t.top, t.bottom = 0, rows-1
+	t.resetTabs()
+	t.CursorX, t.CursorY = min(t.CursorX, cols-1), min(t.CursorY, rows-1)
+	t.wrapPending = false
+}
+
+// Feeds output of the program.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.Feed(string(p))
+	return len(p), nil
+}
+
+func (t *Terminal) Feed(data string) {
+	for _, r := range data {
+		t.handle(r)
+	}
+}
+
+func (t *Terminal) handle(r rune) {
+	switch t.state {
+	case stateOSC, stateString:
+		t.handleString(r)
+		return
+	}
+	// C0 controls are executed inside escape sequences as well.
+	if r == 0x1b {
+		t.enterEscape()
+		return
+	} else if r < 0x20 {
+		t.control(r)
+		return
+	}
+	switch t.state {
+	case stateGround:
+		if r != 0x7f {
+			t.print(r)
+		}
+	case stateEscape:
+		t.escape(r)
+	case stateEscapeIntermediate:
+		t.escapeIntermediate(r)
+	case stateCSI:
+		t.csiByte(r)
+	}
+}
+
+func (t *Terminal) enterEscape() {
+	t.state = stateEscape
+	t.params = t.params[:0]
+	t.intermediate = t.intermediate[:0]
+}
+
+func (t *Terminal) handleString(r rune) {
+	switch {
+	case r == 0x07 && t.state == stateOSC:
+		t.endOSC()
+	case r == 0x1b:
+		t.escSeen = true
+		return
+	case t.escSeen && r == '\\':
+		if t.state == stateOSC {
+			t.endOSC()
+		}
+		t.state = stateGround
+	case t.escSeen:
+		// an unterminated string is ended by a new escape sequence.
+		if t.state == stateOSC {
+			t.endOSC()
+		}
+		t.escSeen = false
+		t.enterEscape()
+		t.escape(r)
+		return
+	case t.state == stateOSC:
+		t.oscData = append(t.oscData, string(r)...)
+	}
+	t.escSeen = false
+}
+
+func (t *Terminal) endOSC() {
+	code, text, _ := strings.Cut(string(t.oscData), ";")
+	if code == "0" || code == "2" {
+		t.Title = text
+	}
+	t.oscData = t.oscData[:0]
+	t.state = stateGround
+}
+
+func (t *Terminal) control(r rune) {
+	switch r {
+	case 0x08: // BS
+		if t.CursorX > 0 {
+			t.CursorX--
+		}
+		t.wrapPending = false
+	case 0x09: // HT
+		t.tab(1)
+	case 0x0a, 0x0b, 0x0c: // LF, VT, FF
+		t.index()
+	case 0x0d: // CR
+		t.CursorX = 0
+		t.wrapPending = false
+	case 0x0e: // SO
+		t.charset = 1
+	case 0x0f: // SI
+		t.charset = 0
+	case 0x18, 0x1a: // CAN, SUB
+		t.state = stateGround
+	}
+}
+
+var lineDrawing = map[rune]rune{
+	'`': '◆', 'a': '▒', 'b': '␉', 'c': '␌', 'd': '␍', 'e': '␊', 'f': '°', 'g': '±',
+	'h': '␤', 'i': '␋', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼', 'o': '⎺',
+	'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·', '_': ' ',
+}
+
+func (t *Terminal) print(r rune) {
+	if t.charsets[t.charset] {
+		if c, ok := lineDrawing[r]; ok {
+			r = c
+		}
+	}
+	width := runewidth.RuneWidth(r)
+	if width == 0 {
+		// combining characters are not supported.
+		return
+	}
+	if t.wrapPending && t.autoWrap {
+		t.CursorX = 0
+		t.index()
+	}
+	t.wrapPending = false
+	if width == 2 && t.CursorX == t.Cols-1 {
+		if !t.autoWrap || t.Cols < 2 {
+			return
+		}
+		t.clearWide(t.CursorX, t.CursorY)
+		t.lines[t.CursorY][t.CursorX] = t.blank()
+		t.CursorX = 0
+		t.index()
+	}
+	if t.insertMode {
+		t.insertChars(width)
+	}
+	line := t.lines[t.CursorY]
+	t.clearWide(t.CursorX, t.CursorY)
+	if width == 2 {
+		t.clearWide(t.CursorX+1, t.CursorY)
+		line[t.CursorX+1] = TermCell{Style: t.style}
+	}
+	line[t.CursorX] = TermCell{Char: r, Wide: width == 2, Style: t.style}
+	t.lastChar = r
+	if t.CursorX+width >= t.Cols {
+		t.CursorX = t.Cols - 1
+		t.wrapPending = t.autoWrap
+	} else {
+		t.CursorX += width
+	}
+}
+
+// Removes the other half of a wide char at x before the cell is overwritten.
+func (t *Terminal) clearWide(x, y int) {
+	line := t.lines[y]
+	if x < 0 || x >= len(line) {
+		return
+	}
+	if line[x].Wide && x+1 < len(line) {
+		line[x+1] = t.blank()
+	} else if line[x].Char == 0 && x > 0 {
+		line[x-1] = t.blank()
+	}
+}
+
+func (t *Terminal) index() {
+	if t.CursorY == t.bottom {
+		t.scrollUp(1)
+	} else if t.CursorY < t.Rows-1 {
+		t.CursorY++
+	}
+	t.wrapPending = false
+}
+
+func (t *Terminal) reverseIndex() {
+	if t.CursorY == t.top {
+		t.scrollDown(1)
+	} else if t.CursorY > 0 {
+		t.CursorY--
+	}
+	t.wrapPending = false
+}
+
+// Scrolls lines in scroll region up by n.
+func (t *Terminal) scrollUp(n int) {
+	t.deleteLinesAt(t.top, n)
+}
+
+// Scrolls lines in scroll region down by n.
+func (t *Terminal) scrollDown(n int) {
+	t.insertLinesAt(t.top, n)
+}
+
+func (t *Terminal) deleteLinesAt(y, n int) {
+	n = min(n, t.bottom-y+1)
+	region := t.lines[y : t.bottom+1]
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = t.newLine()
+	}
+}
+
+func (t *Terminal) insertLinesAt(y, n int) {
+	n = min(n, t.bottom-y+1)
+	region := t.lines[y : t.bottom+1]
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = t.newLine()
+	}
+}
+
+func (t *Terminal) insertChars(n int) {
+	line := t.lines[t.CursorY]
+	n = min(n, t.Cols-t.CursorX)
+	copy(line[t.CursorX+n:], line[t.CursorX:])
+	for i := t.CursorX; i < t.CursorX+n; i++ {
+		line[i] = t.blank()
+	}
+}
+
+func (t *Terminal) deleteChars(n int) {
+	line := t.lines[t.CursorY]
+	n = min(n, t.Cols-t.CursorX)
+	copy(line[t.CursorX:], line[t.CursorX+n:])
+	for i := t.Cols - n; i < t.Cols; i++ {
+		line[i] = t.blank()
+	}
+}
+
+func (t *Terminal) erase(y, from, to int) {
+	line := t.lines[y]
+	from, to = max(from, 0), min(to, t.Cols)
+	t.clearWide(from, y)
+	t.clearWide(to-1, y)
+	for x := from; x < to; x++ {
+		line[x] = t.blank()
+	}
+}
+
+func (t *Terminal) tab(n int) {
+	for ; n > 0 && t.CursorX < t.Cols-1; n-- {
+		t.CursorX++
+		for t.CursorX < t.Cols-1 && !t.tabs[t.CursorX] {
+			t.CursorX++
+		}
+	}
+	t.wrapPending = false
+}
+
+func (t *Terminal) backTab(n int) {
+	for ; n > 0 && t.CursorX > 0; n-- {
+		t.CursorX--
+		for t.CursorX > 0 && !t.tabs[t.CursorX] {
+			t.CursorX--
+		}
+	}
+	t.wrapPending = false
+}
+
+// Moves cursor, y is relative to the scroll region in origin mode.
+func (t *Terminal) moveTo(x, y int) {
+	minY, maxY := 0, t.Rows-1
+	if t.originMode {
+		y += t.top
+		minY, maxY = t.top, t.bottom
+	}
+	t.CursorX = max(0, min(x, t.Cols-1))
+	t.CursorY = max(minY, min(y, maxY))
+	t.wrapPending = false
+}
+
+func (t *Terminal) saveCursor() {
+	t.saved = savedCursor{
+		x: t.CursorX, y: t.CursorY, style: t.style,
+		originMode: t.originMode, charsets: t.charsets, charset: t.charset,
+	}
+}
+
+func (t *Terminal) restoreCursor() {
+	s := t.saved
+	t.CursorX, t.CursorY = min(s.x, t.Cols-1), min(s.y, t.Rows-1)
+	t.style, t.originMode, t.charsets, t.charset = s.style, s.originMode, s.charsets, s.charset
+	t.wrapPending = false
+}
+
+func (t *Terminal) switchScreen(alt, clear bool) {
+	if alt == t.altActive {
+		return
+	}
+	t.altActive = alt
+	if alt {
+		t.lines = t.alternate
+		if clear {
+			for y := range t.lines {
+				t.lines[y] = t.newLine()
+			}
+		}
+	} else {
+		t.lines = t.primary
+	}
+}
+
+func (t *Terminal) escape(r rune) {
+	t.state = stateGround
+	switch r {
+	case '[':
+		t.state = stateCSI
+	case ']':
+		t.state = stateOSC
+		t.oscData = t.oscData[:0]
+	case 'P', 'X', '^', '_':
+		t.state = stateString
+	case '7':
+		t.saveCursor()
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.index()
+	case 'E':
+		t.CursorX = 0
+		t.index()
+	case 'M':
+		t.reverseIndex()
+	case 'H':
+		t.tabs[t.CursorX] = true
+	case 'c':
+		t.reset(t.Cols, t.Rows)
+	default:
+		if r >= 0x20 && r <= 0x2f {
+			t.intermediate = append(t.intermediate, byte(r))
+			t.state = stateEscapeIntermediate
+		}
+	}
+}
+
+func (t *Terminal) escapeIntermediate(r rune) {
+	if r >= 0x20 && r <= 0x2f {
+		t.intermediate = append(t.intermediate, byte(r))
+		return
+	}
+	t.state = stateGround
+	switch string(t.intermediate) {
+	case "(":
+		t.charsets[0] = r == '0'
+	case ")":
+		t.charsets[1] = r == '0'
+	case "#":
+		if r == '8' {
+			// DECALN, fills screen with "E".
+			for y := range t.lines {
+				for x := range t.lines[y] {
+					t.lines[y][x] = TermCell{Char: 'E'}
+				}
+			}
+		}
+	}
+}
+
+func (t *Terminal) csiByte(r rune) {
+	switch {
+	case r >= 0x30 && r <= 0x3f:
+		t.params = append(t.params, byte(r))
+	case r >= 0x20 && r <= 0x2f:
+		t.intermediate = append(t.intermediate, byte(r))
+	case r >= 0x40 && r <= 0x7e:
+		t.state = stateGround
+		t.csi(r)
+	default:
+		t.state = stateGround
+	}
+}
+
+// Parameters of a CSI sequence, subparameters are separated by ":", -1 for defaults.
+func parseCSIParams(raw string) (private byte, params [][]int) {
+	if raw != "" && raw[0] >= 0x3c && raw[0] <= 0x3f {
+		private, raw = raw[0], raw[1:]
+	}
+	if raw == "" {
+		return
+	}
+	for _, p := range strings.Split(raw, ";") {
+		sub := []int{}
+		for _, s := range strings.Split(p, ":") {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				n = -1
+			}
+			sub = append(sub, n)
+		}
+		params = append(params, sub)
+	}
+	return
+}
+
+func param(params [][]int, i, def int) int {
+	if i >= len(params) || params[i][0] <= 0 {
+		return def
+	}
+	return params[i][0]
+}
+
+func (t *Terminal) csi(final rune) {
+	private, params := parseCSIParams(string(t.params))
+	if len(t.intermediate) > 0 {
+		// DECSCUSR, DECSTR and others are ignored.
+		if string(t.intermediate) == "!" && final == 'p' {
+			t.softReset()
+		}
+		return
+	}
+	if private != 0 && private != '?' {
+		return
+	}
+	n := param(params, 0, 1)
+	switch final {
+	case '@':
+		t.insertChars(n)
+	case 'A':
+		t.moveRelative(0, -n)
+	case 'B', 'e':
+		t.moveRelative(0, n)
+	case 'C', 'a':
+		t.moveRelative(n, 0)
+	case 'D':
+		t.moveRelative(-n, 0)
+	case 'E':
+		t.moveRelative(0, n)
+		t.CursorX = 0
+	case 'F':
+		t.moveRelative(0, -n)
+		t.CursorX = 0
+	case 'G', '`':
+		t.CursorX = max(0, min(n-1, t.Cols-1))
+		t.wrapPending = false
+	case 'H', 'f':
+		t.moveTo(param(params, 1, 1)-1, n-1)
+	case 'I':
+		t.tab(n)
+	case 'Z':
+		t.backTab(n)
+	case 'J':
+		t.eraseDisplay(param(params, 0, 0))
+	case 'K':
+		switch param(params, 0, 0) {
+		case 0:
+			t.erase(t.CursorY, t.CursorX, t.Cols)
+		case 1:
+			t.erase(t.CursorY, 0, t.CursorX+1)
+		case 2:
+			t.erase(t.CursorY, 0, t.Cols)
+		}
+	case 'L':
+		if t.CursorY >= t.top && t.CursorY <= t.bottom {
+			t.insertLinesAt(t.CursorY, n)
+			t.CursorX = 0
+		}
+	case 'M':
+		if t.CursorY >= t.top && t.CursorY <= t.bottom {
+			t.deleteLinesAt(t.CursorY, n)
+			t.CursorX = 0
+		}
+	case 'P':
+		t.deleteChars(n)
+	case 'S':
+		t.scrollUp(n)
+	case 'T':
+		if private == 0 {
+			t.scrollDown(n)
+		}
+	case 'X':
+		t.erase(t.CursorY, t.CursorX, t.CursorX+n)
+	case 'b':
+		if t.lastChar != 0 {
+			for i := 0; i < min(n, t.Cols*t.Rows); i++ {
+				t.print(t.lastChar)
+			}
+		}
+	case 'd':
+		t.moveTo(t.CursorX, n-1)
+	case 'g':
+		switch param(params, 0, 0) {
+		case 0:
+			t.tabs[t.CursorX] = false
+		case 3:
+			t.tabs = make([]bool, t.Cols)
+		}
+	case 'h', 'l':
+		for _, p := range params {
+			t.setMode(private, p[0], final == 'h')
+		}
+	case 'm':
+		if private == 0 {
+			t.sgr(params)
+		}
+	case 'r':
+		if private == 0 {
+			top, bottom := param(params, 0, 1)-1, param(params, 1, t.Rows)-1
+			if bottom > t.Rows-1 {
+				bottom = t.Rows - 1
+			}
+			if top < bottom {
+				t.top, t.bottom = top, bottom
+				t.moveTo(0, 0)
+			}
+		}
+	case 's':
+		t.saveCursor()
+	case 'u':
+		t.restoreCursor()
+	}
+}
+
+func (t *Terminal) moveRelative(dx, dy int) {
+	minY, maxY := 0, t.Rows-1
+	// cursor stops at margins when it is inside the scroll region.
+	if t.CursorY >= t.top && t.CursorY <= t.bottom {
+		minY, maxY = t.top, t.bottom
+	}
+	t.CursorX = max(0, min(t.CursorX+dx, t.Cols-1))
+	t.CursorY = max(minY, min(t.CursorY+dy, maxY))
+	t.wrapPending = false
+}
+
+func (t *Terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.erase(t.CursorY, t.CursorX, t.Cols)
+		for y := t.CursorY + 1; y < t.Rows; y++ {
+			t.lines[y] = t.newLine()
+		}
+	case 1:
+		for y := 0; y < t.CursorY; y++ {
+			t.lines[y] = t.newLine()
+		}
+		t.erase(t.CursorY, 0, t.CursorX+1)
+	case 2, 3:
+		for y := range t.lines {
+			t.lines[y] = t.newLine()
+		}
+	}
+}
+
+func (t *Terminal) softReset() {
+	t.CursorVisible, t.autoWrap, t.originMode, t.insertMode = true, true, false, false
+	t.top, t.bottom = 0, t.Rows-1
+	t.style = CellStyle{}
+	t.charsets, t.charset = [2]bool{}, 0
+}
+
+func (t *Terminal) setMode(private byte, mode int, on bool) {
+	if private == 0 {
+		if mode == 4 {
+			t.insertMode = on
+		}
+		return
+	}
+	switch mode {
+	case 6:
+		t.originMode = on
+		t.moveTo(0, 0)
+	case 7:
+		t.autoWrap = on
+	case 25:
+		t.CursorVisible = on
+	case 47:
+		t.switchScreen(on, false)
+	case 1047:
+		if !on && t.altActive {
+			t.eraseDisplay(2)
+		}
+		t.switchScreen(on, false)
+	case 1049:
+		if on {
+			t.saveCursor()
+			t.switchScreen(true, true)
+		} else {
+			t.switchScreen(false, false)
+			t.restoreCursor()
+		}
+	}
+}
+
+// Extended colors: "38;5;n", "38;2;r;g;b" or colon separated forms like "38:2::r:g:b".
+func extendedColor(params [][]int, i int) (c TermColor, next int, ok bool) {
+	values := params[i][1:]
+	next = i + 1
+	if len(values) == 0 {
+		// semicolon form, values follow as parameters.
+		for j := i + 1; j < len(params) && j < i+5; j++ {
+			values = append(values, params[j][0])
+		}
+		switch {
+		case len(values) >= 2 && values[0] == 5:
+			next = i + 3
+		case len(values) >= 4 && values[0] == 2:
+			next = i + 5
+		}
+	} else if len(values) == 5 && values[0] == 2 {
+		// colon form with color space id.
+		values = append(values[:1], values[2:]...)
+	}
+	switch {
+	case len(values) >= 2 && values[0] == 5 && values[1] >= 0:
+		return TermColor{Type: ColorIndexed, Index: uint8(values[1])}, next, true
+	case len(values) >= 4 && values[0] == 2:
+		return TermColor{Type: ColorRGB, R: uint8(max(values[1], 0)), G: uint8(max(values[2], 0)), B: uint8(max(values[3], 0))}, next, true
+	}
+	return c, next, false
+}
+
+func (t *Terminal) sgr(params [][]int) {
+	if len(params) == 0 {
+		t.style = CellStyle{}
+		return
+	}
+	s := &t.style
+	for i := 0; i < len(params); {
+		p := max(params[i][0], 0)
+		next := i + 1
+		switch {
+		case p == 0:
+			*s = CellStyle{}
+		case p == 1:
+			s.Attrs |= AttrBold
+		case p == 2:
+			s.Attrs |= AttrDim
+		case p == 3:
+			s.Attrs |= AttrItalic
+		case p == 4:
+			if len(params[i]) > 1 && params[i][1] == 0 {
+				s.Attrs &^= AttrUnderline
+			} else {
+				s.Attrs |= AttrUnderline
+			}
+		case p == 5 || p == 6:
+			s.Attrs |= AttrBlink
+		case p == 7:
+			s.Attrs |= AttrReverse
+		case p == 8:
+			s.Attrs |= AttrHidden
+		case p == 9:
+			s.Attrs |= AttrStrike
+		case p == 21:
+			s.Attrs |= AttrUnderline
+		case p == 22:
+			s.Attrs &^= AttrBold | AttrDim
+		case p == 23:
+			s.Attrs &^= AttrItalic
+		case p == 24:
+			s.Attrs &^= AttrUnderline
+		case p == 25:
+			s.Attrs &^= AttrBlink
+		case p == 27:
+			s.Attrs &^= AttrReverse
+		case p == 28:
+			s.Attrs &^= AttrHidden
+		case p == 29:
+			s.Attrs &^= AttrStrike
+		case p >= 30 && p <= 37:
+			s.FG = TermColor{Type: ColorIndexed, Index: uint8(p - 30)}
+		case p == 38:
+			if c, n, ok := extendedColor(params, i); ok {
+				s.FG = c
+				next = n
+			}
+		case p == 39:
+			s.FG = TermColor{}
+		case p >= 40 && p <= 47:
+			s.BG = TermColor{Type: ColorIndexed, Index: uint8(p - 40)}
+		case p == 48:
+			if c, n, ok := extendedColor(params, i); ok {
+				s.BG = c
+				next = n
+			}
+		case p == 49:
+			s.BG = TermColor{}
+		case p >= 90 && p <= 97:
+			s.FG = TermColor{Type: ColorIndexed, Index: uint8(p - 90 + 8)}
+		case p >= 100 && p <= 107:
+			s.BG = TermColor{Type: ColorIndexed, Index: uint8(p - 100 + 8)}
+		}
+		i = next
+	}
+}
@@ -0,0 +1,123 @@
+package asciinema
+
+import (
+	"strings"
+	"testing"
+)
+
+// Rows of the screen joined by "|", trailing spaces removed.
+func screenText(t *Terminal) string {
+	rows := make([]string, t.Rows)
+	for y := range rows {
+		rows[y] = t.LineText(y)
+	}
+	return strings.Join(rows, "|")
+}
+
+func TestTerminal(t *testing.T) {
+	tests := []struct {
+		name    string
+		cols    int
+		rows    int
+		input   string
+		want    string
+		cursorX int
+		cursorY int
+	}{
+		{"print", 10, 3, "hello", "hello||", 5, 0},
+		{"crlf", 10, 3, "ab\r\ncd", "ab|cd|", 2, 1},
+		{"lf keeps column", 10, 3, "ab\ncd", "ab|  cd|", 4, 1},
+		{"auto wrap", 5, 3, "abcdefg", "abcde|fg|", 2, 1},
+		{"wrap pending at last column", 5, 3, "abcde", "abcde||", 4, 0},
+		{"wrap disabled", 5, 3, "\x1b[?7labcdefg", "abcdg||", 4, 0},
+		{"scroll at bottom", 5, 3, "1\r\n2\r\n3\r\n4", "2|3|4", 1, 2},
+		{"backspace and tab", 20, 1, "ab\bc\td", "ac      d", 9, 0},
+
+		// cursor movement.
+		{"cup", 10, 5, "\x1b[3;4Hx", "||   x||", 4, 2},
+		{"cup default", 10, 5, "abc\x1b[Hx", "xbc||||", 1, 0},
+		{"cup clamped", 10, 5, "\x1b[99;99Hx", "||||         x", 9, 4},
+		{"relative moves", 10, 5, "\x1b[3;3H\x1b[2A\x1b[3C\x1b[1B\x1b[4Dx", "| x|||", 2, 1},
+		{"cha and vpa", 10, 5, "\x1b[5G\x1b[3dx", "||    x||", 5, 2},
+		{"cnl and cpl", 10, 5, "abc\x1b[2Ex\x1b[1Fy", "abc|y|x||", 1, 1},
+		{"save and restore", 10, 3, "ab\x1b7\x1b[3;5Hx\x1b8y", "aby||    x", 3, 0},
+		{"csi save and restore", 10, 3, "ab\x1b[s\r\nzz\x1b[uy", "aby|zz|", 3, 0},
+
+		// erase.
+		{"el to end", 10, 2, "abcdef\x1b[4D\x1b[K", "ab|", 2, 0},
+		{"el to start", 10, 2, "abcdef\x1b[4D\x1b[1K", "   def|", 2, 0},
+		{"el whole line", 10, 2, "abcdef\x1b[4D\x1b[2K", "|", 2, 0},
+		{"ed below", 10, 3, "aaa\r\nbbb\r\nccc\x1b[2;2H\x1b[J", "aaa|b|", 1, 1},
+		{"ed above", 10, 3, "aaa\r\nbbb\r\nccc\x1b[2;2H\x1b[1J", "|  b|ccc", 1, 1},
+		{"ed all", 10, 3, "aaa\r\nbbb\x1b[2J", "||", 3, 1},
+		{"ech", 10, 1, "abcdef\x1b[1G\x1b[2X", "  cdef", 0, 0},
+		{"ich and dch", 10, 1, "abcdef\x1b[2G\x1b[2@\x1b[4G\x1b[1P", "a  cdef", 3, 0},
+
+		// scroll region.
+		{"lf scrolls region only", 10, 4, "1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[3;1H\nx", "1|3|x|4", 1, 2},
+		{"ri scrolls region down", 10, 4, "1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[2;1H\x1bMx", "1|x|2|4", 1, 1},
+		{"su and sd", 10, 3, "1\r\n2\r\n3\x1b[S", "2|3|", 1, 2},
+		{"sd", 10, 3, "1\r\n2\r\n3\x1b[T", "|1|2", 1, 2},
+		{"il and dl in region", 10, 4, "1\r\n2\r\n3\r\n4\x1b[1;3r\x1b[2;1H\x1b[L", "1||2|4", 0, 1},
+		{"dl in region", 10, 4, "1\r\n2\r\n3\r\n4\x1b[1;3r\x1b[1;1H\x1b[M", "2|3||4", 0, 0},
+		{"cursor stops at margin", 10, 4, "\x1b[2;3r\x1b[2;1H\x1b[9Bx", "||x|", 1, 2},
+		{"origin mode", 10, 4, "\x1b[2;3r\x1b[?6h\x1b[1;1Hx", "|x||", 1, 1},
+
+		// screens and wide chars.
+		{"alternate screen", 10, 2, "main\x1b[?1049halt\x1b[?1049l", "main|", 4, 0},
+		{"wide chars", 6, 2, "a你好b", "a你好b|", 5, 0},
+		{"wide char wraps", 4, 2, "abc你", "abc|你", 2, 1},
+		{"line drawing", 5, 1, "\x1b(0qx\x1b(Bq", "─│q", 3, 0},
+	}
+	for _, tt := range tests {
+		term := NewTerminal(tt.cols, tt.rows)
+		term.Feed(tt.input)
+		if got := screenText(term); got != tt.want {
+			t.Errorf("%s: screen %q, want %q", tt.name, got, tt.want)
+		}
+		if term.CursorX != tt.cursorX || term.CursorY != tt.cursorY {
+			t.Errorf("%s: cursor (%d, %d), want (%d, %d)", tt.name, term.CursorX, term.CursorY, tt.cursorX, tt.cursorY)
+		}
+	}
+}
+
+func TestTerminalStyle(t *testing.T) {
+	term := NewTerminal(10, 2)
+	term.Feed("\x1b[1;31ma\x1b[38;5;200;48;2;1;2;3mb\x1b[0mc\x1b[41m\x1b[K")
+	a, b, c := term.Cell(0, 0), term.Cell(1, 0), term.Cell(2, 0)
+	if a.Style.Attrs&AttrBold == 0 || a.Style.FG != (TermColor{Type: ColorIndexed, Index: 1}) {
+		t.Errorf("a = %+v", a)
+	}
+	if b.Style.FG != (TermColor{Type: ColorIndexed, Index: 200}) || b.Style.BG != (TermColor{Type: ColorRGB, R: 1, G: 2, B: 3}) {
+		t.Errorf("b = %+v", b)
+	}
+	if c.Style != (CellStyle{}) {
+		t.Errorf("c = %+v", c)
+	}
+	// erased cells take the background color.
+	if e := term.Cell(5, 0); e.Char != ' ' || e.Style.BG != (TermColor{Type: ColorIndexed, Index: 1}) {
+		t.Errorf("erased cell = %+v", e)
+	}
+
+	term.Feed("\x1b]0;my title\x07\x1b[?25l")
+	if term.Title != "my title" || term.CursorVisible {
+		t.Errorf("title %q, cursor visible %v", term.Title, term.CursorVisible)
+	}
+}
+
+func TestTerminalResize(t *testing.T) {
+	term := NewTerminal(6, 3)
+	term.Feed("abcdef\r\n123\r\nxyz")
+	term.Resize(4, 2)
+	if got := screenText(term); got != "abcd|123" {
+		t.Errorf("screen after shrinking = %q", got)
+	}
+	if term.CursorX > 3 || term.CursorY > 1 {
+		t.Errorf("cursor (%d, %d) outside of screen", term.CursorX, term.CursorY)
+	}
+	term.Resize(8, 4)
+	term.Feed("\x1b[4;8Hz")
+	if got := screenText(term); got != "abcd|123||       z" {
+		t.Errorf("screen after growing = %q", got)
+	}
+}
@@ -0,0 +1,145 @@
+package asciinema
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+)
+
+/*
+Color themes for rendering.
+
+A theme is written as "background,foreground,color0,...,color7[,color8,...,color15]",
+colors are hex strings like "282a36", the same form is accepted as a custom theme.
+*/
+const DefaultTheme = "dracula"
+
+var Themes = map[string]string{
+	"asciinema":       "121314,cccccc,000000,dd3c69,4ebf22,ddaf3c,26b0d7,b954e1,54e1b9,d9d9d9,4d4d4d,dd3c69,4ebf22,ddaf3c,26b0d7,b954e1,54e1b9,ffffff",
+	"dracula":         "282a36,f8f8f2,21222c,ff5555,50fa7b,f1fa8c,bd93f9,ff79c6,8be9fd,f8f8f2,6272a4,ff6e6e,69ff94,ffffa5,d6acff,ff92df,a4ffff,ffffff",
+	"monokai":         "272822,f8f8f2,272822,f92672,a6e22e,f4bf75,66d9ef,ae81ff,a1efe4,f8f8f2,75715e,f92672,a6e22e,f4bf75,66d9ef,ae81ff,a1efe4,f9f8f5",
+	"nord":            "2e3440,d8dee9,3b4252,bf616a,a3be8c,ebcb8b,81a1c1,b48ead,88c0d0,e5e9f0,4c566a,bf616a,a3be8c,ebcb8b,81a1c1,b48ead,8fbcbb,eceff4",
+	"solarized-dark":  "002b36,839496,073642,dc322f,859900,b58900,268bd2,d33682,2aa198,eee8d5,002b36,cb4b16,586e75,657b83,839496,6c71c4,93a1a1,fdf6e3",
+	"solarized-light": "fdf6e3,657b83,073642,dc322f,859900,b58900,268bd2,d33682,2aa198,eee8d5,002b36,cb4b16,586e75,657b83,839496,6c71c4,93a1a1,fdf6e3",
+	"github-light":    "ffffff,24292f,24292f,cf222e,116329,4d2d00,0969da,8250df,1b7c83,6e7781,57606a,a40e26,1a7f37,633c01,218bff,a475f9,3192aa,8c959f",
+}
+
+type Theme struct {
+	Background color.RGBA
+	Foreground color.RGBA
+	Palette    [16]color.RGBA
+}
+
+func ThemeNames() (names []string) {
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func parseHexColor(s string) (c color.RGBA, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return c, fmt.Errorf("invalid color: %s", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("invalid color: %s", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Parses a theme name or a custom theme.
+func ParseTheme(spec string) (theme *Theme, err error) {
+	if spec == "" {
+		spec = DefaultTheme
+	}
+	if s, ok := Themes[spec]; ok {
+		spec = s
+	}
+	colors := strings.Split(spec, ",")
+	if len(colors) != 10 && len(colors) != 18 {
+		return nil, fmt.Errorf("unknown theme: %s, available: %s", spec, strings.Join(ThemeNames(), ", "))
+	}
+	parsed := make([]color.RGBA, len(colors))
+	for i, s := range colors {
+		if parsed[i], err = parseHexColor(s); err != nil {
+			return nil, err
+		}
+	}
+	theme = &Theme{Background: parsed[0], Foreground: parsed[1]}
+	for i := 0; i < 16; i++ {
+		// bright colors are the same as normal ones if not given.
+		theme.Palette[i] = parsed[2+i%(len(parsed)-2)]
+	}
+	return
+}
+
+// Theme saved in cast header, palette is a list of 8 or 16 colors separated by ":".
+func ThemeFromHeader(h *cast.Header) *Theme {
+	if h.Theme.Fg == "" || h.Theme.Bg == "" || h.Theme.Palette == "" {
+		return nil
+	}
+	spec := []string{h.Theme.Bg, h.Theme.Fg}
+	spec = append(spec, strings.Split(h.Theme.Palette, ":")...)
+	theme, _ := ParseTheme(strings.Join(spec, ","))
+	return theme
+}
+
+// Color of index in xterm 256 colors.
+func (t *Theme) Indexed(i uint8) color.RGBA {
+	switch {
+	case i < 16:
+		return t.Palette[i]
+	case i < 232:
+		levels := [6]uint8{0, 95, 135, 175, 215, 255}
+		i -= 16
+		return color.RGBA{R: levels[i/36], G: levels[i/6%6], B: levels[i%6], A: 0xff}
+	default:
+		v := 8 + 10*(i-232)
+		return color.RGBA{R: v, G: v, B: v, A: 0xff}
+	}
+}
+
+// Colors of a cell, bold text uses bright colors.
+func (t *Theme) CellColors(s CellStyle) (fg, bg color.RGBA) {
+	fg, bg = t.Foreground, t.Background
+	switch s.FG.Type {
+	case ColorIndexed:
+		index := s.FG.Index
+		if s.Attrs&AttrBold != 0 && index < 8 {
+			index += 8
+		}
+		fg = t.Indexed(index)
+	case ColorRGB:
+		fg = color.RGBA{R: s.FG.R, G: s.FG.G, B: s.FG.B, A: 0xff}
+	}
+	switch s.BG.Type {
+	case ColorIndexed:
+		bg = t.Indexed(s.BG.Index)
+	case ColorRGB:
+		bg = color.RGBA{R: s.BG.R, G: s.BG.G, B: s.BG.B, A: 0xff}
+	}
+	if s.Attrs&AttrReverse != 0 {
+		fg, bg = bg, fg
+	}
+	if s.Attrs&AttrDim != 0 {
+		fg = blendColor(fg, bg, 0.5)
+	}
+	if s.Attrs&AttrHidden != 0 {
+		fg = bg
+	}
+	return
+}
+
+func blendColor(a, b color.RGBA, ratio float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x)*ratio + float64(y)*(1-ratio) + 0.5)
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 0xff}
+}
@@ -0,0 +1,128 @@
+package asciinema
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Plain text transcripts of casts, for docs and search.
+
+Output is replayed as a stream of lines with ANSI sequences stripped,
+carriage returns and backspaces overwrite the current line like a terminal does.
+Full screen programs like vim draw on the alternate screen, which is skipped.
+*/
+var altScreenRegExp = regexp.MustCompile(`\x1b\[\?(?:1049|1047|47)([hl])`)
+
+type transcriptWriter struct {
+	w          io.Writer
+	timestamps bool
+	line       []rune
+	col        int
+	start      float64 // time the current line got its first char.
+	altScreen  bool
+	err        error
+}
+
+func formatTranscriptTime(t float64) string {
+	return fmt.Sprintf("%02d:%02d", int(t)/60, int(t)%60)
+}
+
+func (tw *transcriptWriter) endLine() {
+	text := strings.TrimRight(string(tw.line), " ")
+	if tw.err == nil {
+		if tw.timestamps && text != "" {
+			text = fmt.Sprintf("[%s] %s", formatTranscriptTime(tw.start), text)
+		}
+		_, tw.err = fmt.Fprintln(tw.w, text)
+	}
+	tw.line, tw.col = tw.line[:0], 0
+}
+
+func (tw *transcriptWriter) write(text string, t float64) {
+	for _, r := range StripANSI(text) {
+		switch {
+		case r == '\n':
+			tw.endLine()
+		case r == '\r':
+			tw.col = 0
+		case r == '\b':
+			tw.col = max(tw.col-1, 0)
+		case r == '\t':
+			tw.write(strings.Repeat(" ", 8-tw.col%8), t)
+		case r < ' ' || r == 0x7f:
+		default:
+			if len(tw.line) == 0 {
+				tw.start = t
+			}
+			for len(tw.line) < tw.col {
+				tw.line = append(tw.line, ' ')
+			}
+			if tw.col < len(tw.line) {
+				tw.line[tw.col] = r
+			} else {
+				tw.line = append(tw.line, r)
+			}
+			tw.col++
+		}
+	}
+}
+
+func (tw *transcriptWriter) feed(ev *cast.Event) {
+	data := ev.Data
+	for {
+		loc := altScreenRegExp.FindStringSubmatchIndex(data)
+		if loc == nil {
+			break
+		}
+		if !tw.altScreen {
+			tw.write(data[:loc[0]], ev.Time)
+		}
+		tw.altScreen = data[loc[2]:loc[3]] == "h"
+		data = data[loc[1]:]
+	}
+	if !tw.altScreen {
+		tw.write(data, ev.Time)
+	}
+}
+
+// Writes output of a cast as plain text, lines are prefixed with [mm:ss] they appear at if timestamps.
+func WriteTranscript(c *cast.Cast, w io.Writer, timestamps bool) error {
+	tw := &transcriptWriter{w: w, timestamps: timestamps}
+	for _, ev := range c.EventStream {
+		if ev.Type == "o" {
+			tw.feed(ev)
+		}
+	}
+	if len(tw.line) > 0 {
+		tw.endLine()
+	}
+	return tw.err
+}
+
+func ExportTranscript(inFilePath, outFilePath string, timestamps bool) (err error) {
+	c, err := LoadCast(inFilePath)
+	if err != nil {
+		return
+	}
+	f, err := os.Create(outFilePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err = WriteTranscript(c, w, timestamps); err != nil {
+		return
+	}
+	if err = w.Flush(); err == nil {
+		gprint.PrintSuccess("Transcript saved to %s", outFilePath)
+	}
+	return
+}
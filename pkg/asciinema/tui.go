@@ -0,0 +1,414 @@
+package asciinema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/gvcgo/asciinema-edit/cast"
+	"github.com/mattn/go-runewidth"
+)
+
+/*
+Interactive cast editor.
+
+Events are listed in a timeline, the terminal at the selected event is previewed.
+Ranges between the mark and the cursor can be deleted, sped up or quantized
+the same way as Cut, Speed and Quantize do.
+*/
+const (
+	DefaultEditorSpeedFactor float64 = 0.5
+	DefaultEditorMaxPause    float64 = 0.5
+	editorLongPause          float64 = 1
+)
+
+var (
+	editorTitleStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	editorCursorStyle  = lipgloss.NewStyle().Reverse(true)
+	editorMarkedStyle  = lipgloss.NewStyle().Background(lipgloss.Color("238"))
+	editorPauseStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	editorDimStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	editorStatusStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	editorErrorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	editorPreviewStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+)
+
+type CastEditor struct {
+	fPath       string
+	output      string
+	cast        *cast.Cast
+	history     [][]*cast.Event
+	cursor      int
+	mark        int // -1 if nothing is marked.
+	offset      int // first event shown in the timeline.
+	width       int
+	height      int
+	dirty       bool
+	quitting    bool
+	status      string
+	statusErr   bool
+	SpeedFactor float64
+	MaxPause    float64
+}
+
+// Edits a cast, changes are saved to output, or the cast itself if output is empty.
+func NewCastEditor(fPath, output string) (e *CastEditor, err error) {
+	c, err := LoadCast(fPath)
+	if err != nil {
+		return
+	}
+	if len(c.EventStream) == 0 {
+		return nil, fmt.Errorf("no events in %s", fPath)
+	}
+	if output == "" {
+		output = fPath
+	}
+	return &CastEditor{
+		fPath:       fPath,
+		output:      output,
+		cast:        c,
+		mark:        -1,
+		width:       100,
+		height:      30,
+		SpeedFactor: DefaultEditorSpeedFactor,
+		MaxPause:    DefaultEditorMaxPause,
+	}, nil
+}
+
+func (e *CastEditor) Run() error {
+	_, err := tea.NewProgram(e, tea.WithAltScreen()).Run()
+	return err
+}
+
+func (e *CastEditor) events() []*cast.Event {
+	return e.cast.EventStream
+}
+
+func copyEvents(events []*cast.Event) []*cast.Event {
+	result := make([]*cast.Event, len(events))
+	for i, ev := range events {
+		evCopy := *ev
+		result[i] = &evCopy
+	}
+	return result
+}
+
+// Selected range, the cursor alone if nothing is marked.
+func (e *CastEditor) selection() (from, to int) {
+	from, to = e.cursor, e.cursor
+	if e.mark >= 0 {
+		from, to = min(e.mark, e.cursor), max(e.mark, e.cursor)
+	}
+	return
+}
+
+// Applies a transformation to the cast, which is restored on failure.
+func (e *CastEditor) apply(name string, t interface{ Transform(*cast.Cast) error }) {
+	before := copyEvents(e.events())
+	if err := t.Transform(e.cast); err != nil {
+		e.cast.EventStream = before
+		e.setStatus(true, "%s failed: %v", name, err)
+		return
+	}
+	e.history = append(e.history, before)
+	e.dirty = true
+	e.mark = -1
+	e.cursor = min(e.cursor, len(e.events())-1)
+	e.setStatus(false, "%s: %d -> %d events, duration %.3fs", name, len(before), len(e.events()), castEnd(e.cast))
+}
+
+/*
+Cuts or speeds up the selection, like Cut and Speed do,
+the range is taken by index, as events of the same time can not be told apart by bounds.
+*/
+type rangeEditTransformation struct {
+	from, to int
+	factor   float64 // events are removed if 0.
+}
+
+func (t *rangeEditTransformation) Transform(c *cast.Cast) (err error) {
+	if t.factor == 0 {
+		cutEvents(c, t.from, t.to)
+	} else {
+		speedEvents(c, t.factor, t.from, t.to)
+	}
+	return
+}
+
+func (e *CastEditor) deleteSelection() {
+	from, to := e.selection()
+	if len(e.events()) == to-from+1 {
+		e.setStatus(true, "can not delete all events")
+		return
+	}
+	e.apply("delete", &rangeEditTransformation{from: from, to: to})
+	e.cursor = min(from, len(e.events())-1)
+}
+
+func (e *CastEditor) speedSelection(factor float64) {
+	from, to := e.selection()
+	events := e.events()
+	if events[to].Time <= events[from].Time {
+		e.setStatus(true, "mark a range with different times to change speed")
+		return
+	}
+	e.apply(fmt.Sprintf("speed x%g", factor), &rangeEditTransformation{from: from, to: to, factor: factor})
+}
+
+// Quantizes pauses in the selection, events after it are shifted.
+type rangeQuantizeTransformation struct {
+	from, to int
+	maxPause float64
+}
+
+func (t *rangeQuantizeTransformation) Transform(c *cast.Cast) (err error) {
+	part := &cast.Cast{Header: c.Header, EventStream: c.EventStream[t.from : t.to+1]}
+	oldEnd := castEnd(part)
+	q := &quantizeTransformation{}
+	if q.ranges, err = parseQuantizeRanges([]string{strconv.FormatFloat(t.maxPause, 'f', -1, 64)}); err != nil {
+		return
+	}
+	if err = q.Transform(part); err != nil {
+		return
+	}
+	delta := castEnd(part) - oldEnd
+	for _, ev := range c.EventStream[t.to+1:] {
+		ev.Time += delta
+	}
+	return
+}
+
+func (e *CastEditor) quantizeSelection() {
+	from, to := e.selection()
+	if from == to {
+		from, to = 0, len(e.events())-1
+	}
+	e.apply(fmt.Sprintf("quantize pauses to %gs", e.MaxPause), &rangeQuantizeTransformation{from: from, to: to, maxPause: e.MaxPause})
+}
+
+func (e *CastEditor) undo() {
+	if len(e.history) == 0 {
+		e.setStatus(true, "nothing to undo")
+		return
+	}
+	e.cast.EventStream = e.history[len(e.history)-1]
+	e.history = e.history[:len(e.history)-1]
+	e.cursor = min(e.cursor, len(e.events())-1)
+	e.dirty = true
+	e.setStatus(false, "undone, %d changes left", len(e.history))
+}
+
+func (e *CastEditor) save() {
+	c := &cast.Cast{Header: e.cast.Header, EventStream: copyEvents(e.events())}
+	c.Header.Duration = 0
+	if err := SaveCast(c, e.output); err != nil {
+		e.setStatus(true, "save failed: %v", err)
+		return
+	}
+	e.dirty = false
+	e.setStatus(false, "saved to %s", e.output)
+}
+
+func (e *CastEditor) setStatus(isErr bool, format string, args ...interface{}) {
+	e.status, e.statusErr = fmt.Sprintf(format, args...), isErr
+}
+
+// Moves the cursor to the first event at or after t, or the last one before t when moving backward.
+func (e *CastEditor) seek(t float64, forward bool) {
+	events := e.events()
+	if forward {
+		for e.cursor < len(events)-1 && events[e.cursor].Time < t {
+			e.cursor++
+		}
+	} else {
+		for e.cursor > 0 && events[e.cursor].Time > t {
+			e.cursor--
+		}
+	}
+}
+
+func (e *CastEditor) moveCursor(delta int) {
+	e.cursor = min(max(e.cursor+delta, 0), len(e.events())-1)
+}
+
+func (e *CastEditor) Init() tea.Cmd {
+	return nil
+}
+
+func (e *CastEditor) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		e.width, e.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		key := msg.String()
+		if key != "q" {
+			e.quitting = false
+		}
+		// help is shown again once another key is pressed.
+		e.status = ""
+		page := max(e.timelineHeight()-1, 1)
+		current := e.events()[e.cursor].Time
+		switch key {
+		case "ctrl+c":
+			return e, tea.Quit
+		case "q":
+			if !e.dirty || e.quitting {
+				return e, tea.Quit
+			}
+			e.quitting = true
+			e.setStatus(true, "unsaved changes, press q again to quit without saving")
+		case "up", "k":
+			e.moveCursor(-1)
+		case "down", "j":
+			e.moveCursor(1)
+		case "pgup":
+			e.moveCursor(-page)
+		case "pgdown":
+			e.moveCursor(page)
+		case "home", "g":
+			e.cursor = 0
+		case "end", "G":
+			e.cursor = len(e.events()) - 1
+		case "left", "h":
+			e.seek(current-1, false)
+		case "right", "l":
+			e.seek(current+1, true)
+		case "[":
+			e.seek(current-10, false)
+		case "]":
+			e.seek(current+10, true)
+		case " ", "m":
+			if e.mark >= 0 {
+				e.mark = -1
+			} else {
+				e.mark = e.cursor
+			}
+		case "esc":
+			e.mark = -1
+		case "d", "x":
+			e.deleteSelection()
+		case "s", "+":
+			e.speedSelection(e.SpeedFactor)
+		case "S", "-":
+			e.speedSelection(1 / e.SpeedFactor)
+		case "p":
+			e.quantizeSelection()
+		case "u", "ctrl+z":
+			e.undo()
+		case "w", "ctrl+s":
+			e.save()
+		}
+	}
+	return e, nil
+}
+
+/*
+Layout: title, preview of the terminal, timeline and help.
+*/
+func (e *CastEditor) previewRows() int {
+	return max(min(int(e.cast.Header.Height), (e.height-4)/2-2), 1)
+}
+
+func (e *CastEditor) timelineHeight() int {
+	return max(e.height-e.previewRows()-5, 3)
+}
+
+// Plain text of the terminal after the selected event.
+func (e *CastEditor) preview() string {
+	term := NewTerminal(int(e.cast.Header.Width), int(e.cast.Header.Height))
+	for _, ev := range e.events()[:e.cursor+1] {
+		applyEvent(term, ev)
+	}
+	rows := e.previewRows()
+	// keeps the cursor line visible.
+	start := max(min(term.CursorY-rows+1, term.Rows-rows), 0)
+	width := max(e.width-2, 10)
+	lines := []string{}
+	for y := start; y < start+rows && y < term.Rows; y++ {
+		lines = append(lines, runewidth.FillRight(runewidth.Truncate(strings.TrimRight(term.LineText(y), " "), width, ""), width))
+	}
+	return editorPreviewStyle.Render(strings.Join(lines, "\n"))
+}
+
+// Readable data of an event, control characters are shown as escapes.
+func eventPreview(ev *cast.Event) string {
+	data := ev.Data
+	if ev.Type == "o" || ev.Type == "i" {
+		data = StripANSI(data)
+	}
+	var b strings.Builder
+	for _, r := range data {
+		switch {
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (e *CastEditor) timeline() string {
+	events := e.events()
+	height := e.timelineHeight()
+	if e.cursor < e.offset {
+		e.offset = e.cursor
+	} else if e.cursor >= e.offset+height {
+		e.offset = e.cursor - height + 1
+	}
+	e.offset = max(min(e.offset, len(events)-height), 0)
+	from, to := e.selection()
+	lines := []string{}
+	for i := e.offset; i < len(events) && i < e.offset+height; i++ {
+		ev := events[i]
+		delta := ev.Time
+		if i > 0 {
+			delta -= events[i-1].Time
+		}
+		deltaStr := fmt.Sprintf("+%8.3f", delta)
+		if delta >= editorLongPause && i != e.cursor {
+			deltaStr = editorPauseStyle.Render(deltaStr)
+		}
+		prefix := fmt.Sprintf("%6d %10.3fs ", i, ev.Time)
+		content := fmt.Sprintf(" %s  ", ev.Type)
+		preview := runewidth.Truncate(eventPreview(ev), max(e.width-runewidth.StringWidth(prefix+content)-9, 1), "…")
+		line := prefix + deltaStr + content + preview
+		switch {
+		case i == e.cursor:
+			line = editorCursorStyle.Render(runewidth.FillRight(prefix+fmt.Sprintf("+%8.3f", delta)+content+preview, e.width))
+		case e.mark >= 0 && i >= from && i <= to:
+			line = editorMarkedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *CastEditor) View() string {
+	events := e.events()
+	title := fmt.Sprintf("%s  %d events  %.3fs", e.fPath, len(events), castEnd(e.cast))
+	if e.dirty {
+		title += " [modified]"
+	}
+	if e.mark >= 0 {
+		from, to := e.selection()
+		title += fmt.Sprintf("  selected %.3fs - %.3fs", events[from].Time, events[to].Time)
+	}
+	status, style := "↑↓ move  ←→ ±1s  [] ±10s  space mark  d delete  s/S speed up/down  p quantize pauses  u undo  w save  q quit", editorDimStyle
+	if e.status != "" {
+		status, style = e.status, editorStatusStyle
+		if e.statusErr {
+			style = editorErrorStyle
+		}
+	}
+	status = style.Render(runewidth.Truncate(status, e.width, "…"))
+	return strings.Join([]string{editorTitleStyle.Render(title), e.preview(), e.timeline(), status}, "\n")
+}
@@ -0,0 +1,101 @@
+package asciinema
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func newTestEditor(t *testing.T) *CastEditor {
+	t.Helper()
+	dir := t.TempDir()
+	fPath := filepath.Join(dir, "demo.cast")
+	if err := SaveCast(castOf(80, 24, "0 o a", "1 o b", "1 o c", "2 o d", "4 o e"), fPath); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewCastEditor(fPath, filepath.Join(dir, "edited.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func press(e *CastEditor, keys ...string) {
+	for _, k := range keys {
+		e.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+	}
+}
+
+func TestCastEditor(t *testing.T) {
+	original := []string{"0 o a", "1 o b", "1 o c", "2 o d", "4 o e"}
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{"delete first event", []string{"d"}, []string{"0 o b", "0 o c", "1 o d", "3 o e"}},
+		{"delete one of the same time", []string{"j", "j", "d"}, []string{"0 o a", "1 o b", "1 o d", "3 o e"}},
+		{"delete range", []string{"j", "m", "j", "j", "d"}, []string{"0 o a", "1 o e"}},
+		{"delete last event", []string{"G", "d"}, []string{"0 o a", "1 o b", "1 o c", "2 o d"}},
+		{"speed up", []string{"j", "m", "j", "j", "s"}, []string{"0 o a", "1 o b", "1 o c", "1.5 o d", "3.5 o e"}},
+		{"slow down", []string{"m", "G", "S"}, []string{"0 o a", "2 o b", "2 o c", "4 o d", "8 o e"}},
+		{"quantize all", []string{"p"}, []string{"0 o a", "0.5 o b", "0.5 o c", "1 o d", "1.5 o e"}},
+		{"quantize range", []string{"G", "m", "k", "p"}, []string{"0 o a", "1 o b", "1 o c", "2 o d", "2.5 o e"}},
+	}
+	for _, tt := range tests {
+		e := newTestEditor(t)
+		press(e, tt.keys...)
+		if e.statusErr {
+			t.Errorf("%s: %s", tt.name, e.status)
+			continue
+		}
+		if got := eventList(e.cast); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+		if !e.dirty || e.mark != -1 || e.cursor >= len(e.events()) {
+			t.Errorf("%s: dirty %v, mark %d, cursor %d", tt.name, e.dirty, e.mark, e.cursor)
+		}
+		press(e, "u")
+		if got := eventList(e.cast); !reflect.DeepEqual(got, original) {
+			t.Errorf("%s: %q after undo", tt.name, got)
+		}
+	}
+}
+
+func TestCastEditorUndoAndSave(t *testing.T) {
+	e := newTestEditor(t)
+	press(e, "u")
+	if !e.statusErr {
+		t.Errorf("undo without changes: %s", e.status)
+	}
+	press(e, "m", "G", "d")
+	if !e.statusErr || len(e.events()) != 5 {
+		t.Errorf("delete of all events: %s, %d events", e.status, len(e.events()))
+	}
+	press(e, "esc", "g", "j", "m", "j", "s")
+	if !e.statusErr || e.dirty {
+		t.Errorf("speed of events of the same time: %s", e.status)
+	}
+	press(e, "esc", "g", "d", "d", "u")
+	want := []string{"0 o b", "0 o c", "1 o d", "3 o e"}
+	if got := eventList(e.cast); !reflect.DeepEqual(got, want) || len(e.history) != 1 {
+		t.Errorf("%q, %d changes, want %q", got, len(e.history), want)
+	}
+
+	press(e, "w")
+	if e.statusErr || e.dirty {
+		t.Fatalf("save: %s", e.status)
+	}
+	saved, err := LoadCast(e.output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventList(saved); !reflect.DeepEqual(got, want) {
+		t.Errorf("saved %q, want %q", got, want)
+	}
+	if saved.Header.Width != 80 || saved.Header.Height != 24 {
+		t.Errorf("saved header %+v", saved.Header)
+	}
+}
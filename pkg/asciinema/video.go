@@ -0,0 +1,146 @@
+package asciinema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+/*
+Encodes frames to MP4 or WebM videos with ffmpeg.
+
+Frames are piped to ffmpeg as raw RGBA images at a constant frame rate,
+a frame is repeated until the next one starts, so timing of the cast is kept.
+*/
+const (
+	FormatMp4  = "mp4"
+	FormatWebm = "webm"
+)
+
+func isVideoFormat(format string) bool {
+	return format == FormatMp4 || format == FormatWebm
+}
+
+func findFfmpeg() (string, error) {
+	p, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg is required to export %s and %s videos, but it is not found in PATH, see https://ffmpeg.org/download.html", FormatMp4, FormatWebm)
+	}
+	return p, nil
+}
+
+// Parses WIDTHxHEIGHT or WIDTH, height is 0 if not specified. Sizes are rounded down to even numbers.
+func parseResolution(s string) (width, height int, err error) {
+	ws, hs, hasHeight := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if width, err = strconv.Atoi(ws); err == nil && hasHeight {
+		height, err = strconv.Atoi(hs)
+	}
+	if err != nil || width < 2 || (hasHeight && height < 2) {
+		return 0, 0, fmt.Errorf("invalid resolution: %s, expected WIDTHxHEIGHT or WIDTH", s)
+	}
+	return width &^ 1, height &^ 1, nil
+}
+
+type VideoEncoder struct {
+	ffmpeg     string
+	format     string
+	output     string
+	resolution string
+	fps        int
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	stderr     bytes.Buffer
+	written    int // frames piped to ffmpeg.
+}
+
+func NewVideoEncoder(format, output string, opts *RenderOptions) (e *VideoEncoder, err error) {
+	e = &VideoEncoder{format: format, output: output, resolution: opts.Resolution, fps: opts.FPS}
+	if e.fps <= 0 {
+		e.fps = DefaultFPS
+	}
+	if e.resolution != "" {
+		if _, _, err = parseResolution(e.resolution); err != nil {
+			return nil, err
+		}
+	}
+	if e.ffmpeg, err = findFfmpeg(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Video filter, sizes must be even for yuv420p. Padding uses the color of the canvas corner, which is the background.
+func (e *VideoEncoder) filter(f *Frame) string {
+	c := f.Image.RGBAAt(0, 0)
+	bg := fmt.Sprintf("0x%02x%02x%02x", c.R, c.G, c.B)
+	if e.resolution == "" {
+		return fmt.Sprintf("pad=ceil(iw/2)*2:ceil(ih/2)*2:color=%s", bg)
+	}
+	width, height, _ := parseResolution(e.resolution)
+	if height == 0 {
+		return fmt.Sprintf("scale=%d:-2:flags=lanczos", width)
+	}
+	return fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease:flags=lanczos,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2:color=%[3]s", width, height, bg)
+}
+
+func (e *VideoEncoder) start(f *Frame) error {
+	b := f.Image.Bounds()
+	args := []string{
+		"-y", "-hide_banner", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", b.Dx(), b.Dy()), "-r", strconv.Itoa(e.fps), "-i", "-",
+		"-vf", e.filter(f), "-an",
+	}
+	if e.format == FormatWebm {
+		args = append(args, "-c:v", "libvpx-vp9", "-crf", "30", "-b:v", "0", "-pix_fmt", "yuv420p", "-f", "webm")
+	} else {
+		args = append(args, "-c:v", "libx264", "-crf", "18", "-tune", "animation", "-pix_fmt", "yuv420p", "-movflags", "+faststart", "-f", "mp4")
+	}
+	args = append(args, e.output)
+	e.cmd = exec.Command(e.ffmpeg, args...)
+	e.cmd.Stderr = &e.stderr
+	stdin, err := e.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	e.stdin = stdin
+	return e.cmd.Start()
+}
+
+// Waits for ffmpeg and reports its output on failure.
+func (e *VideoEncoder) wait(err error) error {
+	e.stdin.Close()
+	if werr := e.cmd.Wait(); werr != nil || err != nil {
+		if werr == nil {
+			werr = err
+		}
+		return fmt.Errorf("ffmpeg failed: %v\n%s", werr, strings.TrimSpace(e.stderr.String()))
+	}
+	return nil
+}
+
+func (e *VideoEncoder) Encode(f *Frame) (err error) {
+	if e.cmd == nil {
+		if err = e.start(f); err != nil {
+			return
+		}
+	}
+	end := int(math.Round((f.Time + f.Duration) * float64(e.fps)))
+	for n := max(end-e.written, 1); n > 0; n-- {
+		if _, err = e.stdin.Write(f.Image.Pix); err != nil {
+			return e.wait(err)
+		}
+		e.written++
+	}
+	return
+}
+
+func (e *VideoEncoder) Close() error {
+	if e.cmd == nil {
+		return fmt.Errorf("no frames")
+	}
+	return e.wait(nil)
+}
@@ -0,0 +1,153 @@
+package asciinema
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+/*
+Puts a stub ffmpeg first on PATH.
+It saves its argv and the raw frames piped to it, then exits with exitCode.
+*/
+func stubFfmpeg(t *testing.T, exitCode string) (argsFile, framesFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args.txt")
+	framesFile = filepath.Join(dir, "frames.raw")
+	script := `#!/bin/sh
+printf '%s\n' "$@" > "` + argsFile + `"
+cat > "` + framesFile + `"
+echo "stub error" >&2
+exit ` + exitCode + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return
+}
+
+func testFrame(w, h int, bg color.RGBA, t, d float64) *Frame {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = bg.R, bg.G, bg.B, bg.A
+	}
+	return &Frame{Image: img, Rect: img.Bounds(), Time: t, Duration: d}
+}
+
+func TestVideoEncoder(t *testing.T) {
+	tests := []struct {
+		format     string
+		resolution string
+		wantArgs   []string
+	}{
+		{
+			format:   FormatMp4,
+			wantArgs: []string{"-s\n5x3\n", "-r\n10\n", "-vf\npad=ceil(iw/2)*2:ceil(ih/2)*2:color=0x102030\n", "-c:v\nlibx264\n", "-pix_fmt\nyuv420p\n", "-f\nmp4\n"},
+		},
+		{
+			format:     FormatWebm,
+			resolution: "641x360",
+			wantArgs:   []string{"-s\n5x3\n", "-vf\nscale=640:360:force_original_aspect_ratio=decrease:flags=lanczos,pad=640:360:(ow-iw)/2:(oh-ih)/2:color=0x102030\n", "-c:v\nlibvpx-vp9\n", "-f\nwebm\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			argsFile, framesFile := stubFfmpeg(t, "0")
+			output := filepath.Join(t.TempDir(), "out."+tt.format)
+			e, err := NewVideoEncoder(tt.format, output, &RenderOptions{FPS: 10, Resolution: tt.resolution})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bg := color.RGBA{0x10, 0x20, 0x30, 0xff}
+			frames := []*Frame{
+				testFrame(5, 3, bg, 0, 0.5),      // frames 0-4
+				testFrame(5, 3, bg, 0.5, 0.1),    // frame 5
+				testFrame(5, 3, bg, 0.6, 0.05),   // frame 6
+				testFrame(5, 3, bg, 0.65, 0.001), // shorter than a frame, still written once.
+			}
+			for _, f := range frames {
+				if err := e.Encode(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := os.ReadFile(framesFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frameSize := 5 * 3 * 4
+			if len(raw)%frameSize != 0 || len(raw)/frameSize != 8 {
+				t.Errorf("got %d bytes, want 8 frames of %d bytes", len(raw), frameSize)
+			}
+
+			b, _ := os.ReadFile(argsFile)
+			args := string(b)
+			if !strings.HasPrefix(args, "-y\n") || !strings.HasSuffix(args, output+"\n") {
+				t.Errorf("unexpected argv:\n%s", args)
+			}
+			for _, want := range append(tt.wantArgs, "-f\nrawvideo\n", "-pix_fmt\nrgba\n", "-i\n-\n") {
+				if !strings.Contains(args, want) {
+					t.Errorf("argv does not contain %q:\n%s", want, args)
+				}
+			}
+		})
+	}
+}
+
+func TestVideoEncoderErrors(t *testing.T) {
+	stubFfmpeg(t, "1")
+	e, err := NewVideoEncoder(FormatMp4, filepath.Join(t.TempDir(), "out.mp4"), &RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Close(); err == nil || !strings.Contains(err.Error(), "no frames") {
+		t.Errorf("error = %v, want no frames", err)
+	}
+	if err = e.Encode(testFrame(2, 2, color.RGBA{}, 0, 0.1)); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Close(); err == nil || !strings.Contains(err.Error(), "stub error") {
+		t.Errorf("error = %v, want output of ffmpeg", err)
+	}
+
+	if _, err = NewVideoEncoder(FormatMp4, "out.mp4", &RenderOptions{Resolution: "axb"}); err == nil {
+		t.Error("expected an error for invalid resolution")
+	}
+	t.Setenv("PATH", t.TempDir())
+	if _, err = NewVideoEncoder(FormatMp4, "out.mp4", &RenderOptions{}); err == nil || !strings.Contains(err.Error(), "ffmpeg is required") {
+		t.Errorf("error = %v, want ffmpeg is required", err)
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		s             string
+		width, height int
+		ok            bool
+	}{
+		{"1280x720", 1280, 720, true},
+		{" 1281X721 ", 1280, 720, true},
+		{"800", 800, 0, true},
+		{"1", 0, 0, false},
+		{"800x", 0, 0, false},
+		{"x600", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		w, h, err := parseResolution(tt.s)
+		if (err == nil) != tt.ok || w != tt.width || h != tt.height {
+			t.Errorf("parseResolution(%q) = %d, %d, %v", tt.s, w, h, err)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package asciinema
+
+import (
+	"container/heap"
+	"math/bits"
+)
+
+/*
+A minimal WebP lossless (VP8L) encoder,
+see https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification.
+
+No transforms or color cache are used, backward references only copy
+the left or the upper pixels, which suits terminal screens well.
+*/
+const (
+	vp8lSignature      = 0x2f
+	vp8lLengthCodes    = 24
+	vp8lDistanceCodes  = 40
+	vp8lMaxLength      = 4096
+	vp8lMinLength      = 3
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCLCodeLen   = 7
+	vp8lCodeLengthSize = 19
+	vp8lDistanceLeft   = 2 // (1, 0) in distance map.
+	vp8lDistanceUp     = 1 // (0, 1) in distance map.
+)
+
+var vp8lCodeLengthOrder = [vp8lCodeLengthSize]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Writes bits from the least significant one.
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.n = 0, 0
+	}
+	return w.buf
+}
+
+// Prefix coding of lengths and distances.
+func vp8lPrefix(v int) (code, extraBits, extra int) {
+	n := v - 1
+	if n < 4 {
+		return n, 0, 0
+	}
+	h := bits.Len(uint(n)) - 1
+	second := (n >> (h - 1)) & 1
+	return 2*h + second, h - 1, n & (1<<(h-1) - 1)
+}
+
+type vp8lSymbol struct {
+	argb     uint32
+	length   int // 0 for literal.
+	distance int // distance code.
+}
+
+func vp8lMatchLength(pix []uint32, i, j int) (n int) {
+	for i+n < len(pix) && n < vp8lMaxLength && pix[i+n] == pix[j+n] {
+		n++
+	}
+	return
+}
+
+func vp8lSymbols(pix []uint32, width int) (symbols []vp8lSymbol) {
+	for i := 0; i < len(pix); {
+		length, distance := 0, 0
+		if i > 0 {
+			length, distance = vp8lMatchLength(pix, i, i-1), vp8lDistanceLeft
+		}
+		if i >= width {
+			if n := vp8lMatchLength(pix, i, i-width); n > length {
+				length, distance = n, vp8lDistanceUp
+			}
+		}
+		if length >= vp8lMinLength {
+			symbols = append(symbols, vp8lSymbol{length: length, distance: distance})
+			i += length
+		} else {
+			symbols = append(symbols, vp8lSymbol{argb: pix[i]})
+			i++
+		}
+	}
+	return
+}
+
+type huffmanNode struct {
+	weight      int
+	symbol      int
+	left, right int
+}
+
+type huffmanHeap struct {
+	nodes []huffmanNode
+	items []int
+}
+
+func (h *huffmanHeap) Len() int { return len(h.items) }
+func (h *huffmanHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.items[i]], h.nodes[h.items[j]]
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	return h.items[i] < h.items[j]
+}
+func (h *huffmanHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *huffmanHeap) Push(x any)    { h.items = append(h.items, x.(int)) }
+func (h *huffmanHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+/*
+Code lengths of a Huffman code limited to maxLength,
+small counts are raised until the tree is shallow enough.
+At least two symbols should be used.
+*/
+func huffmanLengths(counts []int, maxLength int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	for minCount := 1; ; minCount *= 2 {
+		h := &huffmanHeap{}
+		for s, c := range counts {
+			if c > 0 {
+				h.nodes = append(h.nodes, huffmanNode{weight: max(c, minCount), symbol: s, left: -1, right: -1})
+				h.items = append(h.items, len(h.nodes)-1)
+			}
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a, b := heap.Pop(h).(int), heap.Pop(h).(int)
+			h.nodes = append(h.nodes, huffmanNode{weight: h.nodes[a].weight + h.nodes[b].weight, symbol: -1, left: a, right: b})
+			heap.Push(h, len(h.nodes)-1)
+		}
+		depth := 0
+		var walk func(node, d int)
+		walk = func(node, d int) {
+			n := h.nodes[node]
+			if n.symbol >= 0 {
+				lengths[n.symbol] = uint8(d)
+				depth = max(depth, d)
+				return
+			}
+			walk(n.left, d+1)
+			walk(n.right, d+1)
+		}
+		walk(h.items[0], 0)
+		if depth <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// Canonical codes with bits reversed, as codes are read from the least significant bit.
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count [vp8lMaxCodeLength + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [vp8lMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l > 0 {
+			codes[s] = bits.Reverse32(next[l]) >> (32 - uint(l))
+			next[l]++
+		}
+	}
+	return codes
+}
+
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (c *prefixCode) write(w *bitWriter, symbol int) {
+	w.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+type codeLengthToken struct {
+	code, extraBits, extra int
+}
+
+// Run length coding of code lengths with codes 16, 17 and 18.
+func codeLengthTokens(lengths []uint8) (tokens []codeLengthToken) {
+	prev := uint8(8)
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := min(run, 138)
+					tokens = append(tokens, codeLengthToken{18, 7, n - 11})
+					run -= n
+				} else {
+					n := min(run, 10)
+					tokens = append(tokens, codeLengthToken{17, 3, n - 3})
+					run -= n
+				}
+			}
+		} else {
+			if l != prev {
+				tokens = append(tokens, codeLengthToken{int(l), 0, 0})
+				prev = l
+				run--
+			}
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, codeLengthToken{16, 2, n - 3})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{int(l), 0, 0})
+		}
+	}
+	return
+}
+
+// Adds a fake symbol so that a normal code has two symbols at least.
+func ensureTwoSymbols(counts []int) []int {
+	used := 0
+	for _, c := range counts {
+		if c > 0 {
+			used++
+		}
+	}
+	if used >= 2 {
+		return counts
+	}
+	result := append([]int{}, counts...)
+	for s := range result {
+		if result[s] == 0 {
+			result[s] = 1
+			if used++; used == 2 {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Writes a prefix code built from counts of symbols.
+func writePrefixCode(w *bitWriter, counts []int) *prefixCode {
+	used := []int{}
+	for s, c := range counts {
+		if c > 0 {
+			used = append(used, s)
+		}
+	}
+	code := &prefixCode{lengths: make([]uint8, len(counts))}
+	if len(used) == 0 {
+		used = append(used, 0)
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		// simple code, a single symbol takes no bits.
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		}
+		code.codes = canonicalCodes(code.lengths)
+		return code
+	}
+
+	code.lengths = huffmanLengths(ensureTwoSymbols(counts), vp8lMaxCodeLength)
+	code.codes = canonicalCodes(code.lengths)
+	tokens := codeLengthTokens(code.lengths)
+	clCounts := make([]int, vp8lCodeLengthSize)
+	for _, t := range tokens {
+		clCounts[t.code]++
+	}
+	clCode := &prefixCode{lengths: huffmanLengths(ensureTwoSymbols(clCounts), vp8lMaxCLCodeLen)}
+	clCode.codes = canonicalCodes(clCode.lengths)
+	num := vp8lCodeLengthSize
+	for num > 4 && clCode.lengths[vp8lCodeLengthOrder[num-1]] == 0 {
+		num--
+	}
+	w.write(0, 1)
+	w.write(uint32(num-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:num] {
+		w.write(uint32(clCode.lengths[s]), 3)
+	}
+	w.write(0, 1) // max_symbol is the alphabet size.
+	for _, t := range tokens {
+		clCode.write(w, t.code)
+		if t.extraBits > 0 {
+			w.write(uint32(t.extra), uint(t.extraBits))
+		}
+	}
+	return code
+}
+
+// Encodes ARGB pixels into a VP8L bitstream.
+func EncodeVP8L(pix []uint32, width, height int, hasAlpha bool) []byte {
+	symbols := vp8lSymbols(pix, width)
+	green := make([]int, 256+vp8lLengthCodes)
+	red, blue, alpha := make([]int, 256), make([]int, 256), make([]int, 256)
+	distance := make([]int, vp8lDistanceCodes)
+	for _, s := range symbols {
+		if s.length == 0 {
+			green[s.argb>>8&0xff]++
+			red[s.argb>>16&0xff]++
+			blue[s.argb&0xff]++
+			alpha[s.argb>>24]++
+		} else {
+			lc, _, _ := vp8lPrefix(s.length)
+			dc, _, _ := vp8lPrefix(s.distance)
+			green[256+lc]++
+			distance[dc]++
+		}
+	}
+
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if hasAlpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3) // version
+	w.write(0, 1) // no transform
+	w.write(0, 1) // no color cache
+	w.write(0, 1) // no meta prefix codes
+	codes := []*prefixCode{}
+	for _, counts := range [][]int{green, red, blue, alpha, distance} {
+		codes = append(codes, writePrefixCode(w, counts))
+	}
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].write(w, int(s.argb>>8&0xff))
+			codes[1].write(w, int(s.argb>>16&0xff))
+			codes[2].write(w, int(s.argb&0xff))
+			codes[3].write(w, int(s.argb>>24))
+			continue
+		}
+		lc, lBits, lExtra := vp8lPrefix(s.length)
+		codes[0].write(w, 256+lc)
+		w.write(uint32(lExtra), uint(lBits))
+		dc, dBits, dExtra := vp8lPrefix(s.distance)
+		codes[4].write(w, dc)
+		w.write(uint32(dExtra), uint(dBits))
+	}
+	return w.bytes()
+}
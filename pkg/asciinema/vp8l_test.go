@@ -0,0 +1,65 @@
+package asciinema
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/vp8l"
+)
+
+func TestEncodeVP8L(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name          string
+		width, height int
+		hasAlpha      bool
+		pixel         func(x, y int) uint32
+	}{
+		{"one pixel", 1, 1, false, func(x, y int) uint32 { return 0xff123456 }},
+		{"solid", 64, 48, false, func(x, y int) uint32 { return 0xff202020 }},
+		// longer than the max length of a backward reference.
+		{"long runs", 5000, 3, false, func(x, y int) uint32 { return 0xff000000 | uint32(y*0x40) }},
+		{"stripes", 37, 29, false, func(x, y int) uint32 {
+			if (x/3+y/5)%2 == 0 {
+				return 0xff1e1e1e
+			}
+			return 0xffd4d4d4
+		}},
+		// glyph like cells repeated on rows and columns.
+		{"text", 80, 40, false, func(x, y int) uint32 {
+			if x%8 == 2 && y%16 > 3 || y%16 == 8 && x%8 < 6 {
+				return 0xffe0e0e0
+			}
+			return 0xff000000
+		}},
+		{"noise", 61, 17, false, func(x, y int) uint32 { return 0xff000000 | r.Uint32()&0xffffff }},
+		{"alpha", 23, 19, true, func(x, y int) uint32 { return r.Uint32() }},
+	}
+	for _, tt := range tests {
+		pix := make([]uint32, tt.width*tt.height)
+		for y := 0; y < tt.height; y++ {
+			for x := 0; x < tt.width; x++ {
+				pix[y*tt.width+x] = tt.pixel(x, y)
+			}
+		}
+		img, err := vp8l.Decode(bytes.NewReader(EncodeVP8L(pix, tt.width, tt.height, tt.hasAlpha)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		nrgba, ok := img.(*image.NRGBA)
+		if !ok || nrgba.Rect.Dx() != tt.width || nrgba.Rect.Dy() != tt.height {
+			t.Errorf("%s: decoded %T of %v", tt.name, img, img.Bounds())
+			continue
+		}
+		for i, want := range pix {
+			p := nrgba.Pix[i*4 : i*4+4]
+			if got := uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2]); got != want {
+				t.Errorf("%s: pixel (%d, %d) = %08x, want %08x", tt.name, i%tt.width, i/tt.width, got, want)
+				break
+			}
+		}
+	}
+}
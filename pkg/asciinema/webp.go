@@ -0,0 +1,85 @@
+package asciinema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+Encodes frames to an animated lossless WebP,
+see https://developers.google.com/speed/webp/docs/riff_container.
+*/
+type WebpEncoder struct {
+	w       io.Writer
+	width   int
+	height  int
+	frames  [][]byte // ANMF chunks
+	elapsed int      // milliseconds
+}
+
+func NewWebpEncoder(w io.Writer) *WebpEncoder {
+	return &WebpEncoder{w: w}
+}
+
+func appendUint24(b []byte, v int) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
+
+func riffChunk(name string, data []byte) []byte {
+	chunk := append([]byte(name), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func (e *WebpEncoder) Encode(f *Frame) error {
+	if len(e.frames) == 0 {
+		b := f.Image.Bounds()
+		e.width, e.height = b.Dx(), b.Dy()
+	}
+	// offsets of frames must be even.
+	rect := f.Rect
+	rect.Min.X, rect.Min.Y = rect.Min.X&^1, rect.Min.Y&^1
+	pix := make([]uint32, 0, rect.Dx()*rect.Dy())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			p := f.Image.Pix[f.Image.PixOffset(x, y):]
+			pix = append(pix, uint32(p[3])<<24|uint32(p[0])<<16|uint32(p[1])<<8|uint32(p[2]))
+		}
+	}
+	end := int(math.Round((f.Time + f.Duration) * 1000))
+	duration := min(max(end-e.elapsed, 1), 1<<24-1)
+	e.elapsed += duration
+
+	anmf := appendUint24(nil, rect.Min.X/2)
+	anmf = appendUint24(anmf, rect.Min.Y/2)
+	anmf = appendUint24(anmf, rect.Dx()-1)
+	anmf = appendUint24(anmf, rect.Dy()-1)
+	anmf = appendUint24(anmf, duration)
+	anmf = append(anmf, 0x02) // no blending, no disposal.
+	anmf = append(anmf, riffChunk("VP8L", EncodeVP8L(pix, rect.Dx(), rect.Dy(), false))...)
+	e.frames = append(e.frames, riffChunk("ANMF", anmf))
+	return nil
+}
+
+func (e *WebpEncoder) Close() error {
+	if len(e.frames) == 0 {
+		return fmt.Errorf("no frames")
+	}
+	vp8x := []byte{0x02, 0, 0, 0} // animation
+	vp8x = appendUint24(vp8x, e.width-1)
+	vp8x = appendUint24(vp8x, e.height-1)
+	anim := []byte{0, 0, 0, 0xff, 0, 0} // background color in BGRA, loops forever.
+	content := []byte("WEBP")
+	content = append(content, riffChunk("VP8X", vp8x)...)
+	content = append(content, riffChunk("ANIM", anim)...)
+	for _, frame := range e.frames {
+		content = append(content, frame...)
+	}
+	_, err := e.w.Write(riffChunk("RIFF", content))
+	return err
+}
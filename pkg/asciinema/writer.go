@@ -0,0 +1,185 @@
+package asciinema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+Writes asciicast v2 files.
+
+Header is written as the first line, followed by events like [time, "o", data].
+*/
+type CastHeader struct {
+	Version       int               `json:"version"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Timestamp     int64             `json:"timestamp,omitempty"`
+	Duration      float64           `json:"duration,omitempty"`
+	IdleTimeLimit float64           `json:"idle_time_limit,omitempty"`
+	Command       string            `json:"command,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// Reads header and the time of the last event.
+func ReadCastHeader(fPath string) (header *CastHeader, lastTime float64, err error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	firstLine, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return
+	}
+	header = &CastHeader{}
+	if err = json.Unmarshal([]byte(firstLine), header); err != nil {
+		return nil, 0, fmt.Errorf("invalid cast header: %w", err)
+	}
+	if header.Version != 2 {
+		return nil, 0, fmt.Errorf("only asciicast v2 is supported, got v%d", header.Version)
+	}
+	for {
+		line, err1 := reader.ReadString('\n')
+		event := []interface{}{}
+		if json.Unmarshal([]byte(line), &event) == nil && len(event) > 0 {
+			if t, ok := event[0].(float64); ok && t > lastTime {
+				lastTime = t
+			}
+		}
+		if err1 != nil {
+			break
+		}
+	}
+	return header, lastTime, nil
+}
+
+type CastWriter struct {
+	fPath   string
+	file    *os.File
+	header  *CastHeader
+	offset  float64 // time of the last event in appended file.
+	last    float64
+	lock    sync.Mutex
+	pending []byte // incomplete utf-8 sequence.
+}
+
+/*
+Creates a cast file, or appends to an existing one if appendMode is true.
+Events appended are shifted after the last event, size of the existing cast is kept.
+*/
+func NewCastWriter(fPath string, header *CastHeader, appendMode bool) (w *CastWriter, err error) {
+	w = &CastWriter{fPath: fPath, header: header}
+	if appendMode {
+		if _, err1 := os.Stat(fPath); err1 == nil {
+			var old *CastHeader
+			if old, w.offset, err = ReadCastHeader(fPath); err != nil {
+				return nil, err
+			}
+			w.header = old
+			w.file, err = os.OpenFile(fPath, os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			w.ensureNewline()
+			return w, nil
+		}
+	}
+	if w.header.Version == 0 {
+		w.header.Version = 2
+	}
+	if w.header.Timestamp == 0 {
+		w.header.Timestamp = time.Now().Unix()
+	}
+	if w.file, err = os.Create(fPath); err != nil {
+		return nil, err
+	}
+	content, _ := json.Marshal(w.header)
+	_, err = w.file.Write(append(content, '\n'))
+	return
+}
+
+// Old files written by other tools may not end with a newline.
+func (w *CastWriter) ensureNewline() {
+	content, _ := os.ReadFile(w.fPath)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		w.file.Write([]byte("\n"))
+	}
+}
+
+func (w *CastWriter) Header() *CastHeader {
+	return w.header
+}
+
+// Writes an event, t is relative to the start of current recording.
+func (w *CastWriter) WriteEvent(t float64, eventType string, data []byte) (err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if eventType == "o" {
+		data = append(w.pending, data...)
+		w.pending = nil
+		if cut := incompleteUTF8Suffix(data); cut > 0 {
+			w.pending = append([]byte{}, data[len(data)-cut:]...)
+			data = data[:len(data)-cut]
+		}
+		if len(data) == 0 {
+			return
+		}
+	}
+	if t+w.offset > w.last {
+		w.last = t + w.offset
+	}
+	event, _ := json.Marshal([]interface{}{roundTime(t + w.offset), eventType, string(data)})
+	_, err = w.file.Write(append(event, '\n'))
+	return
+}
+
+/*
+Closes the file, then rewrites the header with duration updated.
+*/
+func (w *CastWriter) Close() (err error) {
+	w.lock.Lock()
+	if len(w.pending) > 0 {
+		event, _ := json.Marshal([]interface{}{roundTime(w.last), "o", string(w.pending)})
+		w.file.Write(append(event, '\n'))
+	}
+	w.lock.Unlock()
+	if err = w.file.Close(); err != nil {
+		return
+	}
+	w.header.Duration = roundTime(w.last)
+	content, err := os.ReadFile(w.fPath)
+	if err != nil {
+		return
+	}
+	_, rest, _ := strings.Cut(string(content), "\n")
+	header, _ := json.Marshal(w.header)
+	return os.WriteFile(w.fPath, []byte(string(header)+"\n"+rest), 0o644)
+}
+
+func roundTime(t float64) float64 {
+	return float64(int64(t*1e6+0.5)) / 1e6
+}
+
+// Length of a trailing incomplete utf-8 sequence.
+func incompleteUTF8Suffix(b []byte) int {
+	for i := 1; i <= 3 && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
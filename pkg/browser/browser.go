@@ -12,8 +12,13 @@ import (
 	"github.com/moond4rk/hackbrowserdata/browser"
 )
 
+// Names of supported browsers.
+func SupportedBrowsers() []string {
+	return browser.ListBrowsers()
+}
+
 func ShowSupportedBrowser() {
-	bList := browser.ListBrowsers()
+	bList := SupportedBrowsers()
 	columns := []gtable.Column{
 		{Title: "supported browsers", Width: 150},
 	}
@@ -58,7 +63,7 @@ func getBrowser(bname string) browser.Browser {
 }
 
 func supportedOrNot(bname string) bool {
-	bList := browser.ListBrowsers()
+	bList := SupportedBrowsers()
 	for _, b := range bList {
 		if b == bname {
 			return true
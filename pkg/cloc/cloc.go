@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
@@ -25,6 +26,7 @@ const (
 	FlagNotMatch       = "not-match"
 	FlagMatchDir       = "match-dir"
 	FlagNotMatchDir    = "not-match-dir"
+	FlagDiff           = "diff"
 )
 
 var (
@@ -43,6 +45,33 @@ var (
 	}
 )
 
+func sortedKeys(m map[string]struct{}) (r []string) {
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return
+}
+
+// Supported values for sort-tag.
+func SortTags() []string {
+	return sortedKeys(sortTag)
+}
+
+// Supported values for output-type.
+func OutputTypes() []string {
+	return sortedKeys(outputType)
+}
+
+// Names of languages defined by gocloc.
+func LanguageNames() (r []string) {
+	for name := range gocloc.NewDefinedLanguages().Langs {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return
+}
+
 type IContext interface {
 	String(string) string
 	Bool(string) bool
@@ -75,21 +104,43 @@ func (that *Cloc) Run() {
 	if !that.checkFlag() {
 		return
 	}
+	if that.ctx.Bool(FlagShowLang) {
+		fmt.Println(gocloc.NewDefinedLanguages().GetFormattedString())
+		return
+	}
+	if that.ctx.Bool(FlagByFile) && that.ctx.String(FlagOutputType) == "files" {
+		fmt.Println("`--sort files` option cannot be used in conjunction with the `--by-file` option")
+		os.Exit(1)
+	}
+	if that.ctx.Bool(FlagDiff) {
+		if len(that.ctx.Args()) != 2 {
+			gprint.PrintError("diff mode needs two paths or git refs")
+			return
+		}
+		that.RunDiff(that.ctx.Args()[0], that.ctx.Args()[1])
+		return
+	}
 	dir, _ := os.Getwd()
 	paths := []string{dir}
 	if len(that.ctx.Args()) > 0 {
 		cargs := that.ctx.Args()
 		paths = cargs
 	}
-	languages := gocloc.NewDefinedLanguages()
-	if that.ctx.Bool(FlagShowLang) {
-		fmt.Println(languages.GetFormattedString())
+	languages, clocOpts := that.options()
+
+	processor := gocloc.NewProcessor(languages, clocOpts)
+	var err error
+	that.result, err = processor.Analyze(paths)
+	if err != nil {
+		fmt.Printf("fail gocloc analyze. error: %v\n", err)
 		return
 	}
-	if that.ctx.Bool(FlagByFile) && that.ctx.String(FlagOutputType) == "files" {
-		fmt.Println("`--sort files` option cannot be used in conjunction with the `--by-file` option")
-		os.Exit(1)
-	}
+	that.WriteResult()
+}
+
+// Languages and options from flags.
+func (that *Cloc) options() (*gocloc.DefinedLanguages, *gocloc.ClocOptions) {
+	languages := gocloc.NewDefinedLanguages()
 	clocOpts := gocloc.NewClocOptions()
 
 	// setup option for exclude extensions
@@ -125,15 +176,7 @@ func (that *Cloc) Run() {
 
 	clocOpts.Debug = that.ctx.Bool(FlagDebug)
 	clocOpts.SkipDuplicated = that.ctx.Bool(FlagSkipDuplicated)
-
-	processor := gocloc.NewProcessor(languages, clocOpts)
-	var err error
-	that.result, err = processor.Analyze(paths)
-	if err != nil {
-		fmt.Printf("fail gocloc analyze. error: %v\n", err)
-		return
-	}
-	that.WriteResult()
+	return languages, clocOpts
 }
 
 const (
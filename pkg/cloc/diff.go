@@ -0,0 +1,548 @@
+package cloc
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/hhatto/gocloc"
+)
+
+/*
+Diff mode, like cloc --diff.
+
+Lines of files with the same relative path are compared, code and comment lines
+are diffed with whitespace trimmed, changed lines in a hunk pair up as modified,
+the rest are added or removed. Blank lines are compared by count only.
+Sides are directories, files, or git refs checked out to temp worktrees.
+*/
+const (
+	DiffSame     = "same"
+	DiffModified = "modified"
+	DiffAdded    = "added"
+	DiffRemoved  = "removed"
+)
+
+type DiffCounts struct {
+	Files   int32 `xml:"files_count,attr" json:"files"`
+	Blank   int32 `xml:"blank,attr" json:"blank"`
+	Comment int32 `xml:"comment,attr" json:"comment"`
+	Code    int32 `xml:"code,attr" json:"code"`
+}
+
+func (c *DiffCounts) add(o DiffCounts) {
+	c.Files += o.Files
+	c.Blank += o.Blank
+	c.Comment += o.Comment
+	c.Code += o.Code
+}
+
+type DiffStat struct {
+	Same     DiffCounts `json:"same"`
+	Modified DiffCounts `json:"modified"`
+	Added    DiffCounts `json:"added"`
+	Removed  DiffCounts `json:"removed"`
+}
+
+func (s *DiffStat) add(o *DiffStat) {
+	s.Same.add(o.Same)
+	s.Modified.add(o.Modified)
+	s.Added.add(o.Added)
+	s.Removed.add(o.Removed)
+}
+
+func (s *DiffStat) get(state string) DiffCounts {
+	switch state {
+	case DiffModified:
+		return s.Modified
+	case DiffAdded:
+		return s.Added
+	case DiffRemoved:
+		return s.Removed
+	default:
+		return s.Same
+	}
+}
+
+// Lines changed in a column, for sorting.
+func (s *DiffStat) churn(tag string) int32 {
+	switch tag {
+	case "files":
+		return s.Modified.Files + s.Added.Files + s.Removed.Files
+	case "blank":
+		return s.Modified.Blank + s.Added.Blank + s.Removed.Blank
+	case "comment":
+		return s.Modified.Comment + s.Added.Comment + s.Removed.Comment
+	default:
+		return s.Modified.Code + s.Added.Code + s.Removed.Code
+	}
+}
+
+type LanguageDiff struct {
+	Name string `json:"name"`
+	DiffStat
+}
+
+type FileDiff struct {
+	Name  string `json:"name"`
+	Lang  string `json:"language"`
+	State string `json:"state"`
+	DiffStat
+}
+
+type DiffResult struct {
+	Languages []*LanguageDiff `json:"languages,omitempty"`
+	Files     []*FileDiff     `json:"files,omitempty"`
+	Total     DiffStat        `json:"total"`
+}
+
+// Lines of a file classified by gocloc.
+type fileLines struct {
+	lang     string
+	code     []string
+	comments []string
+	blanks   int32
+}
+
+func analyzeLines(fPath string, lang *gocloc.Language, opts *gocloc.ClocOptions) *fileLines {
+	fl := &fileLines{lang: lang.Name}
+	o := *opts
+	o.OnCode = func(line string) { fl.code = append(fl.code, line) }
+	o.OnComment = func(line string) { fl.comments = append(fl.comments, line) }
+	o.OnBlank = func(line string) { fl.blanks++ }
+	gocloc.AnalyzeFile(fPath, lang, &o)
+	return fl
+}
+
+// Lines of files under root, keyed by slash separated paths relative to root.
+func analyzeTree(root string, languages *gocloc.DefinedLanguages, opts *gocloc.ClocOptions) (files map[string]*fileLines, err error) {
+	result, err := gocloc.NewProcessor(languages, opts).Analyze([]string{root})
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return
+	}
+	files = map[string]*fileLines{}
+	for fPath, cf := range result.Files {
+		name := filepath.Base(fPath)
+		if info.IsDir() {
+			if name, err = filepath.Rel(root, fPath); err != nil {
+				return
+			}
+		}
+		files[filepath.ToSlash(name)] = analyzeLines(fPath, result.Languages[cf.Lang], opts)
+	}
+	return
+}
+
+/*
+Counts lines kept, modified, added and removed from a to b with the Myers diff,
+changed lines are paired up as modified in each hunk.
+*/
+const maxDiffDistance = 4000
+
+func diffLines(a, b []string) (same, modified, added, removed int32) {
+	// common prefix and suffix.
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b, same = a[1:], b[1:], same+1
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b, same = a[:len(a)-1], b[:len(b)-1], same+1
+	}
+	hunkDel, hunkIns := int32(0), int32(0)
+	flush := func() {
+		m := min(hunkDel, hunkIns)
+		modified += m
+		removed += hunkDel - m
+		added += hunkIns - m
+		hunkDel, hunkIns = 0, 0
+	}
+	ops := myersOps(a, b)
+	if ops == nil {
+		// too different, the whole range is one hunk.
+		hunkDel, hunkIns = int32(len(a)), int32(len(b))
+	}
+	for _, op := range ops {
+		switch op {
+		case '=':
+			flush()
+			same++
+		case '-':
+			hunkDel++
+		case '+':
+			hunkIns++
+		}
+	}
+	flush()
+	return
+}
+
+/*
+Edit script from a to b, nil if the edit distance exceeds maxDiffDistance.
+The linear space variant of Myers: the middle snake of the shortest edit path
+splits the problem in two, so only two V arrays are kept instead of one per edit.
+*/
+func myersOps(a, b []string) []byte {
+	ops := make([]byte, 0, len(a)+len(b))
+	if !myersSplit(a, b, maxDiffDistance, &ops) {
+		return nil
+	}
+	return ops
+}
+
+func myersSplit(a, b []string, maxD int, ops *[]byte) bool {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		*ops = append(*ops, strings.Repeat("-", n)+strings.Repeat("+", m)...)
+		return true
+	}
+	x, y, u, v, d, ok := middleSnake(a, b, maxD)
+	if !ok {
+		return false
+	}
+	if d <= 1 {
+		// at most one line is removed or added.
+		i := 0
+		for i < n && i < m && a[i] == b[i] {
+			i++
+		}
+		*ops = append(*ops, strings.Repeat("=", i)...)
+		switch {
+		case n > m:
+			*ops = append(*ops, '-')
+		case m > n:
+			*ops = append(*ops, '+')
+		}
+		*ops = append(*ops, strings.Repeat("=", min(n, m)-i)...)
+		return true
+	}
+	// sub problems never need more edits than the whole one.
+	myersSplit(a[:x], b[:y], d, ops)
+	*ops = append(*ops, strings.Repeat("=", u-x)...)
+	myersSplit(a[u:], b[v:], d, ops)
+	return true
+}
+
+/*
+Searches from both ends for the middle snake, which is from (x, y) to (u, v).
+d is the edit distance of a and b, ok is false if it exceeds maxD.
+vb is the furthest x counted from the ends on the reversed diagonals, kb = n-m-k.
+*/
+func middleSnake(a, b []string, maxD int) (x, y, u, v, d int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	limit := min((n+m+1)/2, (maxD+1)/2)
+	offset := limit + 1
+	vf, vb := make([]int, 2*limit+3), make([]int, 2*limit+3)
+	for h := 0; h <= limit; h++ {
+		for k := -h; k <= h; k += 2 {
+			if k == -h || (k != h && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u, v = u+1, v+1
+			}
+			vf[offset+k] = u
+			if kb := delta - k; odd && kb >= -(h-1) && kb <= h-1 && u+vb[offset+kb] >= n {
+				return x, y, u, v, 2*h - 1, 2*h-1 <= maxD
+			}
+		}
+		for kb := -h; kb <= h; kb += 2 {
+			var xb int
+			if kb == -h || (kb != h && vb[offset+kb-1] < vb[offset+kb+1]) {
+				xb = vb[offset+kb+1]
+			} else {
+				xb = vb[offset+kb-1] + 1
+			}
+			yb := xb - kb
+			ub, ubY := xb, yb
+			for ub < n && ubY < m && a[n-1-ub] == b[m-1-ubY] {
+				ub, ubY = ub+1, ubY+1
+			}
+			vb[offset+kb] = ub
+			if k := delta - kb; !odd && k >= -h && k <= h && vf[offset+k]+ub >= n {
+				return n - ub, m - ubY, n - xb, m - yb, 2 * h, 2*h <= maxD
+			}
+		}
+	}
+	return 0, 0, 0, 0, 0, false
+}
+
+func diffFile(a, b *fileLines) (stat *DiffStat) {
+	stat = &DiffStat{}
+	switch {
+	case a == nil:
+		stat.Added = DiffCounts{Files: 1, Blank: b.blanks, Comment: int32(len(b.comments)), Code: int32(len(b.code))}
+		return
+	case b == nil:
+		stat.Removed = DiffCounts{Files: 1, Blank: a.blanks, Comment: int32(len(a.comments)), Code: int32(len(a.code))}
+		return
+	}
+	stat.Same.Code, stat.Modified.Code, stat.Added.Code, stat.Removed.Code = diffLines(a.code, b.code)
+	stat.Same.Comment, stat.Modified.Comment, stat.Added.Comment, stat.Removed.Comment = diffLines(a.comments, b.comments)
+	stat.Same.Blank = min(a.blanks, b.blanks)
+	stat.Added.Blank, stat.Removed.Blank = max(b.blanks-a.blanks, 0), max(a.blanks-b.blanks, 0)
+	if stat.churn("code")+stat.churn("comment")+stat.churn("blank") == 0 {
+		stat.Same.Files = 1
+	} else {
+		stat.Modified.Files = 1
+	}
+	return
+}
+
+// Diffs files of two trees, files are matched by relative paths.
+func diffTrees(a, b map[string]*fileLines) (result *DiffResult) {
+	result = &DiffResult{}
+	names := map[string]struct{}{}
+	for name := range a {
+		names[name] = struct{}{}
+	}
+	for name := range b {
+		names[name] = struct{}{}
+	}
+	langs := map[string]*LanguageDiff{}
+	for name := range names {
+		fa, fb := a[name], b[name]
+		fd := &FileDiff{Name: name, DiffStat: *diffFile(fa, fb)}
+		if fb != nil {
+			fd.Lang = fb.lang
+		} else {
+			fd.Lang = fa.lang
+		}
+		for _, state := range []string{DiffSame, DiffModified, DiffAdded, DiffRemoved} {
+			if fd.get(state).Files > 0 {
+				fd.State = state
+			}
+		}
+		result.Files = append(result.Files, fd)
+		if langs[fd.Lang] == nil {
+			langs[fd.Lang] = &LanguageDiff{Name: fd.Lang}
+			result.Languages = append(result.Languages, langs[fd.Lang])
+		}
+		langs[fd.Lang].add(&fd.DiffStat)
+		result.Total.add(&fd.DiffStat)
+	}
+	return
+}
+
+func (r *DiffResult) sort(tag string) {
+	if tag == "name" {
+		sort.Slice(r.Languages, func(i, j int) bool { return r.Languages[i].Name < r.Languages[j].Name })
+		sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Name < r.Files[j].Name })
+		return
+	}
+	sort.SliceStable(r.Languages, func(i, j int) bool {
+		ci, cj := r.Languages[i].churn(tag), r.Languages[j].churn(tag)
+		if ci == cj {
+			return r.Languages[i].Name < r.Languages[j].Name
+		}
+		return ci > cj
+	})
+	sort.SliceStable(r.Files, func(i, j int) bool {
+		ci, cj := r.Files[i].churn(tag), r.Files[j].churn(tag)
+		if ci == cj {
+			return r.Files[i].Name < r.Files[j].Name
+		}
+		return ci > cj
+	})
+}
+
+// Runs git in dir, the trimmed output is returned.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+/*
+A side of the diff, a path or a git ref of the repo in the current dir.
+Refs are checked out to temp worktrees, which are removed by cleanup.
+*/
+func resolveDiffSide(side string) (root string, cleanup func(), err error) {
+	cleanup = func() {}
+	if _, err = os.Stat(side); err == nil {
+		return side, cleanup, nil
+	}
+	cwd, _ := os.Getwd()
+	if _, err = git(cwd, "rev-parse", "--verify", "--quiet", side+"^{commit}"); err != nil {
+		return "", cleanup, fmt.Errorf("%s is neither a path nor a git ref", side)
+	}
+	// the worktree covers the whole repo, the current sub dir is counted only.
+	prefix, err := git(cwd, "rev-parse", "--show-prefix")
+	if err != nil {
+		return
+	}
+	tmp, err := os.MkdirTemp("", "gvc-cloc-*")
+	if err != nil {
+		return
+	}
+	worktree := filepath.Join(tmp, "worktree")
+	if _, err = git(cwd, "worktree", "add", "--detach", worktree, side); err != nil {
+		os.RemoveAll(tmp)
+		return
+	}
+	cleanup = func() {
+		git(cwd, "worktree", "remove", "--force", worktree)
+		os.RemoveAll(tmp)
+		git(cwd, "worktree", "prune")
+	}
+	return filepath.Join(worktree, filepath.FromSlash(prefix)), cleanup, nil
+}
+
+func (that *Cloc) RunDiff(from, to string) {
+	if that.ctx.String(FlagOutputType) == OutputTypeSloccount {
+		gprint.PrintError("output type %s is not supported in diff mode", OutputTypeSloccount)
+		return
+	}
+	languages, clocOpts := that.options()
+	trees := make([]map[string]*fileLines, 2)
+	for i, side := range []string{from, to} {
+		root, cleanup, err := resolveDiffSide(side)
+		if err != nil {
+			gprint.PrintError("%+v", err)
+			return
+		}
+		trees[i], err = analyzeTree(root, languages, clocOpts)
+		cleanup()
+		if err != nil {
+			gprint.PrintError("fail gocloc analyze. error: %v", err)
+			return
+		}
+	}
+	result := diffTrees(trees[0], trees[1])
+	result.sort(that.ctx.String(FlagSortTag))
+	if !that.ctx.Bool(FlagByFile) {
+		result.Files = nil
+	}
+	that.writeDiffResult(result)
+}
+
+type xmlDiffState struct {
+	Languages []gocloc.ClocLanguage `xml:"language,omitempty"`
+	Files     []xmlDiffFile         `xml:"file,omitempty"`
+	Total     DiffCounts            `xml:"total"`
+}
+
+type xmlDiffFile struct {
+	Name string `xml:"name,attr"`
+	Lang string `xml:"language,attr"`
+	DiffCounts
+}
+
+// Same layout as diff results of cloc.
+type xmlDiffResult struct {
+	XMLName  xml.Name     `xml:"diff_results"`
+	Same     xmlDiffState `xml:"same"`
+	Modified xmlDiffState `xml:"modified"`
+	Added    xmlDiffState `xml:"added"`
+	Removed  xmlDiffState `xml:"removed"`
+}
+
+func (r *DiffResult) xmlState(state string) (s xmlDiffState) {
+	s.Total = r.Total.get(state)
+	if r.Files != nil {
+		for _, f := range r.Files {
+			if counts := f.get(state); counts != (DiffCounts{}) {
+				s.Files = append(s.Files, xmlDiffFile{Name: f.Name, Lang: f.Lang, DiffCounts: counts})
+			}
+		}
+		return
+	}
+	for _, l := range r.Languages {
+		c := l.get(state)
+		s.Languages = append(s.Languages, gocloc.ClocLanguage{Name: l.Name, FilesCount: c.Files, Code: c.Code, Comments: c.Comment, Blanks: c.Blank})
+	}
+	return
+}
+
+func (that *Cloc) writeDiffResult(result *DiffResult) {
+	switch that.ctx.String(FlagOutputType) {
+	case OutputTypeClocXML:
+		x := &xmlDiffResult{
+			Same:     result.xmlState(DiffSame),
+			Modified: result.xmlState(DiffModified),
+			Added:    result.xmlState(DiffAdded),
+			Removed:  result.xmlState(DiffRemoved),
+		}
+		if output, err := xml.MarshalIndent(x, "", "  "); err == nil {
+			fmt.Printf(xml.Header)
+			fmt.Println(string(output))
+		}
+	case OutputTypeJSON:
+		buf, err := json.Marshal(result)
+		if err != nil {
+			fmt.Println(err)
+			panic("json marshal error")
+		}
+		os.Stdout.Write(buf)
+	default:
+		columns := []gtable.Column{
+			{Title: "Language", Width: 36},
+			{Title: "Files", Width: 20},
+			{Title: "Blank", Width: 20},
+			{Title: "Comment", Width: 20},
+			{Title: "Code", Width: 20},
+		}
+		if result.Files != nil {
+			columns[0] = gtable.Column{Title: "File", Width: 56}
+			columns[1] = gtable.Column{Title: "State", Width: 10}
+			columns[2].Width, columns[3].Width, columns[4].Width = 10, 10, 10
+		}
+		rows := []gtable.Row{}
+		addRows := func(name, extra string, stat *DiffStat) {
+			for _, state := range []string{DiffSame, DiffModified, DiffAdded, DiffRemoved} {
+				c := stat.get(state)
+				files := fmt.Sprintf("%d", c.Files)
+				if result.Files != nil {
+					files = extra
+				}
+				rows = append(rows, gtable.Row{
+					gprint.YellowStr(name) + "  " + state,
+					files,
+					fmt.Sprintf("%d", c.Blank),
+					fmt.Sprintf("%d", c.Comment),
+					fmt.Sprintf("%d", c.Code),
+				})
+				name = strings.Repeat(" ", len(name))
+			}
+		}
+		if result.Files != nil {
+			for _, f := range result.Files {
+				if f.State != DiffSame {
+					addRows(f.Name, f.State, &f.DiffStat)
+				}
+			}
+		} else {
+			for _, l := range result.Languages {
+				addRows(l.Name, "", &l.DiffStat)
+			}
+		}
+		addRows("Sum", "", &result.Total)
+		t := gtable.NewTable(
+			gtable.WithColumns(columns),
+			gtable.WithRows(rows),
+			gtable.WithFocused(true),
+			gtable.WithHeight(15),
+			gtable.WithWidth(125),
+		)
+		t.Run()
+	}
+}
@@ -0,0 +1,183 @@
+package cloc
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, " ")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name                           string
+		a, b                           string
+		same, modified, added, removed int32
+	}{
+		{"equal", "a b c", "a b c", 3, 0, 0, 0},
+		{"both empty", "", "", 0, 0, 0, 0},
+		{"all added", "", "a b", 0, 0, 2, 0},
+		{"all removed", "a b", "", 0, 0, 0, 2},
+		{"modified", "a b c", "a x c", 2, 1, 0, 0},
+		{"added in middle", "a c", "a b c", 2, 0, 1, 0},
+		{"removed at end", "a b c", "a b", 2, 0, 0, 1},
+		{"modified and added in a hunk", "a b c", "a x y c", 2, 1, 1, 0},
+		{"two hunks", "a b c d e", "a x c e", 3, 1, 0, 1},
+		{"moved", "a b c", "c a b", 2, 0, 1, 1},
+		{"all different", "a b", "x y z", 0, 2, 1, 0},
+	}
+	for _, tt := range tests {
+		same, modified, added, removed := diffLines(lines(tt.a), lines(tt.b))
+		if same != tt.same || modified != tt.modified || added != tt.added || removed != tt.removed {
+			t.Errorf("%s: got same %d, modified %d, added %d, removed %d, want %d %d %d %d", tt.name,
+				same, modified, added, removed, tt.same, tt.modified, tt.added, tt.removed)
+		}
+	}
+}
+
+func TestDiffLinesTooDifferent(t *testing.T) {
+	a, b := make([]string, 3000), make([]string, 2500)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+	}
+	for i := range b {
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+	if ops := myersOps(a, b); ops != nil {
+		t.Errorf("%d ops, want nil beyond maxDiffDistance", len(ops))
+	}
+	// the whole range is one hunk, the common prefix and suffix are kept.
+	a, b = append(append([]string{"x"}, a...), "y"), append(append([]string{"x"}, b...), "y")
+	same, modified, added, removed := diffLines(a, b)
+	if same != 2 || modified != 2500 || added != 0 || removed != 500 {
+		t.Errorf("got same %d, modified %d, added %d, removed %d", same, modified, added, removed)
+	}
+}
+
+// Length of the longest common subsequence, by dynamic programming.
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestMyersOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randLines := func() []string {
+		l := make([]string, r.Intn(40))
+		for i := range l {
+			l[i] = string(rune('a' + r.Intn(4)))
+		}
+		return l
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randLines(), randLines()
+		ops := myersOps(a, b)
+		// the script turns a into b.
+		x, y, equal := 0, 0, 0
+		for _, op := range ops {
+			switch op {
+			case '=':
+				if x >= len(a) || y >= len(b) || a[x] != b[y] {
+					t.Fatalf("%v -> %v: invalid script %s", a, b, ops)
+				}
+				x, y, equal = x+1, y+1, equal+1
+			case '-':
+				x++
+			case '+':
+				y++
+			}
+		}
+		if x != len(a) || y != len(b) {
+			t.Fatalf("%v -> %v: script %s ends at %d, %d", a, b, ops, x, y)
+		}
+		// and is the shortest one.
+		if want := lcsLength(a, b); equal != want {
+			t.Fatalf("%v -> %v: script %s keeps %d lines, want %d", a, b, ops, equal, want)
+		}
+	}
+}
+
+func TestDiffFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  *fileLines
+		want  DiffStat
+		state string
+	}{
+		{
+			name:  "added",
+			b:     &fileLines{code: lines("a b"), comments: lines("c"), blanks: 3},
+			want:  DiffStat{Added: DiffCounts{Files: 1, Blank: 3, Comment: 1, Code: 2}},
+			state: DiffAdded,
+		},
+		{
+			name:  "removed",
+			a:     &fileLines{code: lines("a"), blanks: 1},
+			want:  DiffStat{Removed: DiffCounts{Files: 1, Blank: 1, Code: 1}},
+			state: DiffRemoved,
+		},
+		{
+			name:  "same",
+			a:     &fileLines{code: lines("a b"), comments: lines("c"), blanks: 2},
+			b:     &fileLines{code: lines("a b"), comments: lines("c"), blanks: 2},
+			want:  DiffStat{Same: DiffCounts{Files: 1, Blank: 2, Comment: 1, Code: 2}},
+			state: DiffSame,
+		},
+		{
+			name: "modified",
+			a:    &fileLines{code: lines("a b c"), comments: lines("x y"), blanks: 4},
+			b:    &fileLines{code: lines("a B c d"), comments: lines("x"), blanks: 2},
+			want: DiffStat{
+				Same:     DiffCounts{Blank: 2, Comment: 1, Code: 2},
+				Modified: DiffCounts{Files: 1, Code: 1},
+				Added:    DiffCounts{Code: 1},
+				Removed:  DiffCounts{Blank: 2, Comment: 1},
+			},
+			state: DiffModified,
+		},
+		{
+			name: "blank lines only",
+			a:    &fileLines{code: lines("a"), blanks: 1},
+			b:    &fileLines{code: lines("a"), blanks: 3},
+			want: DiffStat{
+				Same:     DiffCounts{Blank: 1, Code: 1},
+				Modified: DiffCounts{Files: 1},
+				Added:    DiffCounts{Blank: 2},
+			},
+			state: DiffModified,
+		},
+	}
+	for _, tt := range tests {
+		got := diffFile(tt.a, tt.b)
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+		state := ""
+		for _, s := range []string{DiffSame, DiffModified, DiffAdded, DiffRemoved} {
+			if got.get(s).Files > 0 {
+				state = s
+			}
+		}
+		if state != tt.state {
+			t.Errorf("%s: state %s, want %s", tt.name, state, tt.state)
+		}
+	}
+}
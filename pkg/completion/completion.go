@@ -0,0 +1,122 @@
+package completion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Shell completion scripts.
+*/
+const (
+	ShellBash       string = "bash"
+	ShellZsh        string = "zsh"
+	ShellFish       string = "fish"
+	ShellPowershell string = "powershell"
+)
+
+var Shells = []string{
+	ShellBash,
+	ShellZsh,
+	ShellFish,
+	ShellPowershell,
+}
+
+// Generates completion script for a shell.
+type Generator func(w io.Writer) error
+
+func GetCompletionDir() string {
+	d := filepath.Join(conf.GetGVCWorkDir(), "completion")
+	os.MkdirAll(d, os.ModePerm)
+	return d
+}
+
+func getScriptPath(shell, binName string) string {
+	homeDir, _ := os.UserHomeDir()
+	switch shell {
+	case ShellZsh:
+		return filepath.Join(GetCompletionDir(), "_"+binName)
+	case ShellFish:
+		// fish loads completions from this dir automatically.
+		return filepath.Join(homeDir, ".config", "fish", "completions", binName+".fish")
+	case ShellPowershell:
+		return filepath.Join(GetCompletionDir(), binName+".ps1")
+	default:
+		return filepath.Join(GetCompletionDir(), binName+".bash")
+	}
+}
+
+func getRCFilePath(shell string) string {
+	homeDir, _ := os.UserHomeDir()
+	switch shell {
+	case ShellBash:
+		return filepath.Join(homeDir, ".bashrc")
+	case ShellZsh:
+		return filepath.Join(homeDir, ".zshrc")
+	case ShellPowershell:
+		if runtime.GOOS == gutils.Windows {
+			return filepath.Join(homeDir, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1")
+		}
+		return filepath.Join(homeDir, ".config", "powershell", "Microsoft.PowerShell_profile.ps1")
+	default:
+		return ""
+	}
+}
+
+func getSourceLine(shell, scriptPath string) string {
+	if shell == ShellPowershell {
+		return fmt.Sprintf(`. "%s"`, scriptPath)
+	}
+	return fmt.Sprintf(`source "%s"`, scriptPath)
+}
+
+// Adds the source line to rc file if it does not exist.
+func addToRCFile(rcPath, line string) (err error) {
+	content, _ := os.ReadFile(rcPath)
+	if bytes.Contains(content, []byte(line)) {
+		return
+	}
+	os.MkdirAll(filepath.Dir(rcPath), os.ModePerm)
+	s := string(content)
+	if len(s) > 0 && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	s += fmt.Sprintf("# completion for gvc\n%s\n", line)
+	return os.WriteFile(rcPath, []byte(s), 0o644)
+}
+
+/*
+Installs completion script for a shell.
+*/
+func Install(shell, binName string, gen Generator) (err error) {
+	scriptPath := getScriptPath(shell, binName)
+	os.MkdirAll(filepath.Dir(scriptPath), os.ModePerm)
+	buf := bytes.NewBuffer(nil)
+	if err = gen(buf); err != nil {
+		return
+	}
+	if err = os.WriteFile(scriptPath, buf.Bytes(), 0o644); err != nil {
+		return
+	}
+	gprint.PrintInfo("completion script: %s", scriptPath)
+
+	rcPath := getRCFilePath(shell)
+	if rcPath == "" {
+		gprint.PrintSuccess("completion for %s installed.", shell)
+		return
+	}
+	if err = addToRCFile(rcPath, getSourceLine(shell, scriptPath)); err != nil {
+		return
+	}
+	gprint.PrintSuccess("completion for %s installed, please restart your shell or source %s.", shell, rcPath)
+	return
+}
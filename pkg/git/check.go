@@ -0,0 +1,409 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/gvcgo/gvc/conf"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+/*
+Connectivity diagnostics for git.
+*/
+const DefaultCheckTimeout = 5 * time.Second
+
+var (
+	CheckDomains     = []string{"github.com", "ssh.github.com", "gitee.com"}
+	githubUserAPI    = "https://api.github.com/user"
+	giteeUserAPI     = "https://gitee.com/api/v5/user"
+	sshGreetRegExp   = regexp.MustCompile(`Hi ([^!\s]+)!`)
+	errCheckSkipped  = errors.New("skipped")
+	proxySchemeAlias = map[string]string{"socks": "socks5", "socks5h": "socks5", "https": "http"}
+)
+
+type CheckResult struct {
+	Step    string
+	Target  string
+	Latency time.Duration
+	Err     error
+	Detail  string
+	Fix     string
+}
+
+func (r *CheckResult) Passed() bool {
+	return r.Err == nil
+}
+
+type Checker struct {
+	cfg     *conf.GVConfig
+	timeout time.Duration
+	proxy   *url.URL
+	results []*CheckResult
+	passed  map[string]bool // targets passed TCP tests.
+}
+
+func NewChecker(timeout time.Duration) (c *Checker) {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	c = &Checker{
+		cfg:     conf.NewGVConfig(),
+		timeout: timeout,
+		passed:  map[string]bool{},
+	}
+	if c.cfg.LocalProxy != "" {
+		if u, err := url.Parse(c.cfg.LocalProxy); err == nil && u.Host != "" {
+			c.proxy = u
+		}
+	}
+	return
+}
+
+func (c *Checker) add(r *CheckResult) *CheckResult {
+	if r.Passed() {
+		r.Fix = ""
+	}
+	c.results = append(c.results, r)
+	return r
+}
+
+func (c *Checker) CheckDNS() {
+	for _, domain := range CheckDomains {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		start := time.Now()
+		addrs, err := net.DefaultResolver.LookupHost(ctx, domain)
+		cancel()
+		r := &CheckResult{Step: "dns", Target: domain, Latency: time.Since(start), Err: err}
+		if err == nil {
+			r.Detail = strings.Join(addrs, ", ")
+			for _, addr := range addrs {
+				if ip := net.ParseIP(addr); ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+					r.Err = fmt.Errorf("polluted result: %s", addr)
+					break
+				}
+			}
+		}
+		r.Fix = "g git hosts update, or g git dns serve"
+		c.add(r)
+	}
+}
+
+func (c *Checker) checkTCP(step, host, port string, dial func() (net.Conn, error), fix string) *CheckResult {
+	start := time.Now()
+	conn, err := dial()
+	r := &CheckResult{Step: step, Target: net.JoinHostPort(host, port), Latency: time.Since(start), Err: err, Fix: fix}
+	if err == nil {
+		conn.Close()
+	}
+	return c.add(r)
+}
+
+// TCP 22 is often blocked, ssh.github.com:443 works as a fallback.
+func (c *Checker) CheckTCP() {
+	targets := [][2]string{
+		{"github.com", "22"},
+		{"ssh.github.com", "443"},
+		{"gitee.com", "22"},
+	}
+	results := map[string]*CheckResult{}
+	for _, t := range targets {
+		host, port := t[0], t[1]
+		r := c.checkTCP("tcp", host, port, func() (net.Conn, error) {
+			return net.DialTimeout("tcp", net.JoinHostPort(host, port), c.timeout)
+		}, "enable a local proxy: g git ssh-proxy set")
+		c.passed[r.Target] = r.Passed()
+		results[r.Target] = r
+	}
+	if r := results["github.com:22"]; !r.Passed() && c.passed["ssh.github.com:443"] {
+		r.Fix = "port 22 is blocked, use ssh.github.com:443: g git ssh-proxy set ssh.github.com:443"
+	}
+}
+
+/*
+Tests local proxy with both HTTP CONNECT and SOCKS5, most local proxies serve both on a mixed port.
+*/
+func (c *Checker) CheckProxy() {
+	if c.proxy == nil {
+		c.add(&CheckResult{
+			Step:   "proxy",
+			Target: "local_proxy",
+			Err:    errCheckSkipped,
+			Fix:    "set local_proxy in " + conf.GetConfPath(),
+		})
+		return
+	}
+	configured := strings.ToLower(c.proxy.Scheme)
+	if alias, ok := proxySchemeAlias[configured]; ok {
+		configured = alias
+	}
+	for _, scheme := range []string{"http", "socks5"} {
+		u := *c.proxy
+		if scheme != configured {
+			u.Scheme = scheme
+		}
+		r := c.checkTCP("proxy("+scheme+")", "github.com", "22", func() (net.Conn, error) {
+			return DialProxy(&u, "github.com", "22", c.timeout)
+		}, "check whether local proxy is running and supports "+scheme)
+		if scheme == configured {
+			r.Detail = "configured: " + c.proxy.Redacted()
+			c.passed["proxy"] = r.Passed()
+		} else {
+			r.Detail = "alternative"
+		}
+	}
+}
+
+/*
+Signers from ssh-agent and unencrypted keys in ~/.ssh.
+Agent signers sign through the agent connection, closeAgent closes it after the handshake.
+*/
+func getSSHSigners() (signers []ssh.Signer, closeAgent func()) {
+	closeAgent = func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { conn.Close() }
+			if list, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, list...)
+			}
+		}
+	}
+	for _, k := range FindSSHKeys() {
+		content, err := os.ReadFile(k.Path)
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(content); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	return
+}
+
+// Unknown hosts are accepted, mismatched keys are rejected.
+func getHostKeyCallback() ssh.HostKeyCallback {
+	homeDir, _ := os.UserHomeDir()
+	callback, err := knownhosts.New(filepath.Join(homeDir, ".ssh", "known_hosts"))
+	if err != nil {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil
+		}
+		return err
+	}
+}
+
+/*
+Authenticates as git and parses the username from greeting like "Hi xxx! You've successfully authenticated".
+*/
+func (c *Checker) sshHandshake(host, port string, viaProxy bool) (username string, err error) {
+	addr := net.JoinHostPort(host, port)
+	var conn net.Conn
+	if viaProxy {
+		conn, err = DialProxy(c.proxy, host, port, c.timeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, c.timeout)
+	}
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * c.timeout))
+
+	signers, closeAgent := getSSHSigners()
+	defer closeAgent()
+	if len(signers) == 0 {
+		return "", fmt.Errorf("no usable ssh keys")
+	}
+	sshConf := &ssh.ClientConfig{
+		User:            "git",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: getHostKeyCallback(),
+		Timeout:         c.timeout,
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConf)
+	if err != nil {
+		return
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+	// shell access is refused, the greeting tells who we are.
+	session.Shell()
+	session.Wait()
+	if sList := sshGreetRegExp.FindStringSubmatch(output.String()); len(sList) == 2 {
+		return sList[1], nil
+	}
+	return "", fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(output.String()))
+}
+
+func (c *Checker) CheckSSH() {
+	type route struct {
+		host, port string
+		viaProxy   bool
+	}
+	targets := map[string][]route{
+		"github.com": {
+			{"github.com", "22", false},
+			{"ssh.github.com", "443", false},
+			{"github.com", "22", true},
+		},
+		"gitee.com": {
+			{"gitee.com", "22", false},
+			{"gitee.com", "22", true},
+		},
+	}
+	for _, name := range []string{"github.com", "gitee.com"} {
+		var chosen *route
+		for _, rt := range targets[name] {
+			if (rt.viaProxy && c.passed["proxy"]) || (!rt.viaProxy && c.passed[net.JoinHostPort(rt.host, rt.port)]) {
+				chosen = &rt
+				break
+			}
+		}
+		r := &CheckResult{Step: "ssh", Target: name}
+		if chosen == nil {
+			r.Err = errCheckSkipped
+			r.Fix = "no reachable route, fix tcp/proxy first"
+			c.add(r)
+			continue
+		}
+		r.Target = net.JoinHostPort(chosen.host, chosen.port)
+		if chosen.viaProxy {
+			r.Target += "(proxy)"
+		}
+		start := time.Now()
+		username, err := c.sshHandshake(chosen.host, chosen.port, chosen.viaProxy)
+		r.Latency, r.Err = time.Since(start), err
+		if err == nil {
+			r.Detail = "authenticated as " + username
+		} else if strings.Contains(err.Error(), "unable to authenticate") || strings.Contains(err.Error(), "no usable ssh keys") {
+			r.Fix = "g git ssh-keygen -r " + strings.TrimSuffix(name, ".com")
+		} else if strings.Contains(err.Error(), "key mismatch") {
+			r.Fix = "host key changed, check ~/.ssh/known_hosts"
+		} else {
+			r.Fix = "check local proxy or use ssh.github.com:443"
+		}
+		c.add(r)
+	}
+}
+
+func (c *Checker) checkHTTPS(name, apiURL, token string, header bool) {
+	r := &CheckResult{Step: "https", Target: name}
+	if token == "" {
+		r.Err = errCheckSkipped
+		r.Fix = "set token in " + conf.GetConfPath()
+		c.add(r)
+		return
+	}
+	req, _ := http.NewRequest(http.MethodGet, apiURL, nil)
+	if header {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		q := req.URL.Query()
+		q.Set("access_token", token)
+		req.URL.RawQuery = q.Encode()
+	}
+	client := newAPIClient(c.cfg)
+	client.Timeout = 3 * c.timeout
+	if c.proxy != nil {
+		r.Target += "(proxy)"
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	r.Latency = time.Since(start)
+	r.Fix = "check local proxy, or g git hosts update"
+	if err != nil {
+		r.Err = err
+		c.add(r)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		r.Err = fmt.Errorf("%s", resp.Status)
+		r.Fix = "token is invalid or expired, update it in " + conf.GetConfPath()
+		c.add(r)
+		return
+	}
+	user := struct {
+		Login string `json:"login"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&user)
+	r.Detail = "authenticated as " + user.Login
+	c.add(r)
+}
+
+func (c *Checker) CheckHTTPS() {
+	c.checkHTTPS("api.github.com", githubUserAPI, c.cfg.GitToken, true)
+	c.checkHTTPS("gitee.com", giteeUserAPI, c.cfg.GiteeToken, false)
+}
+
+func (c *Checker) Run() {
+	gprint.PrintInfo("Checking dns...")
+	c.CheckDNS()
+	gprint.PrintInfo("Checking tcp...")
+	c.CheckTCP()
+	gprint.PrintInfo("Checking local proxy...")
+	c.CheckProxy()
+	gprint.PrintInfo("Checking ssh...")
+	c.CheckSSH()
+	gprint.PrintInfo("Checking https...")
+	c.CheckHTTPS()
+	c.ShowResults()
+}
+
+func (c *Checker) ShowResults() {
+	columns := []gtable.Column{
+		{Title: "Step", Width: 14},
+		{Title: "Target", Width: 28},
+		{Title: "Result", Width: 8},
+		{Title: "Latency", Width: 10},
+		{Title: "Detail", Width: 40},
+		{Title: "Fix", Width: 50},
+	}
+	rows := []gtable.Row{}
+	for _, r := range c.results {
+		result, detail, latency := gprint.GreenStr("pass"), r.Detail, formatLatency(r.Latency)
+		switch {
+		case errors.Is(r.Err, errCheckSkipped):
+			result, latency = gprint.YellowStr("skip"), ""
+		case r.Err != nil:
+			result, detail = gprint.RedStr("fail"), r.Err.Error()
+		}
+		rows = append(rows, gtable.Row{r.Step, r.Target, result, latency, detail, r.Fix})
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(20),
+		gtable.WithWidth(160),
+	)
+	t.Run()
+}
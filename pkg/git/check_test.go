@@ -0,0 +1,57 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestGetSSHSignersClosesAgent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ssh-agent over unix socket")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(home, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if c, err := ln.Accept(); err == nil {
+			// returns when the client closes the connection.
+			agent.ServeAgent(keyring, c)
+			c.Close()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	signers, closeAgent := getSSHSigners()
+	if len(signers) != 1 {
+		t.Fatalf("%d signers, want 1 from agent", len(signers))
+	}
+	if _, err := signers[0].Sign(rand.Reader, []byte("data")); err != nil {
+		t.Fatalf("agent signer should work before closeAgent: %v", err)
+	}
+	closeAgent()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent connection is not closed")
+	}
+}
@@ -0,0 +1,606 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+A small local DNS server.
+
+Queries for configured domains are answered with the fastest IPs
+gathered from hosts sources or DoH lookups, everything else is
+forwarded to upstream and cached with TTLs.
+*/
+const (
+	DefaultDNSListen   string = "127.0.0.1:53530" // 5353 is taken by mDNS on most desktops.
+	DefaultDNSUpstream string = "udp://223.5.5.5:53"
+	DefaultDNSDoH      string = "https://1.1.1.1/dns-query"
+	DefaultDNSTTL      uint32 = 300
+	dnsNegativeTTL     uint32 = 60
+	dnsMaxPacketSize   int    = 4096
+)
+
+var DefaultDNSDomains = []string{
+	"github.com",
+	"api.github.com",
+	"gist.github.com",
+	"codeload.github.com",
+	"github.global.ssl.fastly.net",
+	"raw.githubusercontent.com",
+	"objects.githubusercontent.com",
+	"avatars.githubusercontent.com",
+	"github.githubassets.com",
+}
+
+type DNSConfig struct {
+	Listen          string
+	Upstream        string   // udp://host:port, tcp://host:port or https://host/dns-query
+	DoH             string   // DoH server for looking up configured domains, disabled if empty.
+	Domains         []string // domains answered locally and looked up via DoH.
+	TTL             uint32
+	Refresh         time.Duration // refresh interval of records, disabled if zero.
+	UseHostsSources bool
+	Timeout         time.Duration
+}
+
+func NewDNSConfig() *DNSConfig {
+	return &DNSConfig{
+		Listen:          DefaultDNSListen,
+		Upstream:        DefaultDNSUpstream,
+		DoH:             DefaultDNSDoH,
+		Domains:         DefaultDNSDomains,
+		TTL:             DefaultDNSTTL,
+		Refresh:         time.Hour,
+		UseHostsSources: true,
+		Timeout:         5 * time.Second,
+	}
+}
+
+type dnsCacheItem struct {
+	msg     []byte
+	expires time.Time
+	stored  time.Time
+}
+
+type DNSServer struct {
+	conf    *DNSConfig
+	records map[string][]net.IP // fqdn -> IPs
+	cache   map[string]*dnsCacheItem
+	lock    sync.RWMutex
+	client  *http.Client
+	udpConn net.PacketConn
+	tcpLn   net.Listener
+	done    chan struct{}
+}
+
+func NewDNSServer(cfg *DNSConfig) *DNSServer {
+	if cfg == nil {
+		cfg = NewDNSConfig()
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultDNSTTL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &DNSServer{
+		conf:    cfg,
+		records: map[string][]net.IP{},
+		cache:   map[string]*dnsCacheItem{},
+		client:  &http.Client{Timeout: cfg.Timeout},
+		done:    make(chan struct{}),
+	}
+}
+
+func toFQDN(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	return domain
+}
+
+// Replaces records with domain -> IPs.
+func (s *DNSServer) SetRecords(records map[string][]string) {
+	r := map[string][]net.IP{}
+	for domain, ipList := range records {
+		for _, ipStr := range ipList {
+			if ip := net.ParseIP(ipStr); ip != nil {
+				r[toFQDN(domain)] = append(r[toFQDN(domain)], ip)
+			}
+		}
+	}
+	s.lock.Lock()
+	s.records = r
+	s.lock.Unlock()
+}
+
+func (s *DNSServer) Records() map[string][]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	r := map[string][]string{}
+	for domain, ipList := range s.records {
+		for _, ip := range ipList {
+			r[strings.TrimSuffix(domain, ".")] = append(r[strings.TrimSuffix(domain, ".")], ip.String())
+		}
+	}
+	return r
+}
+
+/*
+Gathers candidate IPs from hosts sources and DoH lookups,
+then keeps the fastest reachable one for each domain.
+*/
+func (s *DNSServer) RefreshRecords() {
+	candidates := map[string][]string{}
+	addCandidate := func(domain, ip string) {
+		for _, old := range candidates[domain] {
+			if old == ip {
+				return
+			}
+		}
+		candidates[domain] = append(candidates[domain], ip)
+	}
+	if s.conf.UseHostsSources {
+		m := NewModifier()
+		m.GetHostsFiles()
+		for domain, ipList := range m.items {
+			// hosts sources list many more domains than configured.
+			if !s.isLocalDomain(domain) {
+				continue
+			}
+			for _, ip := range ipList {
+				addCandidate(domain, ip)
+			}
+		}
+	}
+	if s.conf.DoH != "" {
+		for _, domain := range s.conf.Domains {
+			ipList, err := s.LookupDoH(domain)
+			if err != nil {
+				gprint.PrintWarning("%+v", err)
+				continue
+			}
+			for _, ip := range ipList {
+				addCandidate(domain, ip)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		gprint.PrintWarning("No candidate IPs found, all queries will be forwarded.")
+		return
+	}
+	gprint.PrintInfo("Testing latency for %d domains...", len(candidates))
+	best := ProbeFastest(candidates, DefaultProbeTimeout, DefaultProbeWorkers)
+	records := map[string][]string{}
+	for domain, r := range best {
+		records[domain] = []string{r.IP}
+	}
+	s.SetRecords(records)
+	gprint.PrintInfo("%d domains will be answered locally.", len(records))
+}
+
+func (s *DNSServer) isLocalDomain(domain string) bool {
+	return matchDomain(s.conf.Domains, strings.TrimSuffix(strings.ToLower(domain), "."))
+}
+
+// Looks up A and AAAA records of a domain via DoH, fails only if both lookups fail.
+func (s *DNSServer) LookupDoH(domain string) (ipList []string, err error) {
+	errList := []string{}
+	for _, qType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		result, qErr := s.lookupDoH(domain, qType)
+		if qErr != nil {
+			errList = append(errList, fmt.Sprintf("%s: %v", qType, qErr))
+			continue
+		}
+		ipList = append(ipList, result...)
+	}
+	if len(errList) == 2 {
+		return nil, fmt.Errorf("lookup %s failed: %s", domain, strings.Join(errList, "; "))
+	}
+	return ipList, nil
+}
+
+func (s *DNSServer) lookupDoH(domain string, qType dnsmessage.Type) (ipList []string, err error) {
+	query, err := newQuery(domain, qType)
+	if err != nil {
+		return
+	}
+	resp, err := s.exchangeHTTPS(s.conf.DoH, query)
+	if err != nil {
+		return
+	}
+	var msg dnsmessage.Message
+	if err = msg.Unpack(resp); err != nil {
+		return
+	}
+	for _, a := range msg.Answers {
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			ipList = append(ipList, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ipList = append(ipList, net.IP(body.AAAA[:]).String())
+		}
+	}
+	return
+}
+
+func newQuery(domain string, qType dnsmessage.Type) ([]byte, error) {
+	name, err := dnsmessage.NewName(toFQDN(domain))
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  qType,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+/*
+Handles a DNS query and returns the response.
+*/
+func (s *DNSServer) Handle(query []byte) (resp []byte, err error) {
+	var msg dnsmessage.Message
+	if err = msg.Unpack(query); err != nil {
+		return
+	}
+	if len(msg.Questions) != 1 {
+		return s.forward(query)
+	}
+	q := msg.Questions[0]
+	if q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA {
+		s.lock.RLock()
+		ipList, ok := s.records[strings.ToLower(q.Name.String())]
+		s.lock.RUnlock()
+		if ok {
+			return s.answer(msg, ipList)
+		}
+	}
+
+	key := fmt.Sprintf("%s|%d|%d", strings.ToLower(q.Name.String()), q.Type, q.Class)
+	if resp, ok := s.fromCache(key, msg.ID); ok {
+		return resp, nil
+	}
+	resp, err = s.forward(query)
+	if err != nil {
+		return s.fail(msg)
+	}
+	s.toCache(key, resp)
+	return
+}
+
+// Answers a query with local records.
+func (s *DNSServer) answer(query dnsmessage.Message, ipList []net.IP) ([]byte, error) {
+	q := query.Questions[0]
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   query.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: query.Questions,
+	}
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: s.conf.TTL}
+	for _, ip := range ipList {
+		if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+			body := &dnsmessage.AResource{}
+			copy(body.A[:], ip4)
+			rh.Type = dnsmessage.TypeA
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: rh, Body: body})
+		} else if ip.To4() == nil && q.Type == dnsmessage.TypeAAAA {
+			body := &dnsmessage.AAAAResource{}
+			copy(body.AAAA[:], ip.To16())
+			rh.Type = dnsmessage.TypeAAAA
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: rh, Body: body})
+		}
+	}
+	return resp.Pack()
+}
+
+func (s *DNSServer) fail(query dnsmessage.Message) ([]byte, error) {
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			RecursionDesired:   query.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              dnsmessage.RCodeServerFailure,
+		},
+		Questions: query.Questions,
+	}
+	return resp.Pack()
+}
+
+func (s *DNSServer) fromCache(key string, id uint16) (resp []byte, ok bool) {
+	s.lock.RLock()
+	item, found := s.cache[key]
+	s.lock.RUnlock()
+	if !found || time.Now().After(item.expires) {
+		return
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(item.msg); err != nil {
+		return
+	}
+	msg.ID = id
+	elapsed := uint32(time.Since(item.stored).Seconds())
+	for _, rList := range [][]dnsmessage.Resource{msg.Answers, msg.Authorities, msg.Additionals} {
+		for i := range rList {
+			if rList[i].Header.Type == dnsmessage.TypeOPT {
+				continue
+			}
+			if rList[i].Header.TTL > elapsed {
+				rList[i].Header.TTL -= elapsed
+			} else {
+				rList[i].Header.TTL = 0
+			}
+		}
+	}
+	resp, err := msg.Pack()
+	return resp, err == nil
+}
+
+func (s *DNSServer) toCache(key string, resp []byte) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil || msg.Truncated {
+		return
+	}
+	ttl := dnsNegativeTTL
+	if msg.RCode == dnsmessage.RCodeSuccess && len(msg.Answers) > 0 {
+		ttl = msg.Answers[0].Header.TTL
+		for _, a := range msg.Answers {
+			if a.Header.TTL < ttl {
+				ttl = a.Header.TTL
+			}
+		}
+	}
+	if ttl == 0 {
+		return
+	}
+	now := time.Now()
+	s.lock.Lock()
+	s.cache[key] = &dnsCacheItem{
+		msg:     resp,
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+	s.lock.Unlock()
+}
+
+/*
+Forwards a query to upstream.
+*/
+func (s *DNSServer) forward(query []byte) (resp []byte, err error) {
+	upstream := s.conf.Upstream
+	switch {
+	case strings.HasPrefix(upstream, "https://"):
+		return s.exchangeHTTPS(upstream, query)
+	case strings.HasPrefix(upstream, "tcp://"):
+		return s.exchangeTCP(strings.TrimPrefix(upstream, "tcp://"), query)
+	default:
+		addr := strings.TrimPrefix(upstream, "udp://")
+		resp, err = s.exchangeUDP(addr, query)
+		if err == nil && len(resp) > 2 && resp[2]&0x02 != 0 {
+			// truncated, retry with tcp.
+			return s.exchangeTCP(addr, query)
+		}
+		return
+	}
+}
+
+func (s *DNSServer) exchangeUDP(addr string, query []byte) (resp []byte, err error) {
+	conn, err := net.DialTimeout("udp", addr, s.conf.Timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.conf.Timeout))
+	if _, err = conn.Write(query); err != nil {
+		return
+	}
+	buf := make([]byte, dnsMaxPacketSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return
+	}
+	return buf[:n], nil
+}
+
+func (s *DNSServer) exchangeTCP(addr string, query []byte) (resp []byte, err error) {
+	conn, err := net.DialTimeout("tcp", addr, s.conf.Timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.conf.Timeout))
+	if err = writeTCPMsg(conn, query); err != nil {
+		return
+	}
+	return readTCPMsg(conn)
+}
+
+func (s *DNSServer) exchangeHTTPS(u string, query []byte) (resp []byte, err error) {
+	if _, err = url.Parse(u); err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(query))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	r, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh server %s returned status: %d", u, r.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(r.Body, 65535))
+}
+
+func writeTCPMsg(w io.Writer, msg []byte) (err error) {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err = w.Write(buf)
+	return
+}
+
+func readTCPMsg(r io.Reader) (msg []byte, err error) {
+	var length uint16
+	if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+		return
+	}
+	msg = make([]byte, length)
+	_, err = io.ReadFull(r, msg)
+	return
+}
+
+/*
+Starts listening on udp and tcp.
+*/
+func (s *DNSServer) Start() (err error) {
+	s.udpConn, err = net.ListenPacket("udp", s.conf.Listen)
+	if err != nil {
+		return
+	}
+	s.tcpLn, err = net.Listen("tcp", s.udpConn.LocalAddr().String())
+	if err != nil {
+		s.udpConn.Close()
+		return
+	}
+	go s.serveUDP()
+	go s.serveTCP()
+	if s.conf.Refresh > 0 {
+		go s.refreshLoop()
+	}
+	return
+}
+
+// Address the server is listening on.
+func (s *DNSServer) Addr() string {
+	if s.udpConn == nil {
+		return s.conf.Listen
+	}
+	return s.udpConn.LocalAddr().String()
+}
+
+func (s *DNSServer) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+		close(s.done)
+	}
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	if s.tcpLn != nil {
+		s.tcpLn.Close()
+	}
+}
+
+func (s *DNSServer) refreshLoop() {
+	ticker := time.NewTicker(s.conf.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.RefreshRecords()
+		}
+	}
+}
+
+func (s *DNSServer) serveUDP() {
+	buf := make([]byte, dnsMaxPacketSize)
+	for {
+		n, addr, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func() {
+			if resp, err := s.Handle(query); err == nil {
+				s.udpConn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *DNSServer) serveTCP() {
+	for {
+		conn, err := s.tcpLn.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			for {
+				c.SetDeadline(time.Now().Add(30 * time.Second))
+				query, err := readTCPMsg(c)
+				if err != nil {
+					return
+				}
+				resp, err := s.Handle(query)
+				if err != nil {
+					return
+				}
+				if err = writeTCPMsg(c, resp); err != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+}
+
+/*
+Config snippet for systemd-resolved.
+*/
+var ResolvedConfTemplate string = `# /etc/systemd/resolved.conf.d/gvc.conf
+[Resolve]
+DNS=%s
+Domains=%s
+`
+
+func ResolvedConf(listen string, domains []string) string {
+	routing := []string{}
+	seen := map[string]struct{}{}
+	for _, d := range domains {
+		parts := strings.Split(strings.Trim(d, "."), ".")
+		if len(parts) < 2 {
+			continue
+		}
+		// route the registrable domain to local server.
+		root := strings.Join(parts[len(parts)-2:], ".")
+		if _, ok := seen[root]; ok {
+			continue
+		}
+		seen[root] = struct{}{}
+		routing = append(routing, "~"+root)
+	}
+	return fmt.Sprintf(ResolvedConfTemplate, listen, strings.Join(routing, " "))
+}
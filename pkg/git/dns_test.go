@@ -0,0 +1,378 @@
+package git
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+A fake upstream listening on udp and tcp of the same port.
+Answers A queries with udpIP over udp and tcpIP over tcp.
+*/
+type fakeUpstream struct {
+	udpConn   net.PacketConn
+	tcpLn     net.Listener
+	udpIP     [4]byte
+	tcpIP     [4]byte
+	truncate  bool // replies over udp with TC bit and no answers.
+	udpCount  atomic.Int32
+	tcpCount  atomic.Int32
+	answerTTL uint32
+}
+
+func newFakeUpstream(t *testing.T, truncate bool) *fakeUpstream {
+	t.Helper()
+	u := &fakeUpstream{
+		udpIP:     [4]byte{1, 2, 3, 4},
+		tcpIP:     [4]byte{5, 6, 7, 8},
+		truncate:  truncate,
+		answerTTL: 120,
+	}
+	var err error
+	u.udpConn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.tcpLn, err = net.Listen("tcp", u.udpConn.LocalAddr().String())
+	if err != nil {
+		u.udpConn.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		u.udpConn.Close()
+		u.tcpLn.Close()
+	})
+	go u.serveUDP()
+	go u.serveTCP()
+	return u
+}
+
+func (u *fakeUpstream) addr() string {
+	return u.udpConn.LocalAddr().String()
+}
+
+func (u *fakeUpstream) reply(query []byte, ip [4]byte, truncated bool) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 msg.ID,
+			Response:           true,
+			Truncated:          truncated,
+			RecursionAvailable: true,
+		},
+		Questions: msg.Questions,
+	}
+	if !truncated {
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{
+				Name:  msg.Questions[0].Name,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+				TTL:   u.answerTTL,
+			},
+			Body: &dnsmessage.AResource{A: ip},
+		}}
+	}
+	b, _ := resp.Pack()
+	return b
+}
+
+func (u *fakeUpstream) serveUDP() {
+	buf := make([]byte, dnsMaxPacketSize)
+	for {
+		n, addr, err := u.udpConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		u.udpCount.Add(1)
+		u.udpConn.WriteTo(u.reply(buf[:n], u.udpIP, u.truncate), addr)
+	}
+}
+
+func (u *fakeUpstream) serveTCP() {
+	for {
+		conn, err := u.tcpLn.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			query, err := readTCPMsg(c)
+			if err != nil {
+				return
+			}
+			u.tcpCount.Add(1)
+			writeTCPMsg(c, u.reply(query, u.tcpIP, false))
+		}(conn)
+	}
+}
+
+func newTestDNSServer(upstream string) *DNSServer {
+	return NewDNSServer(&DNSConfig{
+		Upstream:        upstream,
+		Domains:         []string{"github.com", "*.githubusercontent.com"},
+		TTL:             60,
+		UseHostsSources: false,
+		Timeout:         2 * time.Second,
+	})
+}
+
+func testQuery(t *testing.T, id uint16, domain string, qType dnsmessage.Type) []byte {
+	t.Helper()
+	name := dnsmessage.MustNewName(toFQDN(domain))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qType, Class: dnsmessage.ClassINET}},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func parseAnswers(t *testing.T, resp []byte) (msg dnsmessage.Message, ipList []string) {
+	t.Helper()
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range msg.Answers {
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			ipList = append(ipList, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ipList = append(ipList, net.IP(body.AAAA[:]).String())
+		}
+	}
+	return
+}
+
+func TestDNSLocalAnswer(t *testing.T) {
+	upstream := newFakeUpstream(t, false)
+	s := newTestDNSServer("udp://" + upstream.addr())
+	s.SetRecords(map[string][]string{
+		"GitHub.com": {"140.82.112.3", "2606:50c0:8000::154", "invalid"},
+	})
+
+	tests := []struct {
+		qType dnsmessage.Type
+		want  string
+	}{
+		{dnsmessage.TypeA, "140.82.112.3"},
+		{dnsmessage.TypeAAAA, "2606:50c0:8000::154"},
+	}
+	for _, tt := range tests {
+		resp, err := s.Handle(testQuery(t, 42, "github.com", tt.qType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, ipList := parseAnswers(t, resp)
+		if msg.ID != 42 || !msg.Response || !msg.Authoritative {
+			t.Errorf("unexpected header: %+v", msg.Header)
+		}
+		if len(ipList) != 1 || ipList[0] != tt.want {
+			t.Errorf("%v answers = %v, want %s", tt.qType, ipList, tt.want)
+		}
+		if msg.Answers[0].Header.TTL != 60 {
+			t.Errorf("ttl = %d, want 60", msg.Answers[0].Header.TTL)
+		}
+	}
+	if n := upstream.udpCount.Load() + upstream.tcpCount.Load(); n != 0 {
+		t.Errorf("local records should not be forwarded, upstream got %d queries", n)
+	}
+}
+
+func TestDNSForward(t *testing.T) {
+	upstream := newFakeUpstream(t, false)
+	s := newTestDNSServer("udp://" + upstream.addr())
+	s.SetRecords(map[string][]string{"github.com": {"140.82.112.3"}})
+
+	for i, id := range []uint16{1, 2} {
+		resp, err := s.Handle(testQuery(t, id, "example.com", dnsmessage.TypeA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, ipList := parseAnswers(t, resp)
+		if msg.ID != id {
+			t.Errorf("query %d: id = %d, want %d", i, msg.ID, id)
+		}
+		if len(ipList) != 1 || ipList[0] != "1.2.3.4" {
+			t.Errorf("query %d: answers = %v, want [1.2.3.4]", i, ipList)
+		}
+		if ttl := msg.Answers[0].Header.TTL; ttl == 0 || ttl > upstream.answerTTL {
+			t.Errorf("query %d: ttl = %d", i, ttl)
+		}
+	}
+	// the second one is answered from cache.
+	if n := upstream.udpCount.Load(); n != 1 {
+		t.Errorf("upstream got %d udp queries, want 1", n)
+	}
+
+	// tcp upstream.
+	s = newTestDNSServer("tcp://" + upstream.addr())
+	resp, err := s.Handle(testQuery(t, 3, "example.org", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ipList := parseAnswers(t, resp); len(ipList) != 1 || ipList[0] != "5.6.7.8" {
+		t.Errorf("tcp upstream answers = %v, want [5.6.7.8]", ipList)
+	}
+}
+
+func TestDNSTruncatedRetry(t *testing.T) {
+	upstream := newFakeUpstream(t, true)
+	s := newTestDNSServer("udp://" + upstream.addr())
+
+	resp, err := s.Handle(testQuery(t, 7, "example.com", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, ipList := parseAnswers(t, resp)
+	if msg.Truncated {
+		t.Error("response should not be truncated after tcp retry")
+	}
+	if len(ipList) != 1 || ipList[0] != "5.6.7.8" {
+		t.Errorf("answers = %v, want [5.6.7.8] from tcp", ipList)
+	}
+	if upstream.udpCount.Load() != 1 || upstream.tcpCount.Load() != 1 {
+		t.Errorf("upstream got %d udp and %d tcp queries, want 1 and 1",
+			upstream.udpCount.Load(), upstream.tcpCount.Load())
+	}
+}
+
+func TestDNSUpstreamFailure(t *testing.T) {
+	// nothing is listening on this port.
+	ln, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	addr := ln.LocalAddr().String()
+	ln.Close()
+
+	s := newTestDNSServer("udp://" + addr)
+	s.conf.Timeout = 200 * time.Millisecond
+	resp, err := s.Handle(testQuery(t, 9, "example.com", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := parseAnswers(t, resp)
+	if msg.RCode != dnsmessage.RCodeServerFailure || msg.ID != 9 {
+		t.Errorf("unexpected header: %+v", msg.Header)
+	}
+}
+
+func TestDNSServerListen(t *testing.T) {
+	upstream := newFakeUpstream(t, false)
+	s := newTestDNSServer("udp://" + upstream.addr())
+	s.conf.Listen = "127.0.0.1:0"
+	s.SetRecords(map[string][]string{"raw.githubusercontent.com": {"185.199.108.133"}})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	udpResp, err := s.exchangeUDP(s.Addr(), testQuery(t, 1, "raw.githubusercontent.com", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ipList := parseAnswers(t, udpResp); len(ipList) != 1 || ipList[0] != "185.199.108.133" {
+		t.Errorf("udp answers = %v", ipList)
+	}
+	tcpResp, err := s.exchangeTCP(s.Addr(), testQuery(t, 2, "example.com", dnsmessage.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ipList := parseAnswers(t, tcpResp); len(ipList) != 1 || ipList[0] != "1.2.3.4" {
+		t.Errorf("tcp answers = %v", ipList)
+	}
+}
+
+func TestDNSIsLocalDomain(t *testing.T) {
+	s := newTestDNSServer("")
+	tests := map[string]bool{
+		"github.com":                true,
+		"GitHub.com.":               true,
+		"raw.githubusercontent.com": true,
+		"githubusercontent.com":     true,
+		"api.github.com":            false,
+		"example.com":               false,
+	}
+	for domain, want := range tests {
+		if got := s.isLocalDomain(domain); got != want {
+			t.Errorf("isLocalDomain(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+// A DoH server answering A queries with upstream's udpIP, failed types get 500.
+func newFakeDoH(t *testing.T, upstream *fakeUpstream, failed ...dnsmessage.Type) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		var msg dnsmessage.Message
+		if msg.Unpack(query) != nil || len(msg.Questions) != 1 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		for _, qType := range failed {
+			if msg.Questions[0].Type == qType {
+				http.Error(w, "failed", http.StatusInternalServerError)
+				return
+			}
+		}
+		if msg.Questions[0].Type != dnsmessage.TypeA {
+			// no records of other types.
+			resp := dnsmessage.Message{Header: dnsmessage.Header{ID: msg.ID, Response: true}, Questions: msg.Questions}
+			b, _ := resp.Pack()
+			w.Write(b)
+			return
+		}
+		w.Write(upstream.reply(query, upstream.udpIP, false))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestDNSLookupDoH(t *testing.T) {
+	upstream := newFakeUpstream(t, false)
+	tests := []struct {
+		name    string
+		failed  []dnsmessage.Type
+		want    []string
+		wantErr bool
+	}{
+		{name: "ok", want: []string{"1.2.3.4"}},
+		{name: "AAAA failed", failed: []dnsmessage.Type{dnsmessage.TypeAAAA}, want: []string{"1.2.3.4"}},
+		{name: "A failed", failed: []dnsmessage.Type{dnsmessage.TypeA}},
+		{name: "both failed", failed: []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}, wantErr: true},
+	}
+	for _, tt := range tests {
+		s := newTestDNSServer("")
+		s.conf.DoH = newFakeDoH(t, upstream, tt.failed...)
+		ipList, err := s.LookupDoH("github.com")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if strings.Join(ipList, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: ips = %v, want %v", tt.name, ipList, tt.want)
+		}
+	}
+}
+
+func TestResolvedConf(t *testing.T) {
+	conf := ResolvedConf("127.0.0.1:53530", []string{"gitlab.com", "*.gitlab-static.net", "registry.gitlab.com", "localhost"})
+	if !strings.Contains(conf, "DNS=127.0.0.1:53530\n") {
+		t.Errorf("conf:\n%s", conf)
+	}
+	if !strings.Contains(conf, "Domains=~gitlab.com ~gitlab-static.net\n") {
+		t.Errorf("conf:\n%s", conf)
+	}
+}
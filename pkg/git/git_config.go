@@ -0,0 +1,283 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Manages http proxies and mirrors for git in a block of ~/.gitconfig.
+*/
+const (
+	GitConfigBlockStart string = "# FromGVC Git Start"
+	GitConfigBlockEnd   string = "# FromGVC Git End"
+)
+
+var GitConfigBlockRegExp = regexp.MustCompile(`(?s)` + regexp.QuoteMeta(GitConfigBlockStart) + `.*?` + regexp.QuoteMeta(GitConfigBlockEnd) + `\n?`)
+
+var (
+	DefaultGitProxyURLs  = []string{"https://github.com"}
+	DefaultGitMirrorURLs = []string{"https://github.com/"}
+)
+
+var gitSectionRegExp = regexp.MustCompile(`^\[(\w+)\s+"(.+)"\]$`)
+
+func getGitConfigPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".gitconfig")
+}
+
+// Settings in the managed block.
+type GitHTTPSettings struct {
+	Proxies map[string]string // url -> proxy
+	Mirrors map[string]string // original url -> mirrored url
+}
+
+func NewGitHTTPSettings() *GitHTTPSettings {
+	return &GitHTTPSettings{
+		Proxies: map[string]string{},
+		Mirrors: map[string]string{},
+	}
+}
+
+// Parses the managed block, only [http "<url>"] proxy and [url "<mirror>"] insteadOf are recognized.
+func ParseGitConfigBlock(block string) (s *GitHTTPSettings) {
+	s = NewGitHTTPSettings()
+	var section, subsection string
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if sList := gitSectionRegExp.FindStringSubmatch(line); len(sList) == 3 {
+			section, subsection = strings.ToLower(sList[1]), sList[2]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch {
+		case section == "http" && key == "proxy":
+			s.Proxies[subsection] = value
+		case section == "url" && key == "insteadof":
+			s.Mirrors[value] = subsection
+		}
+	}
+	return
+}
+
+func (s *GitHTTPSettings) IsEmpty() bool {
+	return len(s.Proxies) == 0 && len(s.Mirrors) == 0
+}
+
+func (s *GitHTTPSettings) Render() string {
+	lines := []string{GitConfigBlockStart}
+	for _, u := range sortedDomains(s.Proxies) {
+		lines = append(lines, fmt.Sprintf(`[http "%s"]`, u), "\tproxy = "+s.Proxies[u])
+	}
+	for _, u := range sortedDomains(s.Mirrors) {
+		lines = append(lines, fmt.Sprintf(`[url "%s"]`, s.Mirrors[u]), "\tinsteadOf = "+u)
+	}
+	lines = append(lines, GitConfigBlockEnd)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+/*
+Reads settings in the managed block and the content outside of it.
+*/
+func readGitConfig() (s *GitHTTPSettings, rest string) {
+	content, _ := os.ReadFile(getGitConfigPath())
+	block := GitConfigBlockRegExp.FindString(string(content))
+	rest = GitConfigBlockRegExp.ReplaceAllLiteralString(string(content), "")
+	return ParseGitConfigBlock(block), rest
+}
+
+/*
+Writes the managed block to the end of ~/.gitconfig, git uses the last value of each key.
+The block is removed when it is empty.
+*/
+func writeGitConfig(s *GitHTTPSettings, rest string) error {
+	content := strings.TrimRight(rest, "\n")
+	if !s.IsEmpty() {
+		if content != "" {
+			content += "\n"
+		}
+		content += s.Render()
+	} else if content != "" {
+		content += "\n"
+	}
+	return os.WriteFile(getGitConfigPath(), []byte(content), 0o644)
+}
+
+/*
+Sets http proxy for urls, local proxy in config is used if proxy is empty.
+*/
+func SetGitHTTPProxy(proxy string, urls ...string) {
+	if proxy == "" {
+		proxy = conf.NewGVConfig().GetLocalProxy()
+	}
+	if proxy == "" {
+		gprint.PrintError("No legal proxy is specified.")
+		return
+	}
+	if len(urls) == 0 {
+		urls = DefaultGitProxyURLs
+	}
+	s, rest := readGitConfig()
+	for _, u := range urls {
+		s.Proxies[u] = proxy
+	}
+	if err := writeGitConfig(s, rest); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	gprint.PrintSuccess("http.proxy set for: %s", strings.Join(urls, ", "))
+}
+
+// Unsets http proxy for urls, all managed proxies are removed if urls is empty.
+func UnsetGitHTTPProxy(urls ...string) {
+	s, rest := readGitConfig()
+	if len(urls) == 0 {
+		s.Proxies = map[string]string{}
+	}
+	for _, u := range urls {
+		delete(s.Proxies, u)
+	}
+	if err := writeGitConfig(s, rest); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	gprint.PrintSuccess("http.proxy unset.")
+}
+
+/*
+Rewrites urls to a mirror with url.<mirror>.insteadOf.
+The mirror works as a prefix like ReverseProxy in config, which is used if mirror is empty.
+*/
+func SetGitMirror(mirror string, urls ...string) {
+	if mirror == "" {
+		mirror = conf.NewGVConfig().GetReverseProxy()
+	}
+	if mirror == "" {
+		gprint.PrintError("No mirror is specified.")
+		return
+	}
+	if len(urls) == 0 {
+		urls = DefaultGitMirrorURLs
+	}
+	s, rest := readGitConfig()
+	for _, u := range urls {
+		s.Mirrors[u] = strings.TrimRight(mirror, "/") + "/" + u
+	}
+	if err := writeGitConfig(s, rest); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	gprint.PrintSuccess("Mirror set for: %s", strings.Join(urls, ", "))
+}
+
+// Removes rewrites for urls, all managed rewrites are removed if urls is empty.
+func UnsetGitMirror(urls ...string) {
+	s, rest := readGitConfig()
+	if len(urls) == 0 {
+		s.Mirrors = map[string]string{}
+	}
+	for _, u := range urls {
+		delete(s.Mirrors, u)
+	}
+	if err := writeGitConfig(s, rest); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	gprint.PrintSuccess("Mirror unset.")
+}
+
+// Removes the managed block from ~/.gitconfig.
+func RemoveGitConfigBlock() {
+	s, rest := readGitConfig()
+	if s.IsEmpty() {
+		gprint.PrintInfo("No managed block found in %s.", getGitConfigPath())
+		return
+	}
+	if err := writeGitConfig(NewGitHTTPSettings(), rest); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	gprint.PrintSuccess("Managed block removed.")
+}
+
+// Asks git for the effective value, empty if git is not installed or nothing matches.
+func getEffectiveGitProxy(u string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		return ""
+	}
+	buf, err := gutils.ExecuteSysCommand(true, "", "git", "config", "--get-urlmatch", "http.proxy", u)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// Expands url with insteadOf rules, no network access is needed.
+func getEffectiveGitURL(u string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		return ""
+	}
+	buf, err := gutils.ExecuteSysCommand(true, "", "git", "ls-remote", "--get-url", u)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+/*
+Shows managed proxies and mirrors, and the effective proxy reported by git.
+*/
+func ShowGitHTTPStatus() {
+	s, _ := readGitConfig()
+	urls := sortedDomains(s.Proxies)
+	for _, u := range DefaultGitProxyURLs {
+		if _, ok := s.Proxies[u]; !ok {
+			urls = append(urls, u)
+		}
+	}
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"} {
+		if v := os.Getenv(name); v != "" {
+			gprint.PrintInfo("%s=%s is used for urls without http.proxy.", name, v)
+			break
+		}
+	}
+
+	columns := []gtable.Column{
+		{Title: "Type", Width: 8},
+		{Title: "URL", Width: 30},
+		{Title: "Managed", Width: 45},
+		{Title: "Effective", Width: 45},
+	}
+	rows := []gtable.Row{}
+	for _, u := range urls {
+		rows = append(rows, gtable.Row{"proxy", u, s.Proxies[u], getEffectiveGitProxy(u)})
+	}
+	for _, u := range sortedDomains(s.Mirrors) {
+		rows = append(rows, gtable.Row{"mirror", u, s.Mirrors[u], getEffectiveGitURL(u)})
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(10),
+		gtable.WithWidth(130),
+	)
+	t.Run()
+}
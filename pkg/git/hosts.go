@@ -9,23 +9,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
 	"github.com/gvcgo/goutils/pkgs/gutils"
-	"github.com/gvcgo/goutils/pkgs/request"
 	"github.com/gvcgo/gvc/conf"
 )
 
 /*
 Modifies hosts file.
 */
-var remoteList = []string{
-	"https://raw.githubusercontent.com/JohyC/Hosts/main/MicrosoftHosts.txt",
-	"https://raw.githubusercontent.com/JohyC/Hosts/main/EpicHosts.txt",
-	"https://raw.githubusercontent.com/JohyC/Hosts/main/SteamDomains.txt",
-	"https://raw.githubusercontent.com/JohyC/Hosts/main/hosts.txt",
-	"https://raw.githubusercontent.com/ineo6/hosts/master/next-hosts",
-	"https://raw.githubusercontent.com/sengshinlee/hosts/main/hosts",
-}
-
 const (
 	HostFilePathForNix = "/etc/hosts"
 	HostFilePathForWin = `C:\Windows\System32\drivers\etc\hosts`
@@ -38,6 +30,8 @@ var StrWrapper string = `# FromGhosts Start
 
 var StrRegExp = regexp.MustCompile(`# FromGhosts Start[\w\W]*# FromGhosts End`)
 
+const HostsTimeFormat = "2006-01-02 15:04:05"
+
 var WinScript string = `COPY %s %s`
 
 func getHostsFilePath() string {
@@ -54,76 +48,211 @@ func getTempFilePath() string {
 }
 
 type HostsModifier struct {
-	items   map[string]string
-	fetcher *request.Fetcher
-	cfg     *conf.GVConfig
+	items     map[string][]string // domain -> candidate IPs
+	best      map[string]*ProbeResult
+	sources   []string
+	filter    *DomainFilter
+	hostsFile string
+	cfg       *conf.GVConfig
 }
 
 func NewModifier() *HostsModifier {
-	return &HostsModifier{
-		items:   make(map[string]string, 30),
-		fetcher: request.NewFetcher(),
-		cfg:     conf.NewGVConfig(),
+	h := &HostsModifier{
+		items:     make(map[string][]string, 30),
+		best:      make(map[string]*ProbeResult, 30),
+		hostsFile: getHostsFilePath(),
+		cfg:       conf.NewGVConfig(),
+	}
+	h.sources = h.cfg.HostsSources
+	if len(h.sources) == 0 {
+		h.sources = DefaultHostsSources
 	}
+	h.filter = &DomainFilter{
+		Include: h.cfg.HostsInclude,
+		Exclude: h.cfg.HostsExclude,
+	}
+	if len(h.filter.Include) == 0 {
+		h.filter.Include = DefaultHostsInclude
+	}
+	return h
+}
+
+// Uses another hosts file instead of the system one, no root privilege is needed.
+func (h *HostsModifier) SetHostsFile(fPath string) {
+	if fPath != "" {
+		h.hostsFile = fPath
+	}
+}
+
+func (h *HostsModifier) isSystemHostsFile() bool {
+	return h.hostsFile == getHostsFilePath()
+}
+
+// Overrides sources in config.
+func (h *HostsModifier) SetSources(sources ...string) {
+	if len(sources) > 0 {
+		h.sources = sources
+	}
+}
+
+// Overrides domain filters in config.
+func (h *HostsModifier) SetFilter(include, exclude []string) {
+	if len(include) > 0 {
+		h.filter.Include = include
+	}
+	if len(exclude) > 0 {
+		h.filter.Exclude = exclude
+	}
+}
+
+// Saves sources and filters to config.
+func (h *HostsModifier) SaveConfig() {
+	h.cfg.Load()
+	h.cfg.HostsSources = h.sources
+	h.cfg.HostsInclude = h.filter.Include
+	h.cfg.HostsExclude = h.filter.Exclude
+	h.cfg.Save()
 }
 
 func (h *HostsModifier) GetHostsFiles() {
-	for _, u := range remoteList {
-		rp := h.cfg.GetReverseProxy()
-		u = strings.TrimRight(rp, "/") + "/" + u
-		h.fetcher.SetUrl(u)
-		h.fetcher.Timeout = time.Second * 20
-		r, _ := h.fetcher.GetString()
+	reverseProxy := ""
+	for _, source := range h.sources {
+		if isRemoteSource(source) {
+			reverseProxy = h.cfg.GetReverseProxy()
+			break
+		}
+	}
+	fetcher := NewHostsFetcher(reverseProxy)
+	for _, source := range h.sources {
+		r, err := fetcher.Fetch(source)
+		if err != nil {
+			gprint.PrintWarning("%+v", err)
+			continue
+		}
 		h.Parse(r)
 	}
 }
 
 func (h *HostsModifier) Parse(resp string) {
-	lines := strings.Split(resp, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "#") {
-			continue
+	for _, entry := range ParseHosts(resp) {
+		if h.filter.Allow(entry.Domain) {
+			h.add(entry)
 		}
-		h.add(line)
 	}
 }
 
-func (h *HostsModifier) add(line string) {
-	sList := strings.Split(line, " ")
-	if len(sList) < 2 {
-		return
+func (h *HostsModifier) add(entry HostEntry) {
+	for _, old := range h.items[entry.Domain] {
+		if old == entry.IP {
+			return
+		}
 	}
-	key := sList[0]
-	for _, s := range sList[1:] {
-		s = strings.TrimSpace(s)
-		if s == "" {
+	h.items[entry.Domain] = append(h.items[entry.Domain], entry.IP)
+}
+
+// Keeps the fastest reachable IP for each domain.
+func (h *HostsModifier) ProbeAll() {
+	gprint.PrintInfo("Testing latency for %d domains...", len(h.items))
+	h.best = ProbeFastest(h.items, DefaultProbeTimeout, DefaultProbeWorkers)
+}
+
+// Parses entries in the managed block of hosts file.
+func parseManagedBlock(content string) (entries map[string]string) {
+	entries = map[string]string{}
+	block := StrRegExp.FindString(content)
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
 			continue
 		}
-		h.items[key] = s
-		break
+		for _, domain := range fields[1:] {
+			entries[domain] = fields[0]
+		}
 	}
+	return
 }
 
-func (h *HostsModifier) PrepareTempFile() (ok bool) {
-	if len(h.items) == 0 {
+// New content of hosts file with the fastest IPs in managed block.
+func (h *HostsModifier) newContent() (newStr string, ok bool) {
+	if len(h.best) == 0 {
 		return
 	}
 	lines := []string{}
-	for k, v := range h.items {
-		lines = append(lines, fmt.Sprintf("%s\t\t\t\t\t\t%s", k, v))
+	for _, domain := range sortedDomains(h.best) {
+		lines = append(lines, fmt.Sprintf("%s\t\t\t\t\t\t%s", h.best[domain].IP, domain))
+	}
+	content, _ := os.ReadFile(h.hostsFile)
+	block := fmt.Sprintf(StrWrapper, time.Now().Format(HostsTimeFormat), strings.Join(lines, "\n"))
+	if StrRegExp.Match(content) {
+		newStr = StrRegExp.ReplaceAllLiteralString(string(content), block)
+	} else {
+		newStr = strings.TrimRight(string(content), "\n") + "\n\n" + block + "\n"
+	}
+	return newStr, true
+}
+
+func (h *HostsModifier) PrepareTempFile() (ok bool) {
+	newStr, ok := h.newContent()
+	if !ok {
+		return
 	}
-	content, _ := os.ReadFile(getHostsFilePath())
-	newStr := StrRegExp.ReplaceAllString(
-		string(content),
-		fmt.Sprintf(StrWrapper, time.Now().Format("2006-01-02 15:04:05"), strings.Join(lines, "\n")),
-	)
 	err := os.WriteFile(getTempFilePath(), []byte(newStr), os.ModePerm)
 	if err != nil {
-		return
+		return false
 	}
 	return true
 }
 
+// Shows what has been changed in the managed block.
+func (h *HostsModifier) ShowReport(oldEntries map[string]string) {
+	columns := []gtable.Column{
+		{Title: "Domain", Width: 40},
+		{Title: "Old IP", Width: 20},
+		{Title: "New IP", Width: 20},
+		{Title: "Latency", Width: 15},
+		{Title: "Status", Width: 15},
+	}
+	rows := []gtable.Row{}
+	for _, domain := range sortedDomains(h.items) {
+		oldIP := oldEntries[domain]
+		r, ok := h.best[domain]
+		if !ok {
+			rows = append(rows, gtable.Row{domain, oldIP, "", "", gprint.RedStr("unreachable")})
+			continue
+		}
+		status := gprint.GreenStr("unchanged")
+		if oldIP == "" {
+			status = gprint.CyanStr("added")
+		} else if oldIP != r.IP {
+			status = gprint.YellowStr("changed")
+		}
+		rows = append(rows, gtable.Row{
+			domain,
+			oldIP,
+			r.IP,
+			fmt.Sprintf("%s(:%s)", formatLatency(r.Latency), r.Port),
+			status,
+		})
+	}
+	for _, domain := range sortedDomains(oldEntries) {
+		if _, ok := h.items[domain]; !ok {
+			rows = append(rows, gtable.Row{domain, oldEntries[domain], "", "", gprint.RedStr("removed")})
+		}
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(15),
+		gtable.WithWidth(120),
+	)
+	t.Run()
+}
+
 func (h *HostsModifier) copyAsSudo(src, dst string) {
 	if runtime.GOOS != gutils.Windows {
 		gutils.ExecuteSysCommand(false, "", "sudo", "cp", "-rf", src, dst)
@@ -138,20 +267,32 @@ func (h *HostsModifier) copyAsSudo(src, dst string) {
 	}
 }
 
-func (h *HostsModifier) BackupOldFile() {
-	hostFile := getHostsFilePath()
-	backupFile := filepath.Join(filepath.Dir(hostFile), "hosts.backup")
-	h.copyAsSudo(hostFile, backupFile)
+// Copies a file to hosts file, root privilege is only needed for the system one.
+func (h *HostsModifier) copyToHostsFile(src string) {
+	if h.isSystemHostsFile() {
+		h.copyAsSudo(src, h.hostsFile)
+		return
+	}
+	if err := gutils.CopyAFile(src, h.hostsFile); err != nil {
+		gprint.PrintError("%+v", err)
+	}
 }
 
 func (h *HostsModifier) CopyTempFile() {
 	h.BackupOldFile()
-	h.copyAsSudo(getTempFilePath(), getHostsFilePath())
+	h.copyToHostsFile(getTempFilePath())
 }
 
 func (h *HostsModifier) Run() {
 	h.GetHostsFiles()
+	h.ProbeAll()
+	content, _ := os.ReadFile(h.hostsFile)
+	oldEntries := parseManagedBlock(string(content))
 	if ok := h.PrepareTempFile(); ok {
+		// Shown before sudo prompts for password.
+		h.ShowReport(oldEntries)
 		h.CopyTempFile()
+	} else {
+		gprint.PrintError("No reachable hosts found.")
 	}
 }
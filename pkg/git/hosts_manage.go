@@ -0,0 +1,209 @@
+package git
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Backups, status, diff and removal of the managed block.
+*/
+const (
+	HostsBackupSuffix    string = ".hosts"
+	HostsBackupTimeFmt   string = "20060102-150405"
+	MaxHostsBackupAmount int    = 10
+)
+
+var updateTimeRegExp = regexp.MustCompile(`# UpdateTime: (.+)`)
+
+// Backups are stored separately for each hosts file.
+func (h *HostsModifier) getBackupDir() string {
+	absPath, _ := filepath.Abs(h.hostsFile)
+	d := filepath.Join(conf.GetGVCWorkDir(), "hosts_backup", fmt.Sprintf("%x", sha1.Sum([]byte(absPath)))[:8])
+	os.MkdirAll(d, os.ModePerm)
+	return d
+}
+
+// Lists backup names, the latest comes first.
+func (h *HostsModifier) ListBackups() (names []string) {
+	dList, _ := os.ReadDir(h.getBackupDir())
+	for _, d := range dList {
+		if !d.IsDir() && strings.HasSuffix(d.Name(), HostsBackupSuffix) {
+			names = append(names, strings.TrimSuffix(d.Name(), HostsBackupSuffix))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return
+}
+
+/*
+Backups hosts file with a timestamp.
+Only the latest MaxHostsBackupAmount backups are kept.
+*/
+func (h *HostsModifier) BackupOldFile() {
+	content, err := os.ReadFile(h.hostsFile)
+	if err != nil {
+		gprint.PrintWarning("backup skipped: %+v", err)
+		return
+	}
+	name := time.Now().Format(HostsBackupTimeFmt)
+	backupPath := filepath.Join(h.getBackupDir(), name+HostsBackupSuffix)
+	for i := 1; ; i++ {
+		if _, err = os.Stat(backupPath); err != nil {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", time.Now().Format(HostsBackupTimeFmt), i)
+		backupPath = filepath.Join(h.getBackupDir(), name+HostsBackupSuffix)
+	}
+	if err = os.WriteFile(backupPath, content, 0o644); err != nil {
+		gprint.PrintWarning("backup failed: %+v", err)
+		return
+	}
+	gprint.PrintInfo("backup: %s", name)
+	backups := h.ListBackups()
+	for i := MaxHostsBackupAmount; i < len(backups); i++ {
+		os.Remove(filepath.Join(h.getBackupDir(), backups[i]+HostsBackupSuffix))
+	}
+}
+
+func (h *HostsModifier) ShowBackups() {
+	backups := h.ListBackups()
+	if len(backups) == 0 {
+		gprint.PrintInfo("No backups found.")
+		return
+	}
+	for _, name := range backups {
+		fmt.Println(gprint.CyanStr(name))
+	}
+}
+
+// Restores hosts file from a backup, the latest one is used if name is empty.
+func (h *HostsModifier) Restore(name string) (err error) {
+	backups := h.ListBackups()
+	if len(backups) == 0 {
+		return fmt.Errorf("no backups found for %s", h.hostsFile)
+	}
+	if name == "" {
+		name = backups[0]
+	}
+	backupPath := filepath.Join(h.getBackupDir(), name+HostsBackupSuffix)
+	if _, err = os.Stat(backupPath); err != nil {
+		return fmt.Errorf("cannot find backup: %s", name)
+	}
+	h.BackupOldFile()
+	h.copyToHostsFile(backupPath)
+	gprint.PrintSuccess("restored from %s", name)
+	return
+}
+
+// Strips the managed block from hosts file.
+func (h *HostsModifier) RemoveBlock() (err error) {
+	content, err := os.ReadFile(h.hostsFile)
+	if err != nil {
+		return
+	}
+	if !StrRegExp.Match(content) {
+		gprint.PrintInfo("No managed block found in %s.", h.hostsFile)
+		return
+	}
+	newStr := StrRegExp.ReplaceAllLiteralString(string(content), "")
+	newStr = strings.TrimRight(newStr, "\n") + "\n"
+	if err = os.WriteFile(getTempFilePath(), []byte(newStr), os.ModePerm); err != nil {
+		return
+	}
+	h.CopyTempFile()
+	gprint.PrintSuccess("Managed block removed.")
+	return
+}
+
+// Shows age and entries of the managed block.
+func (h *HostsModifier) Status() (err error) {
+	content, err := os.ReadFile(h.hostsFile)
+	if err != nil {
+		return
+	}
+	block := StrRegExp.FindString(string(content))
+	if block == "" {
+		gprint.PrintInfo("No managed block found in %s.", h.hostsFile)
+		return
+	}
+	gprint.PrintInfo("hosts file: %s", h.hostsFile)
+	if sList := updateTimeRegExp.FindStringSubmatch(block); len(sList) == 2 {
+		updateTime := strings.TrimSpace(sList[1])
+		if t, err1 := time.ParseInLocation(HostsTimeFormat, updateTime, time.Local); err1 == nil {
+			gprint.PrintInfo("updated at: %s (%s ago)", updateTime, time.Since(t).Round(time.Second))
+		} else {
+			gprint.PrintInfo("updated at: %s", updateTime)
+		}
+	}
+	entries := parseManagedBlock(string(content))
+	gprint.PrintInfo("entries: %d", len(entries))
+
+	columns := []gtable.Column{
+		{Title: "Domain", Width: 60},
+		{Title: "IP", Width: 40},
+	}
+	rows := []gtable.Row{}
+	for _, domain := range sortedDomains(entries) {
+		rows = append(rows, gtable.Row{domain, entries[domain]})
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(15),
+		gtable.WithWidth(100),
+	)
+	t.Run()
+	return
+}
+
+/*
+Previews changes to the managed block without modifying hosts file.
+*/
+func (h *HostsModifier) Diff() {
+	h.GetHostsFiles()
+	h.ProbeAll()
+	content, _ := os.ReadFile(h.hostsFile)
+	oldEntries := parseManagedBlock(string(content))
+	newEntries := map[string]string{}
+	for domain, r := range h.best {
+		newEntries[domain] = r.IP
+	}
+
+	changed := 0
+	domains := sortedDomains(oldEntries)
+	for _, domain := range sortedDomains(newEntries) {
+		if _, ok := oldEntries[domain]; !ok {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	fmt.Printf("--- %s\n+++ %s\n", h.hostsFile, h.hostsFile)
+	for _, domain := range domains {
+		oldIP, newIP := oldEntries[domain], newEntries[domain]
+		if oldIP == newIP {
+			continue
+		}
+		changed++
+		if oldIP != "" {
+			fmt.Println(gprint.RedStr("-%s\t%s", oldIP, domain))
+		}
+		if newIP != "" {
+			fmt.Println(gprint.GreenStr("+%s\t%s", newIP, domain))
+		}
+	}
+	if changed == 0 {
+		gprint.PrintInfo("No changes.")
+	}
+}
@@ -0,0 +1,192 @@
+package git
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/request"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Sources of hosts entries.
+
+A source is either a remote URL or a local file path.
+Successful downloads are cached and used when a source is unreachable.
+*/
+var DefaultHostsSources = []string{
+	"https://raw.githubusercontent.com/JohyC/Hosts/main/hosts.txt",
+	"https://raw.githubusercontent.com/ineo6/hosts/master/next-hosts",
+	"https://raw.githubusercontent.com/sengshinlee/hosts/main/hosts",
+}
+
+type HostEntry struct {
+	IP     string
+	Domain string
+}
+
+/*
+Parses content in hosts file format.
+
+Tabs, inline comments and IPv6 addresses are supported.
+Loopback and unspecified addresses are ignored.
+*/
+func ParseHosts(content string) (entries []HostEntry) {
+	for _, line := range strings.Split(content, "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+			if !isValidDomain(domain) {
+				continue
+			}
+			entries = append(entries, HostEntry{IP: ip.String(), Domain: domain})
+		}
+	}
+	return
+}
+
+func isValidDomain(domain string) bool {
+	if domain == "" || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, c := range domain {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+/*
+Domain filters.
+
+Patterns like "*.github.com" or "github.com", "*.github.com" matches "github.com" too.
+An empty include list means all domains are included.
+*/
+type DomainFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Used when no include patterns are configured, hosts sources also list unrelated domains.
+var DefaultHostsInclude = []string{
+	"*.github.com",
+	"*.github.io",
+	"*.githubapp.com",
+	"*.githubassets.com",
+	"*.githubusercontent.com",
+	"github.global.ssl.fastly.net",
+}
+
+func matchDomain(patterns []string, domain string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if ok, _ := path.Match(p, domain); ok {
+			return true
+		}
+		if strings.HasPrefix(p, "*.") && p[2:] == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *DomainFilter) Allow(domain string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Include) > 0 && !matchDomain(f.Include, domain) {
+		return false
+	}
+	return !matchDomain(f.Exclude, domain)
+}
+
+func getHostsCacheDir() string {
+	d := filepath.Join(conf.GetGVCWorkDir(), "hosts_cache")
+	os.MkdirAll(d, os.ModePerm)
+	return d
+}
+
+func getCachePath(source string) string {
+	return filepath.Join(getHostsCacheDir(), fmt.Sprintf("%x.txt", sha1.Sum([]byte(source))))
+}
+
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+type HostsFetcher struct {
+	fetcher      *request.Fetcher
+	reverseProxy string
+}
+
+func NewHostsFetcher(reverseProxy string) *HostsFetcher {
+	return &HostsFetcher{
+		fetcher:      request.NewFetcher(),
+		reverseProxy: reverseProxy,
+	}
+}
+
+func (f *HostsFetcher) download(u string) (content string, err error) {
+	if f.reverseProxy != "" {
+		u = strings.TrimRight(f.reverseProxy, "/") + "/" + u
+	}
+	f.fetcher.SetUrl(u)
+	f.fetcher.Timeout = time.Second * 20
+	content, code := f.fetcher.GetString()
+	if code != http.StatusOK {
+		return "", fmt.Errorf("download %s failed, status code: %d", u, code)
+	}
+	return
+}
+
+/*
+Gets content of a source.
+Falls back to the cached content of last good download.
+*/
+func (f *HostsFetcher) Fetch(source string) (content string, err error) {
+	if !isRemoteSource(source) {
+		var b []byte
+		b, err = os.ReadFile(strings.TrimPrefix(source, "file://"))
+		return string(b), err
+	}
+
+	cachePath := getCachePath(source)
+	content, err = f.download(source)
+	if err == nil && len(ParseHosts(content)) > 0 {
+		os.WriteFile(cachePath, []byte(content), 0o644)
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("no hosts entries found in %s", source)
+	}
+	b, cErr := os.ReadFile(cachePath)
+	if cErr != nil {
+		return "", err
+	}
+	info, _ := os.Stat(cachePath)
+	gprint.PrintWarning("%s, using cache from %s.", err.Error(), info.ModTime().Format("2006-01-02 15:04:05"))
+	return string(b), nil
+}
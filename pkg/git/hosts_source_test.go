@@ -0,0 +1,71 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		domain   string
+		want     bool
+	}{
+		{[]string{"github.com"}, "github.com", true},
+		{[]string{"github.com"}, "api.github.com", false},
+		{[]string{"*.github.com"}, "api.github.com", true},
+		{[]string{"*.github.com"}, "github.com", true},
+		{[]string{"*.github.com"}, "a.b.github.com", true},
+		{[]string{"*.github.com"}, "notgithub.com", false},
+		{[]string{"*.github.com"}, "github.com.cn", false},
+		{[]string{" *.GitHub.com "}, "github.com", true},
+		{[]string{"", "gitee.com"}, "github.com", false},
+		{nil, "github.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchDomain(tt.patterns, tt.domain); got != tt.want {
+			t.Errorf("matchDomain(%q, %q) = %v, want %v", tt.patterns, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestDomainFilter(t *testing.T) {
+	f := &DomainFilter{Include: DefaultHostsInclude, Exclude: []string{"gist.github.com"}}
+	tests := map[string]bool{
+		"github.com":                   true,
+		"api.github.com":               true,
+		"raw.githubusercontent.com":    true,
+		"github.global.ssl.fastly.net": true,
+		"gist.github.com":              false,
+		"www.google.com":               false,
+		"fastly.net":                   false,
+	}
+	for domain, want := range tests {
+		if got := f.Allow(domain); got != want {
+			t.Errorf("Allow(%q) = %v, want %v", domain, got, want)
+		}
+	}
+
+	var nilFilter *DomainFilter
+	if !nilFilter.Allow("example.com") || !(&DomainFilter{}).Allow("example.com") {
+		t.Error("an empty filter should allow all domains")
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	content := "# comment\n" +
+		"140.82.112.3\tgithub.com  api.github.com # inline\n" +
+		"127.0.0.1 localhost.localdomain\n" +
+		"0.0.0.0 blocked.example.com\n" +
+		"2606:50c0:8000::154 RAW.githubusercontent.com.\n" +
+		"not-an-ip github.com\n" +
+		"185.199.108.133 invalid_domain! localhost\n"
+	want := []HostEntry{
+		{IP: "140.82.112.3", Domain: "github.com"},
+		{IP: "140.82.112.3", Domain: "api.github.com"},
+		{IP: "2606:50c0:8000::154", Domain: "raw.githubusercontent.com"},
+	}
+	if got := ParseHosts(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseHosts() = %v, want %v", got, want)
+	}
+}
@@ -1,163 +1,213 @@
 package git
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/gvc/conf"
+	"golang.org/x/net/proxy"
 )
 
 /*
-Use http proxy for ssh.
+Use http/socks5 proxy for ssh.
 */
 const (
 	bufsize = 4096
 )
 
-// Returns the command that executes the current program
-func GetParentCommand() string {
-	ppid := os.Getppid()
-	fileName := "/proc/" + strconv.Itoa(ppid) + "/cmdline"
-	dat, err := os.ReadFile(fileName)
-	if err != nil {
-		gprint.PrintError("Can't read file '%s'\n", fileName)
-		return ""
-	}
-	output := ""
-	for i, elem := range dat {
-		if elem == byte(0) {
-			output += " "
-		} else {
-			output += string(dat[i])
-		}
+// returns CONNECT request for proxy connection, Basic auth is used when userinfo is provided.
+func GetConnectURI(desthost, destport string, auth *url.Userinfo) string {
+	addr := net.JoinHostPort(desthost, destport)
+	lines := []string{
+		"CONNECT " + addr + " HTTP/1.0",
+		"Host: " + addr,
 	}
-	return output
-}
-
-// Parse COMMAND and returns in format 'ssh://'
-func GetRepositoryFromCommand(command string) (string, string) {
-	var (
-		destination     string
-		port            string = "22"
-		repository      string
-		gitShellCommand string
-		arg             []string = strings.Split(command, " ")
-	)
-	/// "usr/bin/ssh git@github.com git-upload-pack 'bitexploder/timmy.git'"
-	// "usr/bin/ssh -p 7999 git@globaldevtools.bbva.com git-receive-pack '/uqnwi/bitbucket_lifecycle.git'"
-
-	for i, s := range arg {
-		if strings.HasPrefix(s, "-p") && len(s) == 2 {
-			port = arg[i+1]
-		} else if strings.HasPrefix(s, "-p") && len(s) > 2 {
-			port = s[2:]
-		}
-		if strings.HasPrefix(s, "git@") {
-			destination = s
+	if auth != nil && auth.Username() != "" {
+		password, _ := auth.Password()
+		token := base64.StdEncoding.EncodeToString([]byte(auth.Username() + ":" + password))
+		lines = append(lines, "Proxy-Authorization: Basic "+token)
+	}
+	return strings.Join(lines, "\r\n") + "\r\n\r\n"
+}
+
+func getProxyPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	default:
+		return "1080"
+	}
+}
+
+/*
+Connection to dest host through a proxy.
+
+Keeps bytes buffered during handshake and supports half-close.
+*/
+type proxyConn struct {
+	net.Conn
+	reader io.Reader
+	raw    net.Conn // underlying connection for half-close.
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) CloseWrite() error {
+	if cw, ok := c.raw.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+/*
+Connects to dest host through a proxy.
+
+Supported schemes: http, https, socks5, socks5h.
+Credentials are taken from userinfo of the proxy url.
+The whole handshake must be finished within timeout.
+*/
+func DialProxy(proxyURL *url.URL, destHost, destPort string, timeout time.Duration) (conn net.Conn, err error) {
+	proxyAddr := net.JoinHostPort(proxyURL.Hostname(), getProxyPort(proxyURL))
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "socks5", "socks5h", "socks":
+		return dialSocks5(proxyAddr, proxyURL.User, destHost, destPort, timeout)
+	case "http", "https", "":
+		conn, err = net.DialTimeout("tcp", proxyAddr, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("no connection to proxy %s: %w", proxyAddr, err)
 		}
-		if strings.HasPrefix(s, "'") && strings.HasSuffix(s, ".git'") {
-			repository = s[1 : len(s)-1]
-		} else if strings.HasPrefix(s, "/") && strings.HasSuffix(s, ".git") {
-			repository = s
+		conn.SetDeadline(time.Now().Add(timeout))
+		if strings.ToLower(proxyURL.Scheme) == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+			if err = tlsConn.Handshake(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			conn = tlsConn
 		}
-		if strings.HasPrefix(s, "git-") {
-			gitShellCommand = s
+		var reader io.Reader
+		if reader, err = httpConnect(conn, proxyURL.User, destHost, destPort); err != nil {
+			conn.Close()
+			return nil, err
 		}
+		conn.SetDeadline(time.Time{})
+		return &proxyConn{Conn: conn, reader: reader, raw: conn}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
 	}
-	if !(strings.HasPrefix(repository, "/")) {
-		repository = "/" + repository
-	}
-	if len(destination) > 0 && len(port) > 0 && len(repository) > 0 {
-		return "ssh://" + destination + ":" + port + repository, gitShellCommand
-	}
-	return "", ""
-}
-
-// returns URI for proxy connection when there's no authentication
-func GetURINoAuth(desthost, destport string) string {
-	var (
-		parentComand    string
-		repository      string
-		gitShellCommand string
-	)
-	parentComand = GetParentCommand()
-	// log.Print("Parent command:", parentComand)
-	repository, gitShellCommand = GetRepositoryFromCommand(parentComand)
-	// log.Print("Repository:", repository)
-	// log.Print("Git Shell Command: ", gitShellCommand)
-	return "CONNECT " +
-		desthost + ":" + destport + " HTTP/1.0\nHost: " +
-		desthost + ":" + destport + "\nRepository: " +
-		repository + "\nGitShellCommand: " +
-		gitShellCommand + "\nUserAuth: NULL" + "\r\n\r\n"
-}
-
-// returns socket connection with proxyaddr (string with format `host:port`)
-func CreateNetSocket(host string, port string, timeout int) net.Conn {
-	proxyaddr := host + ":" + port
-	conn, err := net.DialTimeout("tcp", proxyaddr, time.Duration(timeout)*time.Second)
+}
+
+// Records the underlying connection for half-close.
+type recordDialer struct {
+	dialer *net.Dialer
+	conn   net.Conn
+}
+
+func (d *recordDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *recordDialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+	conn, err = d.dialer.DialContext(ctx, network, addr)
+	d.conn = conn
+	return
+}
+
+func dialSocks5(proxyAddr string, user *url.Userinfo, destHost, destPort string, timeout time.Duration) (net.Conn, error) {
+	var auth *proxy.Auth
+	if user != nil && user.Username() != "" {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+	forward := &recordDialer{dialer: &net.Dialer{Timeout: timeout}}
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, forward)
 	if err != nil {
-		gprint.PrintError("No connection to Proxy '%s:%s'\n", host, port)
-		os.Exit(1)
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", net.JoinHostPort(destHost, destPort))
+	if err != nil {
+		return nil, fmt.Errorf("socks5 proxy %s: %w", proxyAddr, err)
+	}
+	return &proxyConn{Conn: conn, reader: conn, raw: forward.conn}, nil
+}
+
+/*
+Sends CONNECT request and parses the response.
+Returns a reader containing data received after the response header.
+*/
+func httpConnect(conn net.Conn, user *url.Userinfo, destHost, destPort string) (reader io.Reader, err error) {
+	if _, err = conn.Write([]byte(GetConnectURI(destHost, destPort, user))); err != nil {
+		return
+	}
+	br := bufio.NewReaderSize(conn, bufsize)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("proxy closed connection during handshake")
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("proxy handshake timed out")
+		}
+		return nil, fmt.Errorf("malformed response from proxy: %w", err)
+	}
+	// body of a successful CONNECT response is the tunnel itself.
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return br, nil
 	}
-	return conn
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return nil, fmt.Errorf("proxy authentication required, please set username and password in local proxy url")
+	}
+	return nil, fmt.Errorf("proxy could not open connection: %s", resp.Status)
 }
 
 /*
-use http proxy for ssh.
+use http/socks5 proxy for ssh.
+
+timeout: for connecting and handshaking with proxy.
+idleTimeout: closes the connection when no data is transferred, disabled if zero.
 */
-func GrokscrewHttpSSH(destHost, destPort string, proxyTimeout ...int) {
+func GrokscrewHttpSSH(destHost, destPort string, timeout, idleTimeout time.Duration) {
 	cfg := conf.NewGVConfig()
 	proxyURI := cfg.GetLocalProxy()
 
-	authURI := GetURINoAuth(destHost, destPort)
-	var (
-		buffer = make([]byte, bufsize)
-		read   int
-		write  int
-		setup  int = 0
-	)
-	if u, err := url.Parse(proxyURI); err == nil {
-		proxyhost := u.Hostname()
-		proxyport := u.Port()
-		pTimeout := 5
-		if len(proxyTimeout) > 0 && proxyTimeout[0] > 0 {
-			pTimeout = proxyTimeout[0]
-		}
-		conn := CreateNetSocket(proxyhost, proxyport, pTimeout)
-		defer conn.Close()
-		for {
-			if setup == 0 {
-				write, _ = conn.Write([]byte(authURI))
-				if write <= 0 {
-					break
-				}
-				read, _ = conn.Read(buffer)
-				if read <= 0 {
-					break
-				}
-				statusStr := strings.Split(string(buffer[:]), " ")[1]
-				statusCode, _ := strconv.Atoi(statusStr)
-				if statusCode >= 200 && statusCode < 300 {
-					gprint.PrintInfo("Connection stablished. STATUS CODE: %d\n", statusCode)
-					setup = 1
-				} else if statusCode >= 407 {
-					gprint.PrintError("Proxy could not open connection. STATUS CODE: %d\n", statusCode)
-					os.Exit(1)
-				}
-			} else {
-				FeelTheMagic(conn)
-			}
-		}
-	} else {
-		gprint.PrintError("Invalid proxy URI: %s", proxyURI)
+	// stdout is used by ssh.
+	u, err := url.Parse(proxyURI)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid proxy URI: %s\n", proxyURI)
+		os.Exit(1)
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
 	}
+	conn, err := DialProxy(u, destHost, destPort, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	FeelTheMagic(conn, idleTimeout)
 }
 
 type Progress struct {
@@ -165,24 +215,71 @@ type Progress struct {
 }
 
 // this function redirects data between socket, stdin and stdout
-func FeelTheMagic(con net.Conn) {
-	c := make(chan Progress)
-
-	// Read from Reader and write to Writer until EOF
-	copy := func(r io.ReadCloser, w io.WriteCloser) {
-		defer func() {
-			r.Close()
-			w.Close()
+func FeelTheMagic(con net.Conn, idleTimeout time.Duration) {
+	received, sent := Relay(con, os.Stdin, os.Stdout, idleTimeout)
+	fmt.Fprintf(os.Stderr, "[%s]: connection closed, %d bytes received, %d bytes sent\n", con.RemoteAddr(), received.bytes, sent.bytes)
+}
+
+// Counts bytes and updates last active time for idle timeout.
+type activeWriter struct {
+	w      io.Writer
+	active *atomic.Int64
+	count  atomic.Uint64
+}
+
+func (a *activeWriter) Write(b []byte) (n int, err error) {
+	a.active.Store(time.Now().UnixNano())
+	n, err = a.w.Write(b)
+	a.count.Add(uint64(n))
+	return
+}
+
+/*
+Relays data between conn and local streams.
+
+When local input reaches EOF, the write side of conn is closed
+and data from remote is still received until remote closes.
+Returns when remote closes, or the connection is idle for idleTimeout.
+*/
+func Relay(con net.Conn, in io.Reader, out io.Writer, idleTimeout time.Duration) (received, sent Progress) {
+	active := &atomic.Int64{}
+	active.Store(time.Now().UnixNano())
+	done := make(chan struct{})
+	toRemote := &activeWriter{w: con, active: active}
+	toLocal := &activeWriter{w: out, active: active}
+
+	go func() {
+		io.Copy(toRemote, in)
+		if cw, ok := con.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+	}()
+
+	if idleTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(idleTimeout / 4)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if time.Since(time.Unix(0, active.Load())) > idleTimeout {
+						fmt.Fprintf(os.Stderr, "[%s]: idle timeout\n", con.RemoteAddr())
+						con.Close()
+						return
+					}
+				}
+			}
 		}()
-		n, _ := io.Copy(w, r)
-		c <- Progress{bytes: uint64(n)}
 	}
 
-	go copy(con, os.Stdout)
-	go copy(os.Stdin, con)
-
-	p := <-c
-	gprint.PrintInfo("[%s]: Connection has been closed by remote peer, %d bytes has been received\n", con.RemoteAddr(), p.bytes)
-	p = <-c
-	gprint.PrintInfo("[%s]: Local peer has been stopped, %d bytes has been sent\n", con.RemoteAddr(), p.bytes)
+	io.Copy(toLocal, con)
+	close(done)
+	if c, ok := out.(io.Closer); ok {
+		c.Close()
+	}
+	received.bytes = toLocal.count.Load()
+	sent.bytes = toRemote.count.Load()
+	return
 }
@@ -0,0 +1,289 @@
+package git
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Starts a fake proxy, handle is called for every accepted connection.
+func newFakeProxy(t *testing.T, handle func(c net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// Echoes everything back, then writes "bye" after the client half-closes.
+func echoUntilEOF(c net.Conn, r io.Reader) {
+	io.Copy(c, r)
+	c.Write([]byte("bye"))
+}
+
+func TestDialHTTPProxy(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	addr := newFakeProxy(t, func(c net.Conn) {
+		br := bufio.NewReader(c)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		headers <- req.Header
+		if req.Method != http.MethodConnect || req.Host != "github.com:22" {
+			c.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			return
+		}
+		// bytes sent along with the response must not be lost.
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-fake\r\n"))
+		echoUntilEOF(c, br)
+	})
+
+	u, _ := url.Parse("http://user:pass@" + addr)
+	conn, err := DialProxy(u, "github.com", "22", 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	h := <-headers
+	if got := h.Get("Proxy-Authorization"); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Proxy-Authorization = %q", got)
+	}
+	// nothing about the repo is sent to the proxy.
+	for name := range h {
+		if name != "Proxy-Authorization" {
+			t.Errorf("unexpected header %s: %s", name, h.Get(name))
+		}
+	}
+
+	conn.Write([]byte("ping"))
+	conn.(*proxyConn).CloseWrite()
+	b, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "SSH-2.0-fake\r\npingbye" {
+		t.Errorf("received %q", got)
+	}
+}
+
+func TestDialHTTPProxyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  func(c net.Conn)
+		timeout time.Duration
+		wantErr string
+	}{
+		{
+			name: "auth required",
+			handle: func(c net.Conn) {
+				http.ReadRequest(bufio.NewReader(c))
+				c.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic\r\nContent-Length: 0\r\n\r\n"))
+			},
+			wantErr: "proxy authentication required",
+		},
+		{
+			name: "refused",
+			handle: func(c net.Conn) {
+				http.ReadRequest(bufio.NewReader(c))
+				c.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n"))
+			},
+			wantErr: "502 Bad Gateway",
+		},
+		{
+			name: "malformed",
+			handle: func(c net.Conn) {
+				http.ReadRequest(bufio.NewReader(c))
+				c.Write([]byte("SSH-2.0-OpenSSH\r\n\r\n"))
+			},
+			wantErr: "malformed response from proxy",
+		},
+		{
+			name: "early close",
+			handle: func(c net.Conn) {
+				http.ReadRequest(bufio.NewReader(c))
+			},
+			wantErr: "proxy closed connection during handshake",
+		},
+		{
+			name: "timeout",
+			handle: func(c net.Conn) {
+				http.ReadRequest(bufio.NewReader(c))
+				time.Sleep(time.Second)
+			},
+			timeout: 200 * time.Millisecond,
+			wantErr: "proxy handshake timed out",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := newFakeProxy(t, tt.handle)
+			u, _ := url.Parse("http://" + addr)
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 2 * time.Second
+			}
+			conn, err := DialProxy(u, "github.com", "22", timeout)
+			if err == nil {
+				conn.Close()
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+/*
+A minimal socks5 server, username/password auth is required if user is not empty.
+The requested destination is sent to dest.
+*/
+func fakeSocks5(user, password string, dest chan<- string) func(c net.Conn) {
+	return func(c net.Conn) {
+		br := bufio.NewReader(c)
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(br, head); err != nil || head[0] != 5 {
+			return
+		}
+		methods := make([]byte, head[1])
+		io.ReadFull(br, methods)
+		if user == "" {
+			c.Write([]byte{5, 0})
+		} else {
+			c.Write([]byte{5, 2})
+			// RFC 1929: ver, ulen, uname, plen, passwd.
+			ver, _ := br.ReadByte()
+			ulen, _ := br.ReadByte()
+			uname := make([]byte, ulen)
+			io.ReadFull(br, uname)
+			plen, _ := br.ReadByte()
+			passwd := make([]byte, plen)
+			io.ReadFull(br, passwd)
+			if ver != 1 || string(uname) != user || string(passwd) != password {
+				c.Write([]byte{1, 1})
+				return
+			}
+			c.Write([]byte{1, 0})
+		}
+
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(br, req); err != nil || req[1] != 1 {
+			return
+		}
+		var host string
+		switch req[3] {
+		case 1:
+			ip := make([]byte, 4)
+			io.ReadFull(br, ip)
+			host = net.IP(ip).String()
+		case 3:
+			l, _ := br.ReadByte()
+			name := make([]byte, l)
+			io.ReadFull(br, name)
+			host = string(name)
+		default:
+			return
+		}
+		port := make([]byte, 2)
+		io.ReadFull(br, port)
+		dest <- net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+		c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		echoUntilEOF(c, br)
+	}
+}
+
+func TestDialSocks5Proxy(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		proxyURL string
+	}{
+		{name: "no auth", proxyURL: "socks5://%s"},
+		{name: "auth", user: "user", password: "pass", proxyURL: "socks5h://user:pass@%s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := make(chan string, 1)
+			addr := newFakeProxy(t, fakeSocks5(tt.user, tt.password, dest))
+			u, _ := url.Parse(strings.Replace(tt.proxyURL, "%s", addr, 1))
+			conn, err := DialProxy(u, "ssh.github.com", "443", 2*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if got := <-dest; got != "ssh.github.com:443" {
+				t.Errorf("destination = %s", got)
+			}
+
+			conn.Write([]byte("ping"))
+			conn.(*proxyConn).CloseWrite()
+			b, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b); got != "pingbye" {
+				t.Errorf("received %q", got)
+			}
+		})
+	}
+}
+
+func TestDialSocks5ProxyErrors(t *testing.T) {
+	dest := make(chan string, 1)
+	addr := newFakeProxy(t, fakeSocks5("user", "pass", dest))
+	for _, proxyURL := range []string{
+		"socks5://user:wrong@" + addr,
+		"socks5://" + addr,
+	} {
+		u, _ := url.Parse(proxyURL)
+		conn, err := DialProxy(u, "github.com", "22", 2*time.Second)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: expected an error", proxyURL)
+			continue
+		}
+		if !strings.Contains(err.Error(), "socks5 proxy") {
+			t.Errorf("%s: error = %q", proxyURL, err)
+		}
+	}
+
+	// nothing is listening.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	for _, scheme := range []string{"socks5", "http"} {
+		u, _ := url.Parse(scheme + "://" + closedAddr)
+		if _, err := DialProxy(u, "github.com", "22", time.Second); err == nil {
+			t.Errorf("%s: expected an error for unreachable proxy", scheme)
+		}
+	}
+
+	u, _ := url.Parse("ftp://" + addr)
+	if _, err := DialProxy(u, "github.com", "22", time.Second); err == nil || !strings.Contains(err.Error(), "unsupported proxy scheme") {
+		t.Errorf("error = %v, want unsupported proxy scheme", err)
+	}
+}
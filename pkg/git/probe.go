@@ -0,0 +1,152 @@
+package git
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Latency test for candidate IPs of a domain.
+*/
+var ProbePorts = []string{"443", "22"}
+
+const (
+	DefaultProbeTimeout = 3 * time.Second
+	DefaultProbeWorkers = 32
+)
+
+type ProbeResult struct {
+	Domain  string
+	IP      string
+	Port    string
+	Latency time.Duration
+	Err     error
+}
+
+/*
+Port 443: TLS handshake with SNI, the certificate must be valid for the domain.
+Other ports: TCP connect only.
+*/
+func probe(domain, ip, port string, timeout time.Duration) (latency time.Duration, err error) {
+	addr := net.JoinHostPort(ip, port)
+	dialer := &net.Dialer{Timeout: timeout}
+	start := time.Now()
+	if port != "443" {
+		var conn net.Conn
+		conn, err = dialer.Dial("tcp", addr)
+		if err != nil {
+			return
+		}
+		latency = time.Since(start)
+		conn.Close()
+		return
+	}
+	var conn *tls.Conn
+	conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: domain})
+	if err != nil {
+		return
+	}
+	latency = time.Since(start)
+	conn.Close()
+	return
+}
+
+// Tries ports in order and returns the first reachable one.
+func ProbeIP(domain, ip string, timeout time.Duration) (r *ProbeResult) {
+	r = &ProbeResult{Domain: domain, IP: ip}
+	for _, port := range ProbePorts {
+		r.Port = port
+		r.Latency, r.Err = probe(domain, ip, port, timeout)
+		if r.Err == nil {
+			return
+		}
+	}
+	return
+}
+
+/*
+Probes all candidate IPs concurrently.
+Returns the fastest reachable result for each domain.
+*/
+func ProbeFastest(candidates map[string][]string, timeout time.Duration, workers int) (best map[string]*ProbeResult) {
+	if workers <= 0 {
+		workers = DefaultProbeWorkers
+	}
+	type job struct {
+		domain string
+		ip     string
+	}
+	jobs := make(chan job)
+	results := make(chan *ProbeResult)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- ProbeIP(j.domain, j.ip, timeout)
+			}
+		}()
+	}
+	go func() {
+		for domain, ipList := range candidates {
+			for _, ip := range ipList {
+				jobs <- job{domain: domain, ip: ip}
+			}
+		}
+		close(jobs)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	best = map[string]*ProbeResult{}
+	for r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if old, ok := best[r.Domain]; !ok || r.betterThan(old) {
+			best[r.Domain] = r
+		}
+	}
+	return
+}
+
+func portRank(port string) int {
+	for i, p := range ProbePorts {
+		if p == port {
+			return i
+		}
+	}
+	return len(ProbePorts)
+}
+
+/*
+Latencies are only comparable on the same port,
+a TLS handshake on 443 takes longer than a bare TCP connect on 22.
+So results reachable on an earlier port in ProbePorts always win.
+*/
+func (r *ProbeResult) betterThan(other *ProbeResult) bool {
+	if rr, or := portRank(r.Port), portRank(other.Port); rr != or {
+		return rr < or
+	}
+	return r.Latency < other.Latency
+}
+
+func sortedDomains[T any](m map[string]T) (r []string) {
+	for d := range m {
+		r = append(r, d)
+	}
+	sort.Strings(r)
+	return
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
@@ -5,41 +5,154 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
 	"github.com/gvcgo/goutils/pkgs/gutils"
 	"github.com/gvcgo/gvc/conf"
 )
 
-var (
-	GitSSHProxyCommandWin  string = `ProxyCommand connect -S %s %s %s`
-	GitSSHProxyCommandNix  string = `ProxyCommand nc -v -x %s %s %s`
-	GitSSHProxyCommandHttp string = `ProxyCommand g g cs -a %s -p %s`
-)
+// http and socks5 proxies are both handled by "g g cs", no extra tools are needed.
+var GitSSHProxyCommand string = `ProxyCommand g g cs -a %s -p %s`
+
+// ProxyCommands written by older versions of gvc, sections using them are migrated.
+var legacyProxyCommands = []string{
+	"g g cs ",
+	"nc -v -x ",
+	"connect -S ",
+}
+
+func getDotSSHPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".ssh")
+}
 
-var GitSSHConfigStr string = `Host github.com
-  User git
-  Port 22
-  Hostname github.com
-  IdentityFile "%s"
-  TCPKeepAlive yes
-  %s
-
-Host ssh.github.com
-  User git
-  Port 443
-  Hostname ssh.github.com
-  IdentityFile "%s"
-  TCPKeepAlive yes
-  %s
-`
+func getSSHConfPath() string {
+	return filepath.Join(getDotSSHPath(), "config")
+}
 
 /*
-Adds proxy to hosts file.
+Reads ~/.ssh/config.
+Older versions of gvc disabled the proxy by renaming config to config.bak, restore it first.
 */
-func SetProxyForSSH() {
+func readSSHConfig() string {
+	confPath := getSSHConfPath()
+	backupConfPath := confPath + ".bak"
+	ok1, _ := gutils.PathIsExist(confPath)
+	ok2, _ := gutils.PathIsExist(backupConfPath)
+	if !ok1 && ok2 {
+		if err := os.Rename(backupConfPath, confPath); err == nil {
+			gprint.PrintInfo("Restored %s from config.bak.", confPath)
+		}
+	}
+	content, _ := os.ReadFile(confPath)
+	return string(content)
+}
+
+func writeSSHConfig(content string) error {
+	os.MkdirAll(getDotSSHPath(), 0o700)
+	return os.WriteFile(getSSHConfPath(), []byte(content), 0o600)
+}
+
+func isLegacySection(chunk string) bool {
+	sections := ParseSSHConfig(chunk)
+	if len(sections) < 2 {
+		return false
+	}
+	s := sections[1]
+	if !s.Matches("github.com") && !s.Matches("ssh.github.com") {
+		return false
+	}
+	pxyCmd, _ := s.Get("ProxyCommand")
+	for _, c := range legacyProxyCommands {
+		if strings.HasPrefix(pxyCmd, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes sections written by older versions of gvc outside of the managed block.
+func removeLegacySections(content string) (string, int) {
+	removed := 0
+	kept := []string{}
+	for _, chunk := range splitSSHChunks(content) {
+		if isLegacySection(chunk) {
+			removed++
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	return strings.Join(kept, "\n"), removed
+}
+
+// Warns about unmanaged sections that also set a ProxyCommand for managed hosts.
+func warnConflicts(rest string, hosts []*SSHHost) {
+	for _, s := range ParseSSHConfig(rest) {
+		if _, ok := s.Get("ProxyCommand"); !ok {
+			continue
+		}
+		for _, h := range hosts {
+			if s.Matches(h.Host) {
+				gprint.PrintWarning("Unmanaged section 'Host %s' also sets ProxyCommand for %s, the managed one takes precedence.",
+					strings.Join(s.Patterns, " "), h.Host)
+			}
+		}
+	}
+}
+
+// Hosts from args, config or defaults in order.
+func getSSHProxyHosts(cfg *conf.GVConfig, specs ...string) (hosts []*SSHHost, err error) {
+	if len(specs) == 0 {
+		specs = cfg.SSHProxyHosts
+	}
+	if len(specs) == 0 {
+		specs = DefaultSSHProxyHosts
+	}
+	for _, spec := range specs {
+		h, err := ParseSSHHost(spec)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return
+}
+
+/*
+Chooses identity for each host.
+Identities specified by args come first, then those saved in config, otherwise the user chooses one from detected keys.
+*/
+func setSSHIdentities(cfg *conf.GVConfig, hosts []*SSHHost, identities map[string]string) {
+	if cfg.SSHIdentities == nil {
+		cfg.SSHIdentities = map[string]string{}
+	}
+	for _, h := range hosts {
+		if identity, ok := identities[h.Host]; ok {
+			h.IdentityFile = identity
+		} else if identity, ok := cfg.SSHIdentities[h.Host]; ok {
+			if identity != "" {
+				if _, err := os.Stat(identity); err != nil {
+					gprint.PrintWarning("Identity for %s not found: %s", h.Host, identity)
+					identity = ChooseSSHKey(h.Host)
+				}
+			}
+			h.IdentityFile = identity
+		} else {
+			h.IdentityFile = ChooseSSHKey(h.Host)
+		}
+		cfg.SSHIdentities[h.Host] = h.IdentityFile
+	}
+	cfg.Save()
+}
+
+/*
+Adds proxy for ssh in a managed block of ~/.ssh/config.
+Hosts are like "gitlab.com" or "ssh.github.com:443", hosts in config are used if none is specified.
+Identities map host to private key path, an empty path means ssh-agent or default identities.
+*/
+func SetProxyForSSH(identities map[string]string, hostSpecs ...string) {
 	cfg := conf.NewGVConfig()
 	pURI := cfg.GetLocalProxy()
 	if pURI == "" {
@@ -50,100 +163,108 @@ func SetProxyForSSH() {
 	if err != nil {
 		return
 	}
-	homeDir, _ := os.UserHomeDir()
-	dotSSHPath := filepath.Join(homeDir, ".ssh")
-	idRSAPath := filepath.Join(dotSSHPath, "id_rsa")
-	if ok, _ := gutils.PathIsExist(idRSAPath); !ok {
-		gprint.PrintError("Cannot find ~/.ssh/id_rsa.")
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5", "socks5h", "socks":
+	default:
+		gprint.PrintError("Unsupported proxy scheme: %s", u.Scheme)
 		return
 	}
-	uStr := fmt.Sprintf("%s:%s", u.Hostname(), u.Port())
-	pxyCmd := ""
-
-	switch runtime.GOOS {
-	case gutils.Windows:
-		if strings.Contains(u.Scheme, "sock") {
-			pxyCmd = fmt.Sprintf(
-				GitSSHProxyCommandWin,
-				uStr,
-				`%h`,
-				`%p`,
-			)
-		} else {
-			pxyCmd = fmt.Sprintf(
-				GitSSHProxyCommandHttp,
-				`%h`,
-				`%p`,
-			)
-		}
-	case gutils.Linux, gutils.Darwin:
-		if strings.Contains(u.Scheme, "sock") {
-			pxyCmd = fmt.Sprintf(
-				GitSSHProxyCommandNix,
-				uStr,
-				`%h`,
-				`%p`,
-			)
-		} else {
-			pxyCmd = fmt.Sprintf(
-				GitSSHProxyCommandHttp,
-				`%h`,
-				`%p`,
-			)
-		}
-	default:
-		gprint.PrintError("Unsupported OS.")
+	hosts, err := getSSHProxyHosts(cfg, hostSpecs...)
+	if err != nil {
+		gprint.PrintError("%+v", err)
 		return
 	}
+	if len(hostSpecs) > 0 {
+		cfg.SSHProxyHosts = []string{}
+		for _, h := range hosts {
+			cfg.SSHProxyHosts = append(cfg.SSHProxyHosts, h.String())
+		}
+	}
+	setSSHIdentities(cfg, hosts, identities)
 
-	content := fmt.Sprintf(
-		GitSSHConfigStr,
-		idRSAPath,
-		pxyCmd,
-		idRSAPath,
-		pxyCmd,
-	)
-	setProxyForSSH(dotSSHPath, content)
-}
+	_, rest, _ := SplitSSHBlock(readSSHConfig())
+	rest, removed := removeLegacySections(rest)
+	if removed > 0 {
+		gprint.PrintInfo("Migrated %d section(s) written by older versions.", removed)
+	}
+	warnConflicts(rest, hosts)
 
-func setProxyForSSH(dotSSHPath, content string) {
-	confPath := filepath.Join(dotSSHPath, "config")
-	if ok, _ := gutils.PathIsExist(confPath); !ok {
-		os.WriteFile(confPath, []byte(content), 0o666)
-	} else {
-		oldContentByte, _ := os.ReadFile(confPath)
-		oldContent := string(oldContentByte)
-		if !strings.Contains(oldContent, "ProxyCommand") && len(oldContent) > 0 {
-			os.WriteFile(confPath, []byte(oldContent+"\n"+content), os.ModePerm)
-		} else {
-			os.WriteFile(confPath, []byte(content), 0o666)
-		}
+	pxyCmd := fmt.Sprintf(GitSSHProxyCommand, `%h`, `%p`)
+	block := RenderSSHBlock(hosts, pxyCmd, true)
+	if err := writeSSHConfig(JoinSSHBlock(block, rest)); err != nil {
+		gprint.PrintError("%+v", err)
+		return
 	}
+	gprint.PrintSuccess("Proxy enabled for %d host(s).", len(hosts))
 }
 
+// Enables or disables the managed block only, other entries are untouched.
 func ToggleProxyForSSH() {
-	homeDir, _ := os.UserHomeDir()
-	confPath := filepath.Join(homeDir, ".ssh", "config")
-	backupConfPath := filepath.Join(homeDir, ".ssh", "config.bak")
+	block, rest, enabled := SplitSSHBlock(readSSHConfig())
+	if block == "" {
+		gprint.PrintWarning("Set a proxy for ssh...")
+		SetProxyForSSH(nil)
+		return
+	}
+	if err := writeSSHConfig(JoinSSHBlock(ToggleSSHBlock(block, !enabled), rest)); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	if enabled {
+		gprint.PrintInfo("Proxy disabled.")
+	} else {
+		gprint.PrintSuccess("Proxy enabled.")
+	}
+}
 
-	ok1, _ := gutils.PathIsExist(confPath)
-	ok2, _ := gutils.PathIsExist(backupConfPath)
+// Removes the managed block from ~/.ssh/config.
+func RemoveProxyForSSH() {
+	block, rest, _ := SplitSSHBlock(readSSHConfig())
+	if block == "" {
+		gprint.PrintInfo("No managed block found in %s.", getSSHConfPath())
+		return
+	}
+	if err := writeSSHConfig(JoinSSHBlock("", rest)); err != nil {
+		gprint.PrintError("%+v", err)
+		return
+	}
+	gprint.PrintSuccess("Managed block removed.")
+}
 
-	if !ok1 && !ok2 {
-		gprint.PrintWarning("Set a proxy for ssh...")
-		SetProxyForSSH()
-	} else if ok1 && !ok2 {
-		if err := os.Rename(confPath, backupConfPath); err == nil {
-			gprint.PrintInfo("Proxy disabled.")
-		}
-	} else if !ok1 && ok2 {
-		if err := os.Rename(backupConfPath, confPath); err == nil {
-			gprint.PrintSuccess("Proxy enabled.")
-		}
+// Shows hosts in the managed block.
+func ShowSSHProxyStatus() {
+	block, _, enabled := SplitSSHBlock(readSSHConfig())
+	if block == "" {
+		gprint.PrintInfo("No managed block found in %s.", getSSHConfPath())
+		return
+	}
+	if enabled {
+		gprint.PrintSuccess("Proxy enabled.")
 	} else {
-		os.RemoveAll(backupConfPath)
-		if err := os.Rename(confPath, backupConfPath); err == nil {
-			gprint.PrintInfo("Proxy disabled.")
+		gprint.PrintWarning("Proxy disabled.")
+	}
+	columns := []gtable.Column{
+		{Title: "Host", Width: 30},
+		{Title: "Port", Width: 8},
+		{Title: "User", Width: 10},
+		{Title: "IdentityFile", Width: 40},
+	}
+	rows := []gtable.Row{}
+	for _, s := range ParseSSHConfig(ToggleSSHBlock(block, true)) {
+		if s.Keyword == "" {
+			continue
 		}
+		port, _ := s.Get("Port")
+		user, _ := s.Get("User")
+		identity, _ := s.Get("IdentityFile")
+		rows = append(rows, gtable.Row{strings.Join(s.Patterns, " "), port, user, identity})
 	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(10),
+		gtable.WithWidth(100),
+	)
+	t.Run()
 }
@@ -0,0 +1,302 @@
+package git
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+/*
+Parses ~/.ssh/config and manages the block written by gvc.
+*/
+const (
+	SSHBlockStart    string = "# FromGVC SSH Start"
+	SSHBlockEnd      string = "# FromGVC SSH End"
+	sshStatusPrefix  string = "# Status: "
+	sshStatusEnabled string = "enabled"
+	sshStatusOff     string = "disabled"
+	sshDisabledMark  string = "#~ "
+)
+
+var SSHBlockRegExp = regexp.MustCompile(`(?s)` + regexp.QuoteMeta(SSHBlockStart) + `.*?` + regexp.QuoteMeta(SSHBlockEnd) + `\n?`)
+
+var DefaultSSHProxyHosts = []string{
+	"github.com:22",
+	"ssh.github.com:443",
+}
+
+type SSHOption struct {
+	Key  string
+	Args []string
+}
+
+func (o SSHOption) Value() string {
+	return strings.Join(o.Args, " ")
+}
+
+// A Host or Match section in ssh config.
+type SSHSection struct {
+	Keyword  string // Host or Match, empty for global options.
+	Patterns []string
+	Options  []SSHOption
+}
+
+func (s *SSHSection) Get(key string) (string, bool) {
+	for _, o := range s.Options {
+		if strings.EqualFold(o.Key, key) {
+			return o.Value(), true
+		}
+	}
+	return "", false
+}
+
+// Whether the section applies to a host alias.
+func (s *SSHSection) Matches(host string) bool {
+	if !strings.EqualFold(s.Keyword, "host") {
+		return false
+	}
+	matched := false
+	for _, p := range s.Patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(host)); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Splits a config line into keyword and arguments, "Key=Value" and quoted args are supported.
+func splitSSHLine(line string) (key string, args []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	idx := strings.IndexAny(line, " \t=")
+	if idx < 0 {
+		return line, nil
+	}
+	key = line[:idx]
+	rest := strings.TrimLeft(line[idx:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var (
+		cur    strings.Builder
+		quoted bool
+		hasArg bool
+	)
+	for _, c := range rest {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			hasArg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if hasArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				hasArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, cur.String())
+	}
+	return
+}
+
+// Splits raw content into chunks, each of which starts with a Host/Match line except the first one.
+func splitSSHChunks(content string) (chunks []string) {
+	current := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		key, _ := splitSSHLine(line)
+		if strings.EqualFold(key, "host") || strings.EqualFold(key, "match") {
+			chunks = append(chunks, strings.Join(current, "\n"))
+			current = []string{}
+		}
+		current = append(current, line)
+	}
+	chunks = append(chunks, strings.Join(current, "\n"))
+	return
+}
+
+/*
+Parses ssh config content into sections.
+The first section holds global options before any Host/Match.
+*/
+func ParseSSHConfig(content string) (sections []*SSHSection) {
+	current := &SSHSection{}
+	sections = append(sections, current)
+	for _, line := range strings.Split(content, "\n") {
+		key, args := splitSSHLine(line)
+		if key == "" {
+			continue
+		}
+		if strings.EqualFold(key, "host") || strings.EqualFold(key, "match") {
+			current = &SSHSection{Keyword: key, Patterns: args}
+			sections = append(sections, current)
+			continue
+		}
+		current.Options = append(current.Options, SSHOption{Key: key, Args: args})
+	}
+	return
+}
+
+// A host managed by gvc.
+type SSHHost struct {
+	Host         string
+	Port         string
+	User         string
+	IdentityFile string
+}
+
+// Parses host spec like "github.com" or "ssh.github.com:443".
+func ParseSSHHost(spec string) (h *SSHHost, err error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty host")
+	}
+	h = &SSHHost{Host: spec, Port: "22", User: "git"}
+	if host, port, err1 := net.SplitHostPort(spec); err1 == nil {
+		h.Host, h.Port = host, port
+	}
+	if strings.ContainsAny(h.Host, " \t*?!") {
+		return nil, fmt.Errorf("invalid host: %s", spec)
+	}
+	return
+}
+
+func (h *SSHHost) String() string {
+	return net.JoinHostPort(h.Host, h.Port)
+}
+
+func (h *SSHHost) Section(proxyCommand string) string {
+	lines := []string{
+		"Host " + h.Host,
+		"  HostName " + h.Host,
+		"  User " + h.User,
+		"  Port " + h.Port,
+	}
+	if h.IdentityFile != "" {
+		lines = append(lines, fmt.Sprintf(`  IdentityFile "%s"`, h.IdentityFile))
+		lines = append(lines, "  IdentitiesOnly yes")
+	}
+	lines = append(lines, "  TCPKeepAlive yes")
+	if proxyCommand != "" {
+		lines = append(lines, "  "+proxyCommand)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Renders the managed block.
+func RenderSSHBlock(hosts []*SSHHost, proxyCommand string, enabled bool) string {
+	status := sshStatusEnabled
+	if !enabled {
+		status = sshStatusOff
+	}
+	body := []string{}
+	for _, h := range hosts {
+		for _, line := range strings.Split(h.Section(proxyCommand), "\n") {
+			if !enabled {
+				line = sshDisabledMark + line
+			}
+			body = append(body, line)
+		}
+		body = append(body, "")
+	}
+	return fmt.Sprintf("%s\n%s%s\n%s%s\n",
+		SSHBlockStart,
+		sshStatusPrefix, status,
+		strings.Join(body, "\n"),
+		SSHBlockEnd,
+	)
+}
+
+// Returns the managed block, the content outside of it, and whether it is enabled.
+func SplitSSHBlock(content string) (block, rest string, enabled bool) {
+	block = SSHBlockRegExp.FindString(content)
+	rest = SSHBlockRegExp.ReplaceAllLiteralString(content, "")
+	enabled = strings.Contains(block, sshStatusPrefix+sshStatusEnabled)
+	return
+}
+
+// Enables or disables the managed block by commenting out its content.
+func ToggleSSHBlock(block string, enable bool) string {
+	lines := strings.Split(strings.TrimRight(block, "\n"), "\n")
+	result := []string{}
+	for _, line := range lines {
+		switch {
+		case line == SSHBlockStart || line == SSHBlockEnd:
+		case strings.HasPrefix(line, sshStatusPrefix):
+			if enable {
+				line = sshStatusPrefix + sshStatusEnabled
+			} else {
+				line = sshStatusPrefix + sshStatusOff
+			}
+		case enable:
+			line = strings.TrimPrefix(line, sshDisabledMark)
+		case line != "" && !strings.HasPrefix(line, sshDisabledMark):
+			line = sshDisabledMark + line
+		}
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n") + "\n"
+}
+
+func isSSHSectionLine(line string) bool {
+	fields := strings.FieldsFunc(strings.TrimSpace(line), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '='
+	})
+	if len(fields) == 0 {
+		return false
+	}
+	keyword := strings.ToLower(fields[0])
+	return keyword == "host" || keyword == "match"
+}
+
+/*
+Places the block just before the first Host or Match section.
+
+ssh uses the first obtained value of each option, so the block must
+come before other sections. But options and Include lines before the
+first section are global, they would be scoped to the last Host of the
+block if it were placed at the very top. Comments right above the first
+section are kept with it.
+*/
+func JoinSSHBlock(block, rest string) string {
+	rest = strings.TrimLeft(rest, "\n")
+	if block == "" {
+		return rest
+	}
+	if rest == "" {
+		return block
+	}
+	lines := strings.Split(rest, "\n")
+	idx := len(lines)
+	for i, line := range lines {
+		if isSSHSectionLine(line) {
+			idx = i
+			break
+		}
+	}
+	for idx > 0 && strings.HasPrefix(strings.TrimSpace(lines[idx-1]), "#") {
+		idx--
+	}
+	preamble := strings.TrimRight(strings.Join(lines[:idx], "\n"), "\n")
+	sections := strings.Join(lines[idx:], "\n")
+	switch {
+	case preamble == "":
+		return block + "\n" + sections
+	case sections == "":
+		return preamble + "\n\n" + block
+	default:
+		return preamble + "\n\n" + block + "\n" + sections
+	}
+}
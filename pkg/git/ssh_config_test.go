@@ -0,0 +1,65 @@
+package git
+
+import "testing"
+
+func TestJoinSSHBlock(t *testing.T) {
+	block := SSHBlockStart + "\nHost github.com\n  Port 22\n" + SSHBlockEnd + "\n"
+	tests := []struct {
+		name string
+		rest string
+		want string
+	}{
+		{
+			name: "empty",
+			rest: "",
+			want: block,
+		},
+		{
+			name: "sections only",
+			rest: "\nHost example.com\n  User git\n",
+			want: block + "\nHost example.com\n  User git\n",
+		},
+		{
+			name: "global preamble",
+			rest: "Include ~/.ssh/config.d/*\nServerAliveInterval 60\n\nHost example.com\n  User git\n",
+			want: "Include ~/.ssh/config.d/*\nServerAliveInterval 60\n\n" + block + "\nHost example.com\n  User git\n",
+		},
+		{
+			name: "comment kept with section",
+			rest: "ServerAliveInterval 60\n# work\nMatch host *.corp\n  User me\n",
+			want: "ServerAliveInterval 60\n\n" + block + "\n# work\nMatch host *.corp\n  User me\n",
+		},
+		{
+			name: "keyword case and equals sign",
+			rest: "Compression yes\nHOST=example.com\n  User git\n",
+			want: "Compression yes\n\n" + block + "\nHOST=example.com\n  User git\n",
+		},
+		{
+			name: "options only",
+			rest: "Include config.d/*\n",
+			want: "Include config.d/*\n\n" + block,
+		},
+		{
+			name: "hostname is not a section",
+			rest: "HostName example.com\nHost a\n",
+			want: "HostName example.com\n\n" + block + "\nHost a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := JoinSSHBlock(block, tt.rest)
+			if got != tt.want {
+				t.Errorf("JoinSSHBlock() =\n%q\nwant\n%q", got, tt.want)
+			}
+			// splitting and joining again must be stable.
+			b, rest, _ := SplitSSHBlock(got)
+			if again := JoinSSHBlock(b, rest); again != got {
+				t.Errorf("not stable after split:\n%q\nwant\n%q", again, got)
+			}
+		})
+	}
+
+	if got := JoinSSHBlock("", "\n\nHost a\n"); got != "Host a\n" {
+		t.Errorf("JoinSSHBlock() without block = %q", got)
+	}
+}
@@ -0,0 +1,282 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/gvcgo/goutils/pkgs/gtea/selector"
+	"github.com/gvcgo/gvc/conf"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+/*
+Detects, generates and registers ssh keys.
+*/
+const (
+	SSHKeyPlatformGithub string = "github"
+	SSHKeyPlatformGitee  string = "gitee"
+)
+
+var (
+	githubKeysAPI string = "https://api.github.com/user/keys"
+	giteeKeysAPI  string = "https://gitee.com/api/v5/user/keys"
+)
+
+// Default key names in the order of preference.
+var PreferredSSHKeyNames = []string{
+	"id_ed25519",
+	"id_ed25519_sk",
+	"id_ecdsa",
+	"id_ecdsa_sk",
+	"id_rsa",
+}
+
+type SSHKey struct {
+	Path    string // private key or the handle of a hardware-backed key.
+	Type    string
+	Comment string
+}
+
+func (k *SSHKey) String() string {
+	return fmt.Sprintf("%s (%s %s)", k.Path, k.Type, k.Comment)
+}
+
+func keyRank(name string) int {
+	for i, n := range PreferredSSHKeyNames {
+		if n == name {
+			return i
+		}
+	}
+	return len(PreferredSSHKeyNames)
+}
+
+/*
+Finds key pairs in ~/.ssh, a key is recognized by its ".pub" file.
+*/
+func FindSSHKeys() (keys []*SSHKey) {
+	dotSSHPath := getDotSSHPath()
+	dList, _ := os.ReadDir(dotSSHPath)
+	for _, d := range dList {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".pub") {
+			continue
+		}
+		privPath := filepath.Join(dotSSHPath, strings.TrimSuffix(d.Name(), ".pub"))
+		if _, err := os.Stat(privPath); err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dotSSHPath, d.Name()))
+		if err != nil {
+			continue
+		}
+		pubKey, comment, _, _, err := ssh.ParseAuthorizedKey(content)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &SSHKey{Path: privPath, Type: pubKey.Type(), Comment: comment})
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		ri, rj := keyRank(filepath.Base(keys[i].Path)), keyRank(filepath.Base(keys[j].Path))
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i].Path < keys[j].Path
+	})
+	return
+}
+
+func ShowSSHKeys() {
+	keys := FindSSHKeys()
+	if len(keys) == 0 {
+		gprint.PrintInfo("No ssh keys found in %s.", getDotSSHPath())
+		return
+	}
+	columns := []gtable.Column{
+		{Title: "Path", Width: 50},
+		{Title: "Type", Width: 35},
+		{Title: "Comment", Width: 30},
+	}
+	rows := []gtable.Row{}
+	for _, k := range keys {
+		rows = append(rows, gtable.Row{k.Path, k.Type, k.Comment})
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(10),
+		gtable.WithWidth(120),
+	)
+	t.Run()
+}
+
+/*
+Chooses a key for host.
+Returns empty string when no key is found or ssh-agent is chosen, ssh then tries its default identities.
+*/
+func ChooseSSHKey(host string) string {
+	keys := FindSSHKeys()
+	switch len(keys) {
+	case 0:
+		gprint.PrintWarning("No ssh keys found, try: g git ssh-keygen")
+		return ""
+	case 1:
+		return keys[0].Path
+	}
+	itemList := selector.NewItemList()
+	for _, k := range keys {
+		itemList.Add(k.String(), k.Path)
+	}
+	itemList.Add("ssh-agent or default identities", "")
+	sel := selector.NewSelector(
+		itemList,
+		selector.WithTitle(fmt.Sprintf("Choose ssh key for %s:", host)),
+		selector.WithEnbleInfinite(true),
+		selector.WithWidth(60),
+		selector.WithHeight(10),
+	)
+	sel.Run()
+	if vals := sel.Value(); len(vals) > 0 {
+		return vals[0].(string)
+	}
+	return ""
+}
+
+/*
+Generates an ed25519 key pair, the public key in authorized_keys format is returned.
+*/
+func GenerateSSHKey(fPath, comment, passphrase string, force bool) (pubKey string, err error) {
+	if _, err = os.Stat(fPath); err == nil && !force {
+		return "", fmt.Errorf("%s already exists", fPath)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, comment)
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, comment, []byte(passphrase))
+	}
+	if err != nil {
+		return
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return
+	}
+	pubKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))
+	if comment != "" {
+		pubKey += " " + comment
+	}
+
+	os.MkdirAll(filepath.Dir(fPath), 0o700)
+	if err = os.WriteFile(fPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		return
+	}
+	err = os.WriteFile(fPath+".pub", []byte(pubKey+"\n"), 0o644)
+	return
+}
+
+/*
+Reads a passphrase from terminal like ssh-keygen, empty for no passphrase.
+Nothing is read if stdin is not a terminal.
+*/
+func ReadPassphrase() (passphrase string, err error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", nil
+	}
+	fmt.Fprint(os.Stderr, "Enter passphrase (empty for no passphrase): ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil || len(first) == 0 {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Enter same passphrase again: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return string(first), nil
+}
+
+func DefaultSSHKeyComment() string {
+	hostname, _ := os.Hostname()
+	username := os.Getenv("USER")
+	if username == "" {
+		username = os.Getenv("USERNAME")
+	}
+	return fmt.Sprintf("%s@%s", username, hostname)
+}
+
+// Requests are sent through local proxy if there is one.
+func newAPIClient(cfg *conf.GVConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.LocalProxy != "" {
+		if u, err := url.Parse(cfg.LocalProxy); err == nil {
+			transport.Proxy = http.ProxyURL(u)
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
+
+/*
+Registers a public key with github or gitee using the token in config.
+*/
+func RegisterSSHKey(platform, title, pubKey string) (err error) {
+	cfg := conf.NewGVConfig()
+	body := map[string]string{"title": title, "key": pubKey}
+	var apiURL, token string
+	switch platform {
+	case SSHKeyPlatformGithub:
+		apiURL, token = githubKeysAPI, cfg.GetGitToken()
+	case SSHKeyPlatformGitee:
+		apiURL, token = giteeKeysAPI, cfg.GetGiteeToken()
+		body["access_token"] = token
+	default:
+		return fmt.Errorf("unsupported platform: %s", platform)
+	}
+	if token == "" {
+		return fmt.Errorf("no token for %s", platform)
+	}
+	content, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(content))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if platform == SSHKeyPlatformGithub {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := newAPIClient(cfg).Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s responded %s: %s", platform, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return
+}
@@ -0,0 +1,482 @@
+package git
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Multi-repo workspace.
+
+Repos are cloned into <workspace>/<host>/<owner>/<name>.
+*/
+const (
+	DefaultWorkspaceWorkers int = 8
+	workspaceMaxDepth       int = 4
+	workspaceAPIPerPage     int = 100
+	WorkspacePlatformGithub     = SSHKeyPlatformGithub
+	WorkspacePlatformGitee      = SSHKeyPlatformGitee
+)
+
+var (
+	scpLikeURLRegExp = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):([^/].*)$`)
+	workspaceAPIs    = map[string]string{
+		WorkspacePlatformGithub: "https://api.github.com",
+		WorkspacePlatformGitee:  "https://gitee.com/api/v5",
+	}
+)
+
+type RepoURL struct {
+	URL   string
+	Host  string
+	Owner string
+	Name  string
+}
+
+// Local path relative to workspace.
+func (r *RepoURL) RelPath() string {
+	return filepath.Join(r.Host, r.Owner, r.Name)
+}
+
+/*
+Parses repo urls like:
+https://github.com/owner/name.git, git@github.com:owner/name.git, gitlab.com/group/sub/name, owner/name(github by default).
+*/
+func ParseRepoURL(raw string, useSSH bool) (r *RepoURL, err error) {
+	raw = strings.TrimSpace(raw)
+	var host, fullPath string
+	switch {
+	case strings.Contains(raw, "://"):
+		u, err1 := url.Parse(raw)
+		if err1 != nil {
+			return nil, err1
+		}
+		host, fullPath = u.Hostname(), u.Path
+	case scpLikeURLRegExp.MatchString(raw):
+		sList := scpLikeURLRegExp.FindStringSubmatch(raw)
+		host, fullPath = sList[1], sList[2]
+	default:
+		parts := strings.Split(strings.Trim(raw, "/"), "/")
+		if len(parts) == 2 {
+			host, fullPath = "github.com", raw
+		} else if len(parts) >= 3 && strings.Contains(parts[0], ".") {
+			host, fullPath = parts[0], strings.Join(parts[1:], "/")
+		}
+	}
+	fullPath = strings.TrimSuffix(strings.Trim(fullPath, "/"), ".git")
+	idx := strings.LastIndex(fullPath, "/")
+	if host == "" || idx <= 0 {
+		return nil, fmt.Errorf("invalid repo: %s", raw)
+	}
+	r = &RepoURL{URL: raw, Host: host, Owner: fullPath[:idx], Name: fullPath[idx+1:]}
+	if !strings.Contains(raw, "://") && !scpLikeURLRegExp.MatchString(raw) {
+		if useSSH {
+			r.URL = fmt.Sprintf("git@%s:%s/%s.git", r.Host, r.Owner, r.Name)
+		} else {
+			r.URL = fmt.Sprintf("https://%s/%s/%s.git", r.Host, r.Owner, r.Name)
+		}
+	}
+	return
+}
+
+// Reads repos from a file, one per line, empty lines and comments starting with "#" are ignored.
+func ReadRepoList(fPath string, useSSH bool) (repos []*RepoURL, err error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRepoURL(line, useSSH)
+		if err != nil {
+			gprint.PrintWarning("%+v", err)
+			continue
+		}
+		repos = append(repos, r)
+	}
+	return repos, scanner.Err()
+}
+
+/*
+Lists repos of an organization or a user on github/gitee, tokens in config are used for private repos.
+*/
+func ListOrgRepos(platform, org string, useSSH bool) (repos []*RepoURL, err error) {
+	apiBase, ok := workspaceAPIs[platform]
+	if !ok {
+		return nil, fmt.Errorf("unsupported platform: %s", platform)
+	}
+	cfg := conf.NewGVConfig()
+	token := cfg.GitToken
+	if platform == WorkspacePlatformGitee {
+		token = cfg.GiteeToken
+	}
+	client := newAPIClient(cfg)
+	for _, kind := range []string{"orgs", "users"} {
+		repos = nil
+		for page := 1; ; page++ {
+			u := fmt.Sprintf("%s/%s/%s/repos?per_page=%d&page=%d", apiBase, kind, org, workspaceAPIPerPage, page)
+			req, _ := http.NewRequest(http.MethodGet, u, nil)
+			if token != "" {
+				if platform == WorkspacePlatformGithub {
+					req.Header.Set("Authorization", "Bearer "+token)
+				} else {
+					q := req.URL.Query()
+					q.Set("access_token", token)
+					req.URL.RawQuery = q.Encode()
+				}
+			}
+			resp, err1 := client.Do(req)
+			if err1 != nil {
+				return nil, err1
+			}
+			items := []struct {
+				CloneURL string `json:"clone_url"`
+				HTMLURL  string `json:"html_url"`
+				SSHURL   string `json:"ssh_url"`
+			}{}
+			status := resp.StatusCode
+			if status == http.StatusOK {
+				err = json.NewDecoder(resp.Body).Decode(&items)
+			}
+			resp.Body.Close()
+			if status == http.StatusNotFound && page == 1 {
+				break
+			}
+			if status != http.StatusOK {
+				return nil, fmt.Errorf("%s responded %d", platform, status)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				r, err1 := ParseRepoURL(item.HTMLURL, false)
+				if err1 != nil {
+					continue
+				}
+				// the html url parsed above is kept if there is no clone_url.
+				if item.CloneURL != "" {
+					r.URL = item.CloneURL
+				}
+				if useSSH && item.SSHURL != "" {
+					r.URL = item.SSHURL
+				}
+				repos = append(repos, r)
+			}
+			if len(items) < workspaceAPIPerPage {
+				return repos, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot find %s on %s", org, platform)
+}
+
+type WorkspaceResult struct {
+	Repo   string
+	Err    error
+	Output string
+	Cost   time.Duration
+}
+
+type Workspace struct {
+	Dir     string
+	Workers int
+}
+
+func NewWorkspace(dir string, workers int) *Workspace {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	dir, _ = filepath.Abs(dir)
+	if workers <= 0 {
+		workers = DefaultWorkspaceWorkers
+	}
+	return &Workspace{Dir: dir, Workers: workers}
+}
+
+// Finds git repos in workspace, nested repos are not searched.
+func (w *Workspace) Repos() (repos []string) {
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			repos = append(repos, dir)
+			return
+		}
+		if depth >= workspaceMaxDepth {
+			return
+		}
+		dList, _ := os.ReadDir(dir)
+		for _, d := range dList {
+			if d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+				walk(filepath.Join(dir, d.Name()), depth+1)
+			}
+		}
+	}
+	walk(w.Dir, 0)
+	sort.Strings(repos)
+	return
+}
+
+func (w *Workspace) rel(repoDir string) string {
+	if r, err := filepath.Rel(w.Dir, repoDir); err == nil {
+		return r
+	}
+	return repoDir
+}
+
+func runIn(dir string, args ...string) (string, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// Runs task for each item with limited workers, results keep the order of items.
+func (w *Workspace) parallel(items []string, task func(item string) *WorkspaceResult) (results []*WorkspaceResult) {
+	results = make([]*WorkspaceResult, len(items))
+	sem := make(chan struct{}, w.Workers)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			r := task(item)
+			r.Cost = time.Since(start)
+			results[i] = r
+		}(i, item)
+	}
+	wg.Wait()
+	return
+}
+
+// Prints failures and counts.
+func showWorkspaceSummary(action string, results []*WorkspaceResult) {
+	failed := 0
+	for _, r := range results {
+		if r.Err == nil {
+			continue
+		}
+		failed++
+		gprint.PrintError("%s: %v", r.Repo, r.Err)
+		if r.Output != "" {
+			fmt.Println(r.Output)
+		}
+	}
+	if failed == 0 {
+		gprint.PrintSuccess("%s: %d repos succeeded.", action, len(results))
+	} else {
+		gprint.PrintWarning("%s: %d succeeded, %d failed.", action, len(results)-failed, failed)
+	}
+}
+
+/*
+Clones repos into workspace, existing ones are skipped.
+*/
+func (w *Workspace) Clone(repos []*RepoURL) {
+	if len(repos) == 0 {
+		gprint.PrintWarning("No repos to clone.")
+		return
+	}
+	byPath := map[string]*RepoURL{}
+	paths := []string{}
+	for _, r := range repos {
+		if _, ok := byPath[r.RelPath()]; !ok {
+			paths = append(paths, r.RelPath())
+		}
+		byPath[r.RelPath()] = r
+	}
+	skipped := 0
+	results := w.parallel(paths, func(relPath string) *WorkspaceResult {
+		r := &WorkspaceResult{Repo: relPath}
+		dst := filepath.Join(w.Dir, relPath)
+		if ok, _ := gutils.PathIsExist(dst); ok {
+			r.Output = "exists"
+			return r
+		}
+		os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+		r.Output, r.Err = runIn(w.Dir, "git", "clone", byPath[relPath].URL, dst)
+		if r.Err == nil {
+			gprint.PrintInfo("cloned: %s", relPath)
+		}
+		return r
+	})
+	for _, r := range results {
+		if r.Err == nil && r.Output == "exists" {
+			skipped++
+			r.Output = ""
+		}
+	}
+	if skipped > 0 {
+		gprint.PrintInfo("%d repos already exist.", skipped)
+	}
+	showWorkspaceSummary("clone", results)
+}
+
+type RepoStatus struct {
+	Branch string
+	Dirty  int
+	Ahead  int
+	Behind int
+	HasUp  bool
+}
+
+// Parses output of "git status --porcelain=v2 --branch".
+func ParseRepoStatus(output string) (s *RepoStatus) {
+	s = &RepoStatus{}
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "# branch.head "):
+			s.Branch = strings.TrimPrefix(line, "# branch.head ")
+		case strings.HasPrefix(line, "# branch.ab "):
+			s.HasUp = true
+			fields := strings.Fields(strings.TrimPrefix(line, "# branch.ab "))
+			if len(fields) == 2 {
+				s.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[0], "+"))
+				s.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[1], "-"))
+			}
+		case strings.HasPrefix(line, "#"), line == "":
+		default:
+			s.Dirty++
+		}
+	}
+	return
+}
+
+func (w *Workspace) Status() {
+	repos := w.Repos()
+	if len(repos) == 0 {
+		gprint.PrintInfo("No repos found in %s.", w.Dir)
+		return
+	}
+	statuses := make(map[string]*RepoStatus, len(repos))
+	var lock sync.Mutex
+	results := w.parallel(repos, func(dir string) *WorkspaceResult {
+		r := &WorkspaceResult{Repo: w.rel(dir)}
+		output, err := runIn(dir, "git", "status", "--porcelain=v2", "--branch")
+		if err != nil {
+			r.Err, r.Output = err, output
+			return r
+		}
+		lock.Lock()
+		statuses[dir] = ParseRepoStatus(output)
+		lock.Unlock()
+		return r
+	})
+
+	columns := []gtable.Column{
+		{Title: "Repo", Width: 50},
+		{Title: "Branch", Width: 20},
+		{Title: "Dirty", Width: 8},
+		{Title: "Ahead", Width: 8},
+		{Title: "Behind", Width: 8},
+	}
+	rows := []gtable.Row{}
+	for _, dir := range repos {
+		s, ok := statuses[dir]
+		if !ok {
+			rows = append(rows, gtable.Row{w.rel(dir), gprint.RedStr("error"), "", "", ""})
+			continue
+		}
+		dirty := gprint.GreenStr("clean")
+		if s.Dirty > 0 {
+			dirty = gprint.YellowStr("%d", s.Dirty)
+		}
+		ahead, behind := "-", "-"
+		if s.HasUp {
+			ahead, behind = strconv.Itoa(s.Ahead), strconv.Itoa(s.Behind)
+		}
+		rows = append(rows, gtable.Row{w.rel(dir), s.Branch, dirty, ahead, behind})
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(20),
+		gtable.WithWidth(110),
+	)
+	t.Run()
+	showWorkspaceSummary("status", results)
+}
+
+// Runs a git command in all repos in parallel.
+func (w *Workspace) gitAll(action string, args ...string) {
+	repos := w.Repos()
+	if len(repos) == 0 {
+		gprint.PrintInfo("No repos found in %s.", w.Dir)
+		return
+	}
+	results := w.parallel(repos, func(dir string) *WorkspaceResult {
+		r := &WorkspaceResult{Repo: w.rel(dir)}
+		r.Output, r.Err = runIn(dir, append([]string{"git"}, args...)...)
+		if r.Err == nil {
+			gprint.PrintInfo("%s: %s", action, r.Repo)
+		}
+		return r
+	})
+	showWorkspaceSummary(action, results)
+}
+
+func (w *Workspace) Pull() {
+	w.gitAll("pull", "pull", "--ff-only")
+}
+
+func (w *Workspace) Fetch() {
+	w.gitAll("fetch", "fetch", "--all", "--prune")
+}
+
+/*
+Executes a command in each repo, outputs are printed in order after all are finished.
+Arguments are passed as they are, no shell is involved.
+*/
+func (w *Workspace) Exec(args ...string) {
+	if len(args) == 0 {
+		return
+	}
+	repos := w.Repos()
+	if len(repos) == 0 {
+		gprint.PrintInfo("No repos found in %s.", w.Dir)
+		return
+	}
+	results := w.parallel(repos, func(dir string) *WorkspaceResult {
+		r := &WorkspaceResult{Repo: w.rel(dir)}
+		r.Output, r.Err = runIn(dir, args...)
+		return r
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		fmt.Println(gprint.CyanStr("==> %s (%s)", r.Repo, r.Cost.Round(time.Millisecond)))
+		if r.Output != "" {
+			fmt.Println(r.Output)
+		}
+	}
+	showWorkspaceSummary("exec", results)
+}
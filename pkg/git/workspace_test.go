@@ -0,0 +1,62 @@
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gvcgo/gvc/conf"
+)
+
+func TestListOrgRepos(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	os.MkdirAll(filepath.Dir(conf.GetConfPath()), os.ModePerm)
+	os.WriteFile(conf.GetConfPath(), []byte("{}"), 0o600)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orgs/acme/repos" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[
+			{"html_url": "https://example.com/acme/a", "clone_url": "https://example.com/acme/a.git", "ssh_url": "git@example.com:acme/a.git"},
+			{"html_url": "https://example.com/acme/b", "ssh_url": "git@example.com:acme/b.git"},
+			{"html_url": "https://example.com/acme/c"},
+			{"html_url": "invalid"}
+		]`)
+	}))
+	defer srv.Close()
+	old := workspaceAPIs[WorkspacePlatformGitee]
+	workspaceAPIs[WorkspacePlatformGitee] = srv.URL
+	defer func() { workspaceAPIs[WorkspacePlatformGitee] = old }()
+
+	tests := []struct {
+		useSSH bool
+		want   []string
+	}{
+		{false, []string{"https://example.com/acme/a.git", "https://example.com/acme/b", "https://example.com/acme/c"}},
+		{true, []string{"git@example.com:acme/a.git", "git@example.com:acme/b.git", "https://example.com/acme/c"}},
+	}
+	for _, tt := range tests {
+		repos, err := ListOrgRepos(WorkspacePlatformGitee, "acme", tt.useSSH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repos) != len(tt.want) {
+			t.Fatalf("ssh %v: %d repos, want %d", tt.useSSH, len(repos), len(tt.want))
+		}
+		for i, r := range repos {
+			if r.URL != tt.want[i] || r.Owner != "acme" {
+				t.Errorf("ssh %v: repo %d = %+v, want url %s", tt.useSSH, i, r, tt.want[i])
+			}
+		}
+	}
+	if _, err := ListOrgRepos(WorkspacePlatformGitee, "nobody", false); err == nil {
+		t.Error("expected an error for unknown org")
+	}
+}
@@ -0,0 +1,257 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gtea/gtable"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/gvcgo/gvc/conf"
+)
+
+/*
+Git style external plugins.
+
+An executable named "g-<name>" in ~/.gvc/plugins or in $PATH
+can be invoked as "g <name> args...".
+*/
+const (
+	PluginPrefix  string = "g-"
+	PluginDirName string = "plugins"
+)
+
+func GetPluginDir() string {
+	return filepath.Join(conf.GetGVCWorkDir(), PluginDirName)
+}
+
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// Plugins installed by gvc are stored in plugin dir.
+func (p *Plugin) IsManaged() bool {
+	return filepath.Dir(p.Path) == GetPluginDir()
+}
+
+func isExecutable(fPath string) bool {
+	info, err := os.Stat(fPath)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == gutils.Windows {
+		return strings.HasSuffix(strings.ToLower(fPath), ".exe")
+	}
+	return info.Mode()&0o111 != 0
+}
+
+func getPluginName(fileName string) string {
+	if !strings.HasPrefix(fileName, PluginPrefix) {
+		return ""
+	}
+	name := strings.TrimPrefix(fileName, PluginPrefix)
+	if runtime.GOOS == gutils.Windows {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+/*
+Finds plugins in plugin dir and $PATH.
+Plugin dir takes precedence, and the first one found in $PATH wins.
+*/
+func Discover() (pList []*Plugin) {
+	dirs := []string{GetPluginDir()}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	found := map[string]struct{}{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		dList, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, d := range dList {
+			name := getPluginName(d.Name())
+			if name == "" {
+				continue
+			}
+			if _, ok := found[name]; ok {
+				continue
+			}
+			fPath := filepath.Join(dir, d.Name())
+			if !isExecutable(fPath) {
+				continue
+			}
+			found[name] = struct{}{}
+			pList = append(pList, &Plugin{Name: name, Path: fPath})
+		}
+	}
+	sort.Slice(pList, func(i, j int) bool {
+		return pList[i].Name < pList[j].Name
+	})
+	return
+}
+
+/*
+Envs for plugins.
+
+Password is never exposed to plugins, and tokens are only
+exposed to plugins installed in plugin dir, not to any g-* in $PATH.
+*/
+func GetEnvs(withTokens bool) []string {
+	cfg := conf.NewGVConfig()
+	envs := []string{
+		"GVC_WORK_DIR=" + conf.GetGVCWorkDir(),
+		"GVC_CONF_PATH=" + conf.GetConfPath(),
+		"GVC_GIT_USERNAME=" + cfg.GitUserName,
+		"GVC_GITEE_USERNAME=" + cfg.GiteeUserName,
+		"GVC_PIC_REPO=" + cfg.PicRepo,
+		"GVC_BACKUP_REPO=" + cfg.BackupRepo,
+		"GVC_LOCAL_PROXY=" + cfg.LocalProxy,
+		"GVC_REVERSE_PROXY=" + cfg.ReverseProxy,
+	}
+	if withTokens {
+		envs = append(envs,
+			"GVC_GIT_TOKEN="+cfg.GitToken,
+			"GVC_GITEE_TOKEN="+cfg.GiteeToken,
+		)
+	}
+	return envs
+}
+
+// Runs a plugin and returns its exit code.
+func (p *Plugin) Run(args ...string) (code int) {
+	cmd := exec.Command(p.Path, args...)
+	cmd.Env = append(os.Environ(), GetEnvs(p.IsManaged())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	gprint.PrintError("%+v", err)
+	return 1
+}
+
+func getBinaryName(pkgPath string) string {
+	pkgPath = strings.Split(pkgPath, "@")[0]
+	name := pkgPath[strings.LastIndex(pkgPath, "/")+1:]
+	// github.com/xxx/g-xxx/v2
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		parent := strings.TrimSuffix(pkgPath, "/"+name)
+		name = parent[strings.LastIndex(parent, "/")+1:]
+	}
+	return name
+}
+
+/*
+Installs a plugin with "go install".
+
+Example: Install("github.com/xxx/g-hello@latest")
+*/
+func Install(pkgPath string) (err error) {
+	if _, err = gutils.ExecuteSysCommand(true, "", "go", "version"); err != nil {
+		return fmt.Errorf("cannot find a go compiler")
+	}
+	if !strings.Contains(pkgPath, "@") {
+		pkgPath += "@latest"
+	}
+	binName := getBinaryName(pkgPath)
+	if binName == "" {
+		return fmt.Errorf("invalid package: %s", pkgPath)
+	}
+
+	if err = os.MkdirAll(GetPluginDir(), os.ModePerm); err != nil {
+		return
+	}
+	cmd := exec.Command("go", "install", pkgPath)
+	cmd.Env = append(os.Environ(), "GOBIN="+GetPluginDir())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return
+	}
+
+	ext := ""
+	if runtime.GOOS == gutils.Windows {
+		ext = ".exe"
+	}
+	binPath := filepath.Join(GetPluginDir(), binName+ext)
+	if ok, _ := gutils.PathIsExist(binPath); !ok {
+		return fmt.Errorf("cannot find installed binary: %s", binPath)
+	}
+	if !strings.HasPrefix(binName, PluginPrefix) {
+		newPath := filepath.Join(GetPluginDir(), PluginPrefix+binName+ext)
+		if err = os.Rename(binPath, newPath); err != nil {
+			return
+		}
+		binName = PluginPrefix + binName
+	}
+	gprint.PrintSuccess("plugin installed: %s", getPluginName(binName+ext))
+	return
+}
+
+// Removes a plugin installed by gvc.
+func Remove(name string) (err error) {
+	for _, p := range Discover() {
+		if p.Name != name {
+			continue
+		}
+		if !p.IsManaged() {
+			return fmt.Errorf("plugin %s is not installed by gvc: %s", name, p.Path)
+		}
+		if err = os.Remove(p.Path); err == nil {
+			gprint.PrintSuccess("plugin removed: %s", name)
+		}
+		return
+	}
+	return fmt.Errorf("cannot find plugin: %s", name)
+}
+
+func ShowPlugins() {
+	pList := Discover()
+	if len(pList) == 0 {
+		gprint.PrintInfo("No plugins found.")
+		return
+	}
+	columns := []gtable.Column{
+		{Title: "Plugin", Width: 20},
+		{Title: "Managed", Width: 10},
+		{Title: "Path", Width: 90},
+	}
+	rows := []gtable.Row{}
+	for _, p := range pList {
+		managed := "no"
+		if p.IsManaged() {
+			managed = "yes"
+		}
+		rows = append(rows, gtable.Row{
+			gprint.CyanStr(p.Name),
+			managed,
+			p.Path,
+		})
+	}
+	t := gtable.NewTable(
+		gtable.WithColumns(columns),
+		gtable.WithRows(rows),
+		gtable.WithFocused(true),
+		gtable.WithHeight(15),
+		gtable.WithWidth(125),
+	)
+	t.Run()
+}